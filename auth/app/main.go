@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -12,8 +13,11 @@ import (
 	"github.com/shashank/home-server/common/config"
 	"github.com/shashank/home-server/common/db"
 	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
 	"github.com/shashank/home-server/common/middleware"
 	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/revocation"
+	"github.com/shashank/home-server/common/serviceauth"
 )
 
 // init initializes the gateway service configuration and logger
@@ -39,6 +43,10 @@ func init() {
 	if err := services.InitializeJWTKeys(); err != nil {
 		logging.Log.Fatal("Failed to initialize JWT keys", zap.Error(err))
 	}
+
+	if err := services.InitializePasswordHasher(); err != nil {
+		logging.Log.Fatal("Failed to initialize password hashing", zap.Error(err))
+	}
 }
 
 func main() {
@@ -52,23 +60,107 @@ func main() {
 	}
 	defer database.Close()
 
-	database.AutoMigrate(&models.User{}) // Ensure User model is migrated
+	// Ensure auth models are migrated
+	if err := db.MigrateAuthSchema(database); err != nil {
+		logging.Log.Fatal("Failed to migrate database", zap.Error(err))
+	}
+
+	mailer, err := mail.NewMailer(config.AppConfig.Mail, logging.Log)
+	if err != nil {
+		logging.Log.Fatal("Failed to initialize mailer", zap.Error(err))
+	}
 
 	// Build dependencies
 	healthCheckHandler := handlers.NewHealthCheckHandler(database)
 	userRepo := db.NewUserRepository(database)
-	authService := services.NewAuthService(userRepo)
-	authHandler := handlers.NewAuthHandler(authService)
+	roleRepo := db.NewRoleRepository(database)
+	refreshTokenRepo := db.NewRefreshTokenRepository(database)
+	revokedTokenRepo := db.NewRevokedTokenRepository(database)
+	sessionRepo := db.NewSessionRepository(database)
+	authEventRepo := db.NewAuthEventRepository(database)
+	twoFactorRepo := db.NewTwoFactorRepository(database)
+	authService := services.NewAuthService(userRepo, roleRepo, refreshTokenRepo, revokedTokenRepo, sessionRepo, authEventRepo, twoFactorRepo)
+	sessionHandler := handlers.NewSessionHandler(authService)
+	authEventHandler := handlers.NewAuthEventHandler(authService)
+	oneTimeTokenRepo := db.NewOneTimeTokenRepository(database)
+	twoFactorService, err := services.NewTwoFactorService(twoFactorRepo, userRepo, oneTimeTokenRepo, authService)
+	if err != nil {
+		logging.Log.Fatal("Failed to initialize two-factor authentication", zap.Error(err))
+	}
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	passkeyRepo := db.NewPasskeyRepository(database)
+	passkeyService, err := services.NewPasskeyService(passkeyRepo, userRepo, oneTimeTokenRepo, authService)
+	if err != nil {
+		logging.Log.Fatal("Failed to initialize passkeys", zap.Error(err))
+	}
+	passkeyHandler := handlers.NewPasskeyHandler(passkeyService)
+	authHandler := handlers.NewAuthHandler(authService, twoFactorService)
+	settingRepo := db.NewSettingRepository(database)
+	invitationRepo := db.NewInvitationRepository(database)
+	registrationService := services.NewRegistrationService(database, userRepo, roleRepo, oneTimeTokenRepo, settingRepo, invitationRepo, authService, mailer)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+	passwordResetService := services.NewPasswordResetService(userRepo, oneTimeTokenRepo, authService, mailer)
+	passwordHandler := handlers.NewPasswordHandler(authService, passwordResetService)
+	profileService := services.NewProfileService(userRepo, oneTimeTokenRepo, authService, mailer)
+	profileHandler := handlers.NewProfileHandler(profileService)
+	userAdminService := services.NewUserAdminService(database, userRepo, roleRepo, authService)
+	userAdminHandler := handlers.NewUserAdminHandler(userAdminService, passwordResetService)
+	bootstrapService := services.NewBootstrapService(roleRepo, userAdminService, authService)
+	setupHandler := handlers.NewSetupHandler(bootstrapService)
+	impersonationService := services.NewImpersonationService(userRepo, roleRepo, authService)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService)
+	serviceAccountRepo := db.NewServiceAccountRepository(database)
+	serviceAccountService := services.NewServiceAccountService(serviceAccountRepo)
+	serviceAccountHandler := handlers.NewServiceAccountHandler(serviceAccountService)
+	oauthRepo := db.NewOAuthRepository(database)
+	oidcService := services.NewOIDCService(oauthRepo, userRepo, roleRepo, oneTimeTokenRepo, refreshTokenRepo, authService, twoFactorService, serviceAccountService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	forwardAuthService := services.NewForwardAuthService(userRepo, roleRepo, authService)
+	forwardAuthHandler := handlers.NewForwardAuthHandler(forwardAuthService, oidcService)
+	oauthClientService := services.NewOAuthClientService(oauthRepo, refreshTokenRepo)
+	oauthClientHandler := handlers.NewOAuthClientHandler(oauthClientService)
+	externalIdentityRepo := db.NewExternalIdentityRepository(database)
+	externalLoginService, err := services.NewExternalLoginService(externalIdentityRepo, userRepo, roleRepo, passkeyRepo, oneTimeTokenRepo, settingRepo)
+	if err != nil {
+		logging.Log.Fatal("Failed to initialize external identity providers", zap.Error(err))
+	}
+	externalLoginHandler := handlers.NewExternalLoginHandler(externalLoginService, authService, twoFactorService)
+	magicLinkService := services.NewMagicLinkService(userRepo, roleRepo, oneTimeTokenRepo, settingRepo, authService, mailer)
+	magicLinkHandler := handlers.NewMagicLinkHandler(magicLinkService, authService, twoFactorService)
+
+	// Restore revoked tokens so that logouts survive restarts
+	if err := authService.LoadRevocations(context.Background()); err != nil {
+		logging.Log.Fatal("Failed to load revocation list", zap.Error(err))
+	}
+	authService.StartTokenCleanup(context.Background())
+	authService.StartRevocationReload(context.Background())
+
+	// Create the first admin of a fresh install, or offer the setup endpoint
+	if err := bootstrapService.Bootstrap(context.Background()); err != nil {
+		logging.Log.Fatal("Failed to check for an admin account", zap.Error(err))
+	}
+
+	// Only the gateway may tell us the client IP; other callers, such as requests
+	// to the published port, are identified by their own address
+	if err := router.SetTrustedProxies(config.AppConfig.Security.TrustedProxies); err != nil {
+		logging.Log.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 
 	// Add middleware
 	router.Use(middleware.RequestLoggingMiddleware())
 	router.Use(middleware.CorsMiddleware())
 	router.Use(middleware.RateLimitMiddleware())
 	router.Use(middleware.SecurityHeadersMiddleware())
+	router.Use(auth_middleware.ClientInfoMiddleware())
 
 	// Health check endpoint
 	router.GET("/health", healthCheckHandler.HealthCheckHandler)
 
+	// Internal endpoints polled by other services (not proxied by the gateway).
+	// Callers authenticate with a service token.
+	serviceVerifier := serviceauth.NewVerifier(config.AppConfig.ServiceAuth, revocation.Audience)
+	router.GET("/internal/revocations", serviceVerifier.Middleware(revocation.Scope), authHandler.RevocationsHandler)
+
 	// Authentication routes - all under /api/v1/auth
 	api := router.Group(config.AppConfig.API.BaseURL)
 	{
@@ -76,17 +168,144 @@ func main() {
 		{
 			// Public routes
 			auth.POST("/login", authHandler.LoginHandler)
+			auth.POST("/login/2fa", twoFactorHandler.LoginTwoFactorHandler)
+			auth.POST("/passkeys/login/begin", passkeyHandler.BeginLoginHandler)
+			auth.POST("/passkeys/login/finish", passkeyHandler.FinishLoginHandler)
+			auth.POST("/refresh", authHandler.RefreshHandler)
 			auth.GET("/public-key", authHandler.GetPublicKeyHandler)
+			auth.GET("/jwks", authHandler.JWKSHandler)
+			auth.POST("/introspect", oidcHandler.IntrospectHandler)
+			auth.GET("/userinfo", oidcHandler.CurrentUserInfoHandler)
+			auth.POST("/userinfo", oidcHandler.CurrentUserInfoHandler)
+			auth.POST("/register", registrationHandler.RegisterHandler)
+			auth.POST("/invites/lookup", registrationHandler.LookupInviteHandler)
+			auth.GET("/verify-email", registrationHandler.VerifyEmailHandler)
+			auth.POST("/verify-email", registrationHandler.VerifyEmailHandler)
+			auth.POST("/verify-email/resend", registrationHandler.ResendVerificationHandler)
+			auth.GET("/email/confirm", profileHandler.ConfirmEmailChangeHandler)
+			auth.POST("/email/confirm", profileHandler.ConfirmEmailChangeHandler)
+			auth.POST("/password/forgot", passwordHandler.ForgotPasswordHandler)
+			auth.POST("/password/reset", passwordHandler.ResetPasswordHandler)
+
+			// First-run setup, only available until an admin exists
+			auth.GET("/setup", setupHandler.StatusHandler)
+			auth.POST("/setup", setupHandler.CompleteSetupHandler)
+
+			// Passwordless sign in with emailed links
+			auth.POST("/magic-link", magicLinkHandler.RequestLinkHandler)
+			auth.GET("/magic-link/callback", magicLinkHandler.CallbackHandler)
+
+			// Sign in with upstream identity providers under /auth/external/*
+			auth.GET("/external/providers", externalLoginHandler.ListProvidersHandler)
+			auth.GET("/external/:provider/login", externalLoginHandler.LoginHandler)
+			auth.GET("/external/:provider/callback", externalLoginHandler.CallbackHandler)
+
+			// Forward auth for apps behind a reverse proxy under /auth/forward/*
+			forward := auth.Group("/forward")
+			{
+				forward.GET("/verify", forwardAuthHandler.VerifyHandler)
+				forward.GET("/login", forwardAuthHandler.LoginPageHandler)
+				forward.POST("/login", forwardAuthHandler.LoginFormHandler)
+				forward.POST("/logout", forwardAuthHandler.LogoutHandler)
+			}
+
+			// OpenID Connect provider under /auth/oidc/*
+			oidc := auth.Group("/oidc")
+			{
+				oidc.GET("/.well-known/openid-configuration", oidcHandler.DiscoveryHandler)
+				oidc.GET("/jwks", oidcHandler.JWKSHandler)
+				oidc.GET("/authorize", oidcHandler.AuthorizeHandler)
+				oidc.POST("/authorize", oidcHandler.AuthorizeFormHandler)
+				oidc.POST("/token", oidcHandler.TokenHandler)
+				oidc.GET("/userinfo", oidcHandler.UserInfoHandler)
+				oidc.POST("/userinfo", oidcHandler.UserInfoHandler)
+			}
 
 			// Protected routes
-			authProtected := auth.Use(auth_middleware.JwtAuthMiddleware())
+			authProtected := auth.Group("", auth_middleware.JwtAuthMiddleware())
 			{
 				authProtected.POST("/logout", authHandler.LogoutHandler)
-				authProtected.POST("/refresh", authHandler.RefreshHandler)
+				authProtected.POST("/impersonation/end", impersonationHandler.EndHandler)
 
 				// User management routes under /auth/users/*
 				authProtected.GET("/users/profile", authHandler.GetUserProfileHandler)
-				authProtected.PUT("/users/profile", authHandler.UpdateUserProfileHandler)
+				authProtected.GET("/users/2fa", twoFactorHandler.StatusHandler)
+				authProtected.GET("/users/passkeys", passkeyHandler.ListHandler)
+				authProtected.GET("/users/consents", oidcHandler.ListConsentsHandler)
+				authProtected.DELETE("/users/consents/:client_id", oidcHandler.RevokeConsentHandler)
+				authProtected.GET("/users/sessions", sessionHandler.ListSessionsHandler)
+				authProtected.GET("/users/external", externalLoginHandler.ListIdentitiesHandler)
+
+				// Account security changes, which an admin impersonating the user may not make
+				selfOnly := authProtected.Group("/users", auth_middleware.DenyImpersonation())
+				{
+					selfOnly.PATCH("/profile", profileHandler.UpdateProfileHandler)
+					selfOnly.PUT("/password", passwordHandler.ChangePasswordHandler)
+					selfOnly.DELETE("/2fa", twoFactorHandler.DisableHandler)
+					selfOnly.POST("/2fa/totp", twoFactorHandler.BeginTOTPHandler)
+					selfOnly.POST("/2fa/totp/confirm", twoFactorHandler.ConfirmTOTPHandler)
+					selfOnly.POST("/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodesHandler)
+					selfOnly.POST("/passkeys/register/begin", passkeyHandler.BeginRegistrationHandler)
+					selfOnly.POST("/passkeys/register/finish", passkeyHandler.FinishRegistrationHandler)
+					selfOnly.DELETE("/passkeys/:id", passkeyHandler.DeleteHandler)
+					selfOnly.DELETE("/sessions", sessionHandler.RevokeOtherSessionsHandler)
+					selfOnly.DELETE("/sessions/:session_id", sessionHandler.RevokeSessionHandler)
+					selfOnly.POST("/external/:provider/link", externalLoginHandler.LinkHandler)
+					selfOnly.DELETE("/external/:provider", externalLoginHandler.UnlinkHandler)
+				}
+
+				// Admin routes under /auth/admin/*, each guarded by a permission
+				settingsAdmin := authProtected.Group("/admin", auth_middleware.RequirePermission(models.PermissionSettingsManage))
+				{
+					settingsAdmin.GET("/settings/registration", registrationHandler.GetRegistrationModeHandler)
+					settingsAdmin.PUT("/settings/registration", registrationHandler.SetRegistrationModeHandler)
+					settingsAdmin.GET("/settings/external-providers", externalLoginHandler.GetProviderSettingsHandler)
+					settingsAdmin.PUT("/settings/external-providers/:provider", externalLoginHandler.SetProviderSettingsHandler)
+					settingsAdmin.GET("/settings/magic-link", magicLinkHandler.GetRoleSettingsHandler)
+					settingsAdmin.PUT("/settings/magic-link/:role", magicLinkHandler.SetRoleSettingsHandler)
+				}
+
+				clientsAdmin := authProtected.Group("/admin/oidc/clients", auth_middleware.RequirePermission(models.PermissionClientsManage))
+				{
+					clientsAdmin.GET("", oauthClientHandler.ListClientsHandler)
+					clientsAdmin.POST("", oauthClientHandler.CreateClientHandler)
+					clientsAdmin.GET("/:id", oauthClientHandler.GetClientHandler)
+					clientsAdmin.PATCH("/:id", oauthClientHandler.UpdateClientHandler)
+					clientsAdmin.DELETE("/:id", oauthClientHandler.DeleteClientHandler)
+					clientsAdmin.POST("/:id/secret", oauthClientHandler.RotateSecretHandler)
+				}
+
+				serviceAccountsAdmin := authProtected.Group("/admin/service-accounts", auth_middleware.RequirePermission(models.PermissionClientsManage))
+				{
+					serviceAccountsAdmin.GET("", serviceAccountHandler.ListAccountsHandler)
+					serviceAccountsAdmin.POST("", serviceAccountHandler.CreateAccountHandler)
+					serviceAccountsAdmin.PATCH("/:id", serviceAccountHandler.UpdateAccountHandler)
+					serviceAccountsAdmin.DELETE("/:id", serviceAccountHandler.DeleteAccountHandler)
+					serviceAccountsAdmin.POST("/:id/secret", serviceAccountHandler.RotateSecretHandler)
+				}
+
+				admin := authProtected.Group("/admin", auth_middleware.RequirePermission(models.PermissionUsersManage))
+				{
+					admin.GET("/roles", userAdminHandler.ListRolesHandler)
+					admin.GET("/invites", registrationHandler.ListInvitesHandler)
+					admin.POST("/invites", registrationHandler.CreateInviteHandler)
+					admin.DELETE("/invites/:id", registrationHandler.RevokeInviteHandler)
+					admin.GET("/users", userAdminHandler.ListUsersHandler)
+					admin.POST("/users", userAdminHandler.CreateUserHandler)
+					admin.GET("/users/:id", userAdminHandler.GetUserHandler)
+					admin.PATCH("/users/:id", userAdminHandler.UpdateUserHandler)
+					admin.DELETE("/users/:id", userAdminHandler.DeleteUserHandler)
+					admin.POST("/users/:id/restore", userAdminHandler.RestoreUserHandler)
+					admin.POST("/users/:id/impersonate", impersonationHandler.StartHandler)
+					admin.POST("/users/:id/password-reset", userAdminHandler.ForcePasswordResetHandler)
+					admin.DELETE("/users/:id/2fa", twoFactorHandler.AdminResetHandler)
+					admin.GET("/users/:id/sessions", sessionHandler.AdminListSessionsHandler)
+					admin.DELETE("/users/:id/sessions", sessionHandler.AdminRevokeAllSessionsHandler)
+					admin.DELETE("/users/:id/sessions/:session_id", sessionHandler.AdminRevokeSessionHandler)
+					admin.GET("/lockouts", authHandler.GetLockedUsersHandler)
+					admin.GET("/auth-events", authEventHandler.ListEventsHandler)
+					admin.DELETE("/users/:id/lockout", authHandler.UnlockUserHandler)
+				}
 			}
 		}
 	}
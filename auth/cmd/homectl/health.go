@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/shashank/home-server/common/config"
+)
+
+// healthTimeout bounds each health check
+const healthTimeout = 5 * time.Second
+
+// healthResult is the outcome of checking one component
+type healthResult struct {
+	Name    string `json:"name"`
+	Target  string `json:"target"`
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// health checks the database and the /health endpoint of every service. The
+// default URLs are the docker compose service names, as seen from auth-service.
+func (c *cli) health(args []string) error {
+	flags := c.subcommand("health")
+	gatewayURL := flags.String("gateway", "http://gateway-service:8080/health", "gateway health URL")
+	authURL := flags.String("auth", "http://localhost:8080/health", "auth service health URL")
+	statsURL := flags.String("stats", "http://stats-service:8080/health", "stats service health URL")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	results := []healthResult{c.checkDatabase()}
+	client := &http.Client{Timeout: healthTimeout}
+	for _, service := range []struct{ name, url string }{
+		{"gateway", *gatewayURL},
+		{"auth", *authURL},
+		{"stats", *statsURL},
+	} {
+		results = append(results, checkHTTP(client, service.name, service.url))
+	}
+
+	healthy := true
+	for _, result := range results {
+		healthy = healthy && result.Healthy
+	}
+
+	if err := c.print(results, func(w io.Writer) {
+		row(w, "COMPONENT", "TARGET", "STATUS", "DETAIL")
+		for _, result := range results {
+			status := "healthy"
+			if !result.Healthy {
+				status = "unhealthy"
+			}
+			row(w, result.Name, result.Target, status, result.Detail)
+		}
+	}); err != nil {
+		return err
+	}
+	if !healthy {
+		return errors.New("some components are unhealthy")
+	}
+	return nil
+}
+
+// checkDatabase connects to and pings the database
+func (c *cli) checkDatabase() healthResult {
+	cfg := config.AppConfig.Database
+	result := healthResult{Name: "database", Target: fmt.Sprintf("%s:%d/%s", cfg.Host, cfg.Port, cfg.Name)}
+
+	database, err := c.db()
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	if err := database.Ping(ctx); err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.Healthy = true
+	return result
+}
+
+// checkHTTP expects a 200 response from a service's health endpoint
+func checkHTTP(client *http.Client, name, url string) healthResult {
+	result := healthResult{Name: name, Target: url}
+
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Detail = fmt.Sprintf("status %d", resp.StatusCode)
+		return result
+	}
+	result.Healthy = true
+	result.Detail = time.Since(start).Round(time.Millisecond).String()
+	return result
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/shashank/home-server/auth/services"
+)
+
+// keys dispatches the JWT signing key commands
+func (c *cli) keys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("keys needs a command: list or rotate")
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		if len(args) > 0 {
+			return fmt.Errorf("keys list takes no arguments")
+		}
+		return c.listKeys()
+	case "rotate":
+		flags := c.subcommand("keys rotate")
+		keep := flags.Int("keep", 0, "keep only the newest n keys, including the new one (0 keeps all)")
+		if err := flags.Parse(args); err != nil {
+			return errUsage
+		}
+		if *keep < 0 {
+			return fmt.Errorf("-keep must not be negative")
+		}
+		return c.rotateKeys(*keep)
+	default:
+		return fmt.Errorf("unknown keys command %q", command)
+	}
+}
+
+// listKeys prints the keys in the JWT key file
+func (c *cli) listKeys() error {
+	infos, err := services.ListSigningKeys()
+	if err != nil {
+		return err
+	}
+	return c.print(infos, func(w io.Writer) {
+		row(w, "KID", "ALG", "CURRENT")
+		for _, info := range infos {
+			row(w, info.KeyID, info.Algorithm, strconv.FormatBool(info.Current))
+		}
+	})
+}
+
+// rotateKeys adds a new signing key. The auth service loads its keys at start,
+// so it keeps signing with the old key until it is restarted.
+func (c *cli) rotateKeys(keep int) error {
+	keyID, retired, err := services.RotateSigningKeys(keep)
+	if err != nil {
+		return err
+	}
+	result := struct {
+		KeyID   string `json:"kid"`
+		Retired int    `json:"retired"`
+	}{keyID, retired}
+	return c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "New signing key %s, %d old keys removed\n", keyID, retired)
+		fmt.Fprintln(w, "Restart auth-service to start signing with it")
+	})
+}
@@ -0,0 +1,210 @@
+// Command homectl administers the home server from the command line: users,
+// JWT signing keys, database migrations and service health. It reads the auth
+// service's config.yaml and talks to the database directly, so it is meant to
+// run inside the auth-service container, e.g.
+//
+//	docker exec -it auth-service ./homectl users list
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+)
+
+const usage = `Usage: homectl [flags] <command> [arguments]
+
+Commands:
+  users list [-search term] [-page n] [-page-size n]
+  users search <term>
+  users create -email address -name name [-role role]... [-password-stdin]
+  users disable <id|email>
+  users enable <id|email>
+  users delete <id|email>
+  users restore <id|email>
+  users reset-password <id|email> [-password-stdin]
+  keys list
+  keys rotate [-keep n]
+  migrate
+  health [-gateway url] [-auth url] [-stats url]
+
+Flags:
+`
+
+// errUsage is returned for a bad command line, after the usage was printed
+var errUsage = errors.New("invalid usage")
+
+// cli holds the global flags and the lazily opened database
+type cli struct {
+	configPath string
+	output     string
+	verbose    bool
+
+	stdout   io.Writer
+	stderr   io.Writer
+	database *db.DB
+}
+
+func main() {
+	c := &cli{stdout: os.Stdout, stderr: os.Stderr}
+	err := c.run(os.Args[1:])
+	if c.database != nil {
+		c.database.Close()
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(c.stderr, "homectl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the global flags and dispatches to a command
+func (c *cli) run(args []string) error {
+	flags := flag.NewFlagSet("homectl", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.StringVar(&c.configPath, "config", "config.yaml", "path to the auth service configuration")
+	flags.StringVar(&c.output, "o", "table", "output format: table or json")
+	flags.BoolVar(&c.verbose, "v", false, "log to stderr")
+	flags.Usage = func() {
+		fmt.Fprint(c.stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if c.output != "table" && c.output != "json" {
+		return fmt.Errorf("unknown output format %q", c.output)
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	if err := c.init(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "users":
+		return c.users(args[1:])
+	case "keys":
+		return c.keys(args[1:])
+	case "migrate":
+		return c.migrate(args[1:])
+	case "health":
+		return c.health(args[1:])
+	default:
+		flags.Usage()
+		return errUsage
+	}
+}
+
+// init loads the configuration and sets up logging. Service logs are only
+// shown with -v so that they don't mix with the command's output.
+func (c *cli) init() error {
+	if err := config.LoadConfig(c.configPath); err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !c.verbose {
+		logging.Log = zap.NewNop()
+		return nil
+	}
+	cfg := config.AppConfig.Logging
+	cfg.Output = "stderr"
+	if err := logging.InitLogger(cfg, "homectl"); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	return nil
+}
+
+// db opens the database connection on first use
+func (c *cli) db() (*db.DB, error) {
+	if c.database != nil {
+		return c.database, nil
+	}
+	if config.AppConfig.Database.Password == "" {
+		return nil, errors.New("DB_PASSWORD environment variable is not set")
+	}
+	database, err := db.InitDbConnection(config.AppConfig.Database, logging.Log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	c.database = database
+	return database, nil
+}
+
+// userAdmin builds the user management service on top of the database
+func (c *cli) userAdmin() (*services.UserAdminService, error) {
+	database, err := c.db()
+	if err != nil {
+		return nil, err
+	}
+	if err := services.InitializePasswordHasher(); err != nil {
+		return nil, fmt.Errorf("failed to initialize password hashing: %w", err)
+	}
+
+	userRepo := db.NewUserRepository(database)
+	roleRepo := db.NewRoleRepository(database)
+	authService := services.NewAuthService(userRepo, roleRepo,
+		db.NewRefreshTokenRepository(database),
+		db.NewRevokedTokenRepository(database),
+		db.NewSessionRepository(database),
+		db.NewAuthEventRepository(database),
+		db.NewTwoFactorRepository(database))
+	return services.NewUserAdminService(database, userRepo, roleRepo, authService), nil
+}
+
+// migrate runs the auth schema migrations
+func (c *cli) migrate(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("migrate takes no arguments")
+	}
+	database, err := c.db()
+	if err != nil {
+		return err
+	}
+	if err := db.MigrateAuthSchema(database); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return c.print(map[string]string{"status": "migrated"}, func(w io.Writer) {
+		fmt.Fprintln(w, "Database schema is up to date")
+	})
+}
+
+// print writes v as JSON with -o json, and otherwise calls table
+func (c *cli) print(v interface{}, table func(w io.Writer)) error {
+	if c.output == "json" {
+		encoder := json.NewEncoder(c.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes tab separated columns to a table
+func row(w io.Writer, columns ...string) {
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+}
+
+// subcommand creates the flag set of a command
+func (c *cli) subcommand(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("homectl "+name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/models"
+)
+
+// cliAdminID is passed as the acting admin; no user has ID 0, so checks that
+// stop admins from locking themselves out never apply to the CLI
+const cliAdminID = 0
+
+// userRow is a user as printed by the users commands
+type userRow struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Roles         []string   `json:"roles"`
+	Disabled      bool       `json:"disabled"`
+	EmailVerified bool       `json:"email_verified"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// users dispatches the user management commands
+func (c *cli) users(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("users needs a command: list, search, create, disable, enable, delete, restore or reset-password")
+	}
+	admin, err := c.userAdmin()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		flags := c.subcommand("users list")
+		search := flags.String("search", "", "filter by name or email")
+		page := flags.Int("page", 1, "page number")
+		pageSize := flags.Int("page-size", 50, "users per page")
+		if err := flags.Parse(args); err != nil {
+			return errUsage
+		}
+		return c.listUsers(ctx, admin, *search, *page, *pageSize)
+	case "search":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: homectl users search <term>")
+		}
+		return c.listUsers(ctx, admin, args[0], 1, 50)
+	case "create":
+		return c.createUser(ctx, admin, args)
+	case "reset-password":
+		return c.resetPassword(ctx, admin, args)
+	case "disable", "enable", "delete", "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: homectl users %s <id|email>", command)
+		}
+		user, err := lookupUser(ctx, admin, args[0])
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "disable", "enable":
+			disabled := command == "disable"
+			user, err = admin.UpdateUser(ctx, user.ID, services.UpdateUserInput{Disabled: &disabled}, cliAdminID)
+		case "delete":
+			err = admin.DeleteUser(ctx, user.ID, cliAdminID)
+			if err == nil {
+				user, err = admin.GetUser(ctx, user.ID)
+			}
+		case "restore":
+			user, err = admin.RestoreUser(ctx, user.ID, cliAdminID)
+		}
+		if err != nil {
+			return err
+		}
+		return c.printUsers([]models.User{*user})
+	default:
+		return fmt.Errorf("unknown users command %q", command)
+	}
+}
+
+// listUsers prints a page of users
+func (c *cli) listUsers(ctx context.Context, admin *services.UserAdminService, search string, page, pageSize int) error {
+	users, total, err := admin.ListUsers(ctx, search, page, pageSize)
+	if err != nil {
+		return err
+	}
+	if err := c.printUsers(users); err != nil {
+		return err
+	}
+	if c.output == "table" {
+		fmt.Fprintf(c.stderr, "%d of %d users\n", len(users), total)
+	}
+	return nil
+}
+
+// createUser creates a verified account with a password read from the terminal or stdin
+func (c *cli) createUser(ctx context.Context, admin *services.UserAdminService, args []string) error {
+	flags := c.subcommand("users create")
+	email := flags.String("email", "", "email address (required)")
+	name := flags.String("name", "", "display name (required)")
+	var roles stringList
+	flags.Var(&roles, "role", "role to grant, may be repeated (default: the configured default role)")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of prompting")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *email == "" || *name == "" {
+		return fmt.Errorf("-email and -name are required")
+	}
+
+	password, err := c.readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	user, err := admin.CreateUser(ctx, services.CreateUserInput{
+		Email:    *email,
+		Name:     *name,
+		Password: password,
+		Roles:    roles,
+	}, cliAdminID)
+	if err != nil {
+		return err
+	}
+	return c.printUsers([]models.User{*user})
+}
+
+// resetPassword sets a new password for a user and signs out their sessions
+func (c *cli) resetPassword(ctx context.Context, admin *services.UserAdminService, args []string) error {
+	flags := c.subcommand("users reset-password")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from stdin instead of prompting")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: homectl users reset-password <id|email>")
+	}
+
+	user, err := lookupUser(ctx, admin, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	password, err := c.readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	if err := admin.SetPassword(ctx, user.ID, password, cliAdminID); err != nil {
+		return err
+	}
+	return c.printUsers([]models.User{*user})
+}
+
+// lookupUser finds a user by numeric ID or by email, including deleted users
+func lookupUser(ctx context.Context, admin *services.UserAdminService, ref string) (*models.User, error) {
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return admin.GetUser(ctx, uint(id))
+	}
+	return admin.GetUserByEmail(ctx, ref)
+}
+
+// readPassword reads a password from stdin, or prompts for it twice with the
+// terminal's echo turned off
+func (c *cli) readPassword(fromStdin bool) (string, error) {
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password := strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return "", errors.New("no password on stdin")
+		}
+		return password, nil
+	}
+
+	if err := stty("-echo"); err != nil {
+		return "", errors.New("cannot prompt for a password without a terminal; use -password-stdin")
+	}
+	defer stty("echo")
+
+	reader := bufio.NewReader(os.Stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Fprint(c.stderr, label)
+		line, err := reader.ReadString('\n')
+		fmt.Fprintln(c.stderr)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", err
+	}
+	confirm, err := prompt("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if password != confirm {
+		return "", errors.New("passwords do not match")
+	}
+	if password == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return password, nil
+}
+
+// stty changes the settings of the terminal on stdin
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// printUsers prints users as a table or JSON
+func (c *cli) printUsers(users []models.User) error {
+	rows := make([]userRow, 0, len(users))
+	for _, user := range users {
+		r := userRow{
+			ID:            user.ID,
+			Email:         user.Email,
+			Name:          user.Name,
+			Roles:         models.RoleNames(user.Roles),
+			Disabled:      user.Disabled,
+			EmailVerified: user.EmailVerifiedAt != nil,
+			CreatedAt:     user.CreatedAt,
+		}
+		if user.DeletedAt.Valid {
+			deletedAt := user.DeletedAt.Time
+			r.DeletedAt = &deletedAt
+		}
+		rows = append(rows, r)
+	}
+
+	return c.print(rows, func(w io.Writer) {
+		row(w, "ID", "EMAIL", "NAME", "ROLES", "STATUS", "CREATED")
+		for _, r := range rows {
+			status := "active"
+			switch {
+			case r.DeletedAt != nil:
+				status = "deleted"
+			case r.Disabled:
+				status = "disabled"
+			case !r.EmailVerified:
+				status = "unverified"
+			}
+			row(w, strconv.Itoa(int(r.ID)), r.Email, r.Name, strings.Join(r.Roles, ","), status, r.CreatedAt.Format("2006-01-02 15:04"))
+		}
+	})
+}
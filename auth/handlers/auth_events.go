@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+const (
+	defaultEventPageSize = 50
+	maxEventPageSize     = 200
+)
+
+// AuthEventHandler serves the authentication audit log to admins
+type AuthEventHandler struct {
+	authService *services.AuthService
+}
+
+// NewAuthEventHandler creates a new AuthEventHandler
+func NewAuthEventHandler(authService *services.AuthService) *AuthEventHandler {
+	return &AuthEventHandler{
+		authService: authService,
+	}
+}
+
+// ListEventsHandler returns a page of audit events, newest first. Query parameters:
+// user_id, actor_id, type, since and until (RFC 3339), page, page_size.
+func (h *AuthEventHandler) ListEventsHandler(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultEventPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxEventPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_size"})
+		return
+	}
+
+	filter := db.AuthEventFilter{Type: c.Query("type")}
+	if value := c.Query("user_id"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+	if value := c.Query("actor_id"); value != "" {
+		actorID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return
+		}
+		filter.ActorID = uint(actorID)
+	}
+	if filter.Since, err = timeQuery(c, "since"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since, expected an RFC 3339 time"})
+		return
+	}
+	if filter.Until, err = timeQuery(c, "until"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until, expected an RFC 3339 time"})
+		return
+	}
+
+	events, total, err := h.authService.ListEvents(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		logging.Log.Error("Failed to list auth events", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list auth events"})
+		return
+	}
+	if events == nil {
+		events = []models.AuthEvent{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// timeQuery parses an optional RFC 3339 query parameter, returning the zero time when it is absent
+func timeQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// externalStateCookie binds an external sign in to the browser that started it
+const externalStateCookie = "external_login_state"
+
+// ExternalProviderResponse describes a provider shown on the login page
+type ExternalProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// AdminExternalProviderResponse describes a provider and its settings for admins
+type AdminExternalProviderResponse struct {
+	Name          string `json:"name"`
+	DisplayName   string `json:"display_name"`
+	AutoProvision bool   `json:"auto_provision"`
+}
+
+// SetAutoProvisionRequest represents the JSON payload for changing a provider's auto-provisioning
+type SetAutoProvisionRequest struct {
+	AutoProvision *bool `json:"auto_provision" binding:"required"`
+}
+
+// ExternalLoginHandler handles sign in with upstream OpenID Connect providers
+type ExternalLoginHandler struct {
+	externalService  *services.ExternalLoginService
+	authService      *services.AuthService
+	twoFactorService *services.TwoFactorService
+}
+
+// NewExternalLoginHandler creates a new ExternalLoginHandler
+func NewExternalLoginHandler(externalService *services.ExternalLoginService, authService *services.AuthService, twoFactorService *services.TwoFactorService) *ExternalLoginHandler {
+	return &ExternalLoginHandler{
+		externalService:  externalService,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+	}
+}
+
+// ListProvidersHandler returns the providers users can sign in with
+func (h *ExternalLoginHandler) ListProvidersHandler(c *gin.Context) {
+	providers, err := h.externalService.ListProviders(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list external providers", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list providers"})
+		return
+	}
+
+	response := make([]ExternalProviderResponse, 0, len(providers))
+	for _, provider := range providers {
+		response = append(response, ExternalProviderResponse{
+			Name:        provider.Name,
+			DisplayName: provider.DisplayName,
+			LoginURL:    services.ExternalLoginPath() + "/" + provider.Name + "/login",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": response})
+}
+
+// LoginHandler redirects the browser to the provider's sign in page
+func (h *ExternalLoginHandler) LoginHandler(c *gin.Context) {
+	provider := c.Param("provider")
+	authURL, state, ttl, err := h.externalService.BeginLogin(c.Request.Context(), provider, 0)
+	if err != nil {
+		respondExternalLoginError(c, "start external sign in", err)
+		return
+	}
+
+	setExternalStateCookie(c, state, ttl)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkHandler starts linking a provider identity to the current user. The UI
+// sends the browser to the returned URL, which comes back to the callback.
+func (h *ExternalLoginHandler) LinkHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	authURL, state, ttl, err := h.externalService.BeginLogin(c.Request.Context(), c.Param("provider"), userID)
+	if err != nil {
+		respondExternalLoginError(c, "start identity linking", err)
+		return
+	}
+
+	setExternalStateCookie(c, state, ttl)
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// CallbackHandler completes a sign in or link when the provider redirects back.
+// The result is handed to the UI in the URL fragment: a token pair exactly as
+// returned by password login, a 2FA challenge, or an error.
+func (h *ExternalLoginHandler) CallbackHandler(c *gin.Context) {
+	provider := c.Param("provider")
+	state := c.Query("state")
+
+	cookie, _ := c.Cookie(externalStateCookie)
+	clearExternalStateCookie(c)
+
+	if upstreamError := c.Query("error"); upstreamError != "" {
+		logging.Log.Info("External sign in cancelled at provider", zap.String("provider", provider), zap.String("error", upstreamError))
+		h.recordExternalLogin(c, provider, 0, services.ErrExternalLoginFailed)
+		redirectExternalResult(c, url.Values{"error": {"access_denied"}, "provider": {provider}})
+		return
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) != 1 {
+		logging.Log.Warn("External sign in callback without matching state", zap.String("provider", provider))
+		h.recordExternalLogin(c, provider, 0, services.ErrInvalidExternalState)
+		redirectExternalError(c, provider, services.ErrInvalidExternalState)
+		return
+	}
+
+	result, err := h.externalService.CompleteLogin(c.Request.Context(), provider, state, c.Query("code"))
+	if err != nil {
+		h.recordExternalLogin(c, provider, 0, err)
+		redirectExternalError(c, provider, err)
+		return
+	}
+	if result.Linked {
+		redirectExternalResult(c, url.Values{"linked": {provider}})
+		return
+	}
+
+	user := result.User
+	h.recordExternalLogin(c, provider, user.ID, nil)
+
+	// Accounts with 2FA get a challenge instead of tokens, as with a password login
+	mfaEnabled, err := h.twoFactorService.IsEnabled(c.Request.Context(), user.ID)
+	if err != nil {
+		logging.Log.Error("Failed to check two-factor status", zap.Uint("user_id", user.ID), zap.Error(err))
+		redirectExternalError(c, provider, err)
+		return
+	}
+	if mfaEnabled {
+		challengeToken, challengeExpiresIn, err := h.twoFactorService.CreateChallenge(c.Request.Context(), user)
+		if err != nil {
+			logging.Log.Error("Failed to create login challenge", zap.Uint("user_id", user.ID), zap.Error(err))
+			redirectExternalError(c, provider, err)
+			return
+		}
+		redirectExternalResult(c, url.Values{
+			"mfa_required":    {"true"},
+			"challenge_token": {challengeToken},
+			"expires_in":      {strconv.FormatInt(challengeExpiresIn, 10)},
+			"methods":         {"totp,recovery_code"},
+		})
+		return
+	}
+
+	accessToken, refreshToken, expiresIn, err := h.authService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		logging.Log.Error("Failed to generate tokens", zap.Uint("user_id", user.ID), zap.Error(err))
+		redirectExternalError(c, provider, err)
+		return
+	}
+
+	redirectExternalResult(c, url.Values{
+		"access_token":  {accessToken},
+		"refresh_token": {refreshToken},
+		"token_type":    {"Bearer"},
+		"expires_in":    {strconv.FormatInt(expiresIn, 10)},
+	})
+}
+
+// ListIdentitiesHandler returns the provider identities linked to the current user
+func (h *ExternalLoginHandler) ListIdentitiesHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	identities, err := h.externalService.ListIdentities(c.Request.Context(), userID)
+	if err != nil {
+		logging.Log.Error("Failed to list external identities", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list linked identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// UnlinkHandler removes the current user's identity at a provider
+func (h *ExternalLoginHandler) UnlinkHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.externalService.Unlink(c.Request.Context(), userID, c.Param("provider")); err != nil {
+		respondExternalLoginError(c, "unlink identity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Identity unlinked"})
+}
+
+// GetProviderSettingsHandler returns every provider with its auto-provisioning setting
+func (h *ExternalLoginHandler) GetProviderSettingsHandler(c *gin.Context) {
+	providers, err := h.externalService.ListProviders(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list external providers", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list providers"})
+		return
+	}
+
+	response := make([]AdminExternalProviderResponse, 0, len(providers))
+	for _, provider := range providers {
+		response = append(response, AdminExternalProviderResponse{
+			Name:          provider.Name,
+			DisplayName:   provider.DisplayName,
+			AutoProvision: provider.AutoProvision,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": response})
+}
+
+// SetProviderSettingsHandler turns auto-provisioning on or off for a provider
+func (h *ExternalLoginHandler) SetProviderSettingsHandler(c *gin.Context) {
+	var req SetAutoProvisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	provider := c.Param("provider")
+	if err := h.externalService.SetAutoProvision(c.Request.Context(), provider, *req.AutoProvision, currentAdminID(c)); err != nil {
+		respondExternalLoginError(c, "update provider settings", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, AdminExternalProviderResponse{
+		Name:          provider,
+		AutoProvision: *req.AutoProvision,
+	})
+}
+
+// recordExternalLogin writes an external sign in to the audit log, naming the provider in the reason
+func (h *ExternalLoginHandler) recordExternalLogin(c *gin.Context, provider string, userID uint, err error) {
+	event := services.NewAuthEvent(models.AuthEventExternalLogin, userID, err)
+	if event.Reason != "" {
+		event.Reason = provider + ": " + event.Reason
+	} else {
+		event.Reason = provider
+	}
+	h.authService.RecordEvent(c.Request.Context(), event)
+}
+
+// setExternalStateCookie stores the state of an external sign in in the browser.
+// SameSite=Lax lets it through on the provider's top-level redirect back.
+func setExternalStateCookie(c *gin.Context, state string, ttl time.Duration) {
+	secure := strings.HasPrefix(services.ExternalLoginRedirect(nil), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(externalStateCookie, state, int(ttl.Seconds()), services.ExternalLoginPath(), "", secure, true)
+}
+
+// clearExternalStateCookie removes the state cookie once the callback ran
+func clearExternalStateCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(externalStateCookie, "", -1, services.ExternalLoginPath(), "", false, true)
+}
+
+// redirectExternalResult sends the browser to the UI with the result in the URL fragment
+func redirectExternalResult(c *gin.Context, values url.Values) {
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, services.ExternalLoginRedirect(values))
+}
+
+// redirectExternalError sends the browser to the UI with an error code for a failed callback
+func redirectExternalError(c *gin.Context, provider string, err error) {
+	code := "server_error"
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		code = "unknown_provider"
+	case errors.Is(err, services.ErrInvalidExternalState):
+		code = "invalid_state"
+	case errors.Is(err, services.ErrExternalLoginFailed):
+		code = "login_failed"
+	case errors.Is(err, services.ErrNoLinkedAccount):
+		code = "no_account"
+	case errors.Is(err, services.ErrUserInactive):
+		code = "account_disabled"
+	case errors.Is(err, services.ErrIdentityLinked), errors.Is(err, services.ErrProviderAlreadyLinked):
+		code = "already_linked"
+	default:
+		logging.Log.Error("Failed to complete external sign in", zap.String("provider", provider), zap.Error(err))
+	}
+
+	values := url.Values{"error": {code}, "provider": {provider}}
+	if code != "server_error" {
+		values.Set("error_description", err.Error())
+	}
+	redirectExternalResult(c, values)
+}
+
+// respondExternalLoginError maps external sign in errors to JSON responses
+func respondExternalLoginError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLastLoginMethod):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+	default:
+		logging.Log.Error("Failed to "+action, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Identity headers returned by a successful forward-auth check, for the proxy to pass on to the app
+const (
+	HeaderAuthUserID = "X-Auth-User-Id"
+	HeaderAuthEmail  = "X-Auth-Email"
+	HeaderAuthName   = "X-Auth-Name"
+	HeaderAuthRoles  = "X-Auth-Roles"
+)
+
+// ForwardAuthHandler serves the forward-auth check and its login page
+type ForwardAuthHandler struct {
+	forwardAuth *services.ForwardAuthService
+	oidcService *services.OIDCService
+}
+
+// NewForwardAuthHandler creates a new ForwardAuthHandler. Sign-in goes through
+// the OIDC provider's login, so both pages behave the same.
+func NewForwardAuthHandler(forwardAuth *services.ForwardAuthService, oidcService *services.OIDCService) *ForwardAuthHandler {
+	return &ForwardAuthHandler{
+		forwardAuth: forwardAuth,
+		oidcService: oidcService,
+	}
+}
+
+// VerifyHandler is called by a reverse proxy before it serves a protected app,
+// named by the "app" query parameter. It answers 200 with identity headers,
+// 403 when the user may not use the app, and otherwise 401, or a redirect to
+// the login page for browsers when the proxy sends X-Forwarded-Host.
+func (h *ForwardAuthHandler) VerifyHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	accessToken, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	cookieName, _ := services.ForwardCookie()
+	session, _ := c.Cookie(cookieName)
+
+	identity, err := h.forwardAuth.Verify(c.Request.Context(), c.Query("app"), accessToken, session)
+	switch {
+	case err == nil:
+		c.Header(HeaderAuthUserID, strconv.Itoa(int(identity.User.ID)))
+		c.Header(HeaderAuthEmail, identity.User.Email)
+		c.Header(HeaderAuthName, identity.User.Name)
+		c.Header(HeaderAuthRoles, strings.Join(identity.Roles, ","))
+		c.Status(http.StatusOK)
+	case errors.Is(err, services.ErrForwardAuthRequired):
+		h.signInRequired(c)
+	case errors.Is(err, services.ErrForwardAccessDenied),
+		errors.Is(err, services.ErrForwardUnknownApp):
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrForwardAccessDenied.Error()})
+	default:
+		logging.Log.Error("Forward-auth check failed", zap.String("app", c.Query("app")), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+	}
+}
+
+// LoginPageHandler shows the forward-auth login page, or returns straight to
+// the app if the user is already signed in
+func (h *ForwardAuthHandler) LoginPageHandler(c *gin.Context) {
+	rd := returnURL(c.Query("rd"))
+
+	cookieName, _ := services.ForwardCookie()
+	if session, _ := c.Cookie(cookieName); session != "" && h.forwardAuth.SignedIn(c.Request.Context(), session) {
+		c.Redirect(http.StatusFound, rd)
+		return
+	}
+
+	renderPage(c, http.StatusOK, "login", forwardPage(rd, "Sign in"))
+}
+
+// LoginFormHandler handles the password and 2FA forms of the login page
+func (h *ForwardAuthHandler) LoginFormHandler(c *gin.Context) {
+	rd := returnURL(c.PostForm("rd"))
+
+	var user *models.User
+	var err error
+	switch c.PostForm("action") {
+	case "login":
+		email := c.PostForm("email")
+		var challenge string
+		user, challenge, err = h.oidcService.SignIn(c.Request.Context(), email, c.PostForm("password"))
+		if err != nil {
+			logging.Log.Warn("Forward-auth login failed", zap.String("email", email), zap.Error(err))
+			page := forwardPage(rd, "Sign in")
+			page.Email = email
+			page.Error = loginErrorMessage(err)
+			renderPage(c, http.StatusUnauthorized, "login", page)
+			return
+		}
+		if challenge != "" {
+			page := forwardPage(rd, "Two-factor authentication")
+			page.Challenge = challenge
+			renderPage(c, http.StatusOK, "two_factor", page)
+			return
+		}
+	case "2fa":
+		challenge := c.PostForm("challenge")
+		user, err = h.oidcService.SignInTwoFactor(c.Request.Context(), challenge, c.PostForm("code"))
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			page := forwardPage(rd, "Two-factor authentication")
+			page.Challenge = challenge
+			page.Error = "Invalid code"
+			renderPage(c, http.StatusUnauthorized, "two_factor", page)
+			return
+		}
+		if err != nil {
+			logging.Log.Warn("Forward-auth two-factor login failed", zap.Error(err))
+			page := forwardPage(rd, "Sign in")
+			page.Error = "Your sign-in expired. Please sign in again."
+			renderPage(c, http.StatusUnauthorized, "login", page)
+			return
+		}
+	default:
+		renderPage(c, http.StatusBadRequest, "login", forwardPage(rd, "Sign in"))
+		return
+	}
+
+	session, duration, err := h.forwardAuth.CreateSession(c.Request.Context(), user)
+	if err != nil {
+		logging.Log.Error("Failed to create forward-auth session", zap.Uint("user_id", user.ID), zap.Error(err))
+		page := forwardPage(rd, "Sign in")
+		page.Error = "Sign-in failed. Please try again."
+		renderPage(c, http.StatusInternalServerError, "login", page)
+		return
+	}
+	setForwardCookie(c, session, int(duration.Seconds()))
+
+	logging.Log.Info("Forward-auth login", zap.Uint("user_id", user.ID))
+	c.Redirect(http.StatusSeeOther, rd)
+}
+
+// LogoutHandler signs out the session of the forward-auth cookie, clears the
+// cookie and returns to the "rd" URL, or to the login page. It only accepts
+// POST, and the cookie is not sent along with cross-site POSTs, so other
+// sites cannot sign users out.
+func (h *ForwardAuthHandler) LogoutHandler(c *gin.Context) {
+	cookieName, _ := services.ForwardCookie()
+	if session, _ := c.Cookie(cookieName); session != "" {
+		if err := h.forwardAuth.Logout(c.Request.Context(), session); err != nil {
+			logging.Log.Error("Failed to sign out forward-auth session", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+			return
+		}
+		setForwardCookie(c, "", -1)
+	}
+
+	rd := c.PostForm("rd")
+	if rd == "" {
+		rd = c.Query("rd")
+	}
+	rd, ok := services.SafeRedirect(rd)
+	if !ok {
+		rd = services.ForwardLoginURL()
+	}
+	c.Redirect(http.StatusSeeOther, rd)
+}
+
+// signInRequired answers an unauthenticated check. Browsers behind proxies
+// that follow redirects are sent to the login page; everyone else gets a 401.
+func (h *ForwardAuthHandler) signInRequired(c *gin.Context) {
+	host := c.GetHeader("X-Forwarded-Host")
+	if host != "" && strings.Contains(c.GetHeader("Accept"), "text/html") {
+		proto := c.GetHeader("X-Forwarded-Proto")
+		if proto == "" {
+			proto = "https"
+		}
+		original := proto + "://" + host + c.GetHeader("X-Forwarded-Uri")
+		c.Redirect(http.StatusFound, services.ForwardLoginURL()+"?rd="+url.QueryEscape(original))
+		return
+	}
+
+	c.Header("WWW-Authenticate", `Bearer realm="forward-auth"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in required"})
+}
+
+// forwardPage returns the common data for a page of the forward-auth login
+func forwardPage(rd, title string) oidcPage {
+	name := "your apps"
+	if parsed, err := url.Parse(rd); err == nil && parsed.Host != "" {
+		name = parsed.Host
+	}
+	return oidcPage{
+		Title:      title,
+		Action:     services.ForwardLoginURL(),
+		ClientName: name,
+		Return:     rd,
+	}
+}
+
+// returnURL validates where to send the user after signing in, defaulting to the site root
+func returnURL(rd string) string {
+	if safe, ok := services.SafeRedirect(rd); ok {
+		return safe
+	}
+	return "/"
+}
+
+// setForwardCookie sets or, with a negative maxAge, clears the forward-auth cookie
+func setForwardCookie(c *gin.Context, value string, maxAge int) {
+	name, domain := services.ForwardCookie()
+	secure := strings.HasPrefix(services.ForwardLoginURL(), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/", domain, secure, true)
+}
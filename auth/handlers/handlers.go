@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -30,10 +32,18 @@ type LoginResponse struct {
 
 // UserResponse represents user data in API responses (without sensitive info)
 type UserResponse struct {
-	ID      string `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	IsAdmin bool   `json:"is_admin"`
+	ID    string   `json:"id"`
+	Email string   `json:"email"`
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// LockedUserResponse describes a locked account for admins
+type LockedUserResponse struct {
+	ID                  uint      `json:"id"`
+	Email               string    `json:"email"`
+	FailedLoginAttempts int       `json:"failed_login_attempts"`
+	LockedUntil         time.Time `json:"locked_until"`
 }
 
 // RefreshRequest represents the JSON payload for token refresh requests
@@ -41,15 +51,25 @@ type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// MFARequiredResponse is returned by login when the account has a second factor
+type MFARequiredResponse struct {
+	MFARequired    bool     `json:"mfa_required"`
+	ChallengeToken string   `json:"challenge_token"`
+	ExpiresIn      int64    `json:"expires_in"`
+	Methods        []string `json:"methods"`
+}
+
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	authService *services.AuthService
+	authService      *services.AuthService
+	twoFactorService *services.TwoFactorService
 }
 
 // NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+func NewAuthHandler(authService *services.AuthService, twoFactorService *services.TwoFactorService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:      authService,
+		twoFactorService: twoFactorService,
 	}
 }
 
@@ -70,11 +90,65 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 	// Log the login attempt (without password)
 	logging.Log.Info("Login attempt", zap.String("email", req.Email))
 
-	accessToken, refreshToken, expiresIn, err := h.authService.Login(c.Request.Context(), req.Email, req.Password)
+	user, err := h.authService.Authenticate(c.Request.Context(), req.Email, req.Password)
 	if err != nil {
 		logging.Log.Warn("Login failed", zap.String("email", req.Email), zap.Error(err))
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": err.Error(),
+
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginThrottled(c, throttled)
+		case errors.Is(err, services.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid email or password",
+			})
+		case errors.Is(err, services.ErrUserInactive), errors.Is(err, services.ErrEmailNotVerified):
+			// Only reachable with the correct password
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to log in",
+			})
+		}
+		return
+	}
+
+	// Accounts with 2FA get a challenge instead of tokens
+	mfaEnabled, err := h.twoFactorService.IsEnabled(c.Request.Context(), user.ID)
+	if err != nil {
+		logging.Log.Error("Failed to check two-factor status", zap.Uint("user_id", user.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to log in",
+		})
+		return
+	}
+	if mfaEnabled {
+		challengeToken, challengeExpiresIn, err := h.twoFactorService.CreateChallenge(c.Request.Context(), user)
+		if err != nil {
+			logging.Log.Error("Failed to create login challenge", zap.Uint("user_id", user.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to log in",
+			})
+			return
+		}
+
+		logging.Log.Info("Password accepted, second factor required", zap.String("email", req.Email))
+		c.JSON(http.StatusOK, MFARequiredResponse{
+			MFARequired:    true,
+			ChallengeToken: challengeToken,
+			ExpiresIn:      challengeExpiresIn,
+			Methods:        []string{"totp", "recovery_code"},
+		})
+		return
+	}
+
+	accessToken, refreshToken, expiresIn, err := h.authService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		logging.Log.Error("Failed to generate tokens", zap.String("email", req.Email), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to log in",
 		})
 		return
 	}
@@ -91,11 +165,20 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 	})
 }
 
-// logoutHandler handles user logout and token invalidation
+// respondLoginThrottled answers an attempt made while the account is throttled or locked
+func respondLoginThrottled(c *gin.Context, throttled *services.LoginThrottledError) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": "Too many failed login attempts. Please try again later.",
+	})
+}
+
+// logoutHandler revokes the caller's access token and the refresh tokens of its session
 func (h *AuthHandler) LogoutHandler(c *gin.Context) {
-	// Extract user info from JWT context (set by middleware)
-	userIdStr, exists := c.Get("user_id")
-	if !exists {
+	// Extract claims from JWT context (set by middleware)
+	value, exists := c.Get("claims")
+	claims, ok := value.(*models.JWTClaims)
+	if !exists || !ok {
 		logging.Log.Warn("Logout attempt without valid user context")
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "Invalid authentication context",
@@ -103,11 +186,9 @@ func (h *AuthHandler) LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	userID, _ := strconv.ParseUint(userIdStr.(string), 10, 64)
-	err := h.authService.Logout(c.Request.Context(), uint(userID))
-	if err != nil {
+	if err := h.authService.Logout(c.Request.Context(), claims); err != nil {
 		logging.Log.Error("Failed to logout user",
-			zap.String("user_id", userIdStr.(string)),
+			zap.String("user_id", claims.UserID),
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to logout user",
@@ -115,7 +196,7 @@ func (h *AuthHandler) LogoutHandler(c *gin.Context) {
 		return
 	}
 
-	logging.Log.Info("User logged out successfully", zap.String("user_id", userIdStr.(string)))
+	logging.Log.Info("User logged out successfully", zap.String("user_id", claims.UserID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logged out successfully",
@@ -136,28 +217,25 @@ func (h *AuthHandler) RefreshHandler(c *gin.Context) {
 		return
 	}
 
-	// TODO: Validate refresh token against database
-	user, err := h.authService.ValidateRefreshToken(c.Request.Context(), req.RefreshToken)
+	user, accessToken, refreshToken, expiresIn, err := h.authService.RefreshTokens(c.Request.Context(), req.RefreshToken)
 	if err != nil {
-		logging.Log.Warn("Invalid refresh token", zap.Error(err))
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid or expired refresh token",
-		})
-		return
-	}
-
-	// Generate new access token (optionally new refresh token too)
-	accessToken, refreshToken, expiresIn, err := services.GenerateTokenPair(user)
-	if err != nil {
-		logging.Log.Error("Failed to generate new tokens", zap.Error(err))
+		if errors.Is(err, services.ErrInvalidRefreshToken) ||
+			errors.Is(err, services.ErrRefreshTokenReused) ||
+			errors.Is(err, services.ErrUserInactive) {
+			logging.Log.Warn("Refresh token rejected", zap.Error(err))
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or expired refresh token",
+			})
+			return
+		}
+
+		logging.Log.Error("Failed to refresh tokens", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to refresh authentication tokens",
 		})
 		return
 	}
 
-	// TODO: Update refresh token in database (optional: rotate refresh tokens)
-
 	logging.Log.Info("Tokens refreshed successfully", zap.Uint("user_id", user.ID))
 
 	// Return new tokens
@@ -192,71 +270,103 @@ func (h *AuthHandler) GetUserProfileHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, UserResponse{
-		ID:      userIdStr.(string),
-		Email:   user.Email,
-		Name:    user.Name,
-		IsAdmin: user.IsAdmin,
-	})
+	roles, err := h.authService.GetUserRoles(c.Request.Context(), uint(userID))
+	if err != nil {
+		logging.Log.Error("Failed to fetch user roles",
+			zap.String("user_id", userIdStr.(string)),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch user profile",
+		})
+		return
+	}
+
+	response := newProfileResponse(user, models.RoleNames(roles), "")
+	// Lets the UI show that an admin is looking at the app as this user
+	if claims, ok := c.Value("claims").(*models.JWTClaims); ok && claims.IsImpersonation() {
+		response.ImpersonatedBy = claims.Actor.Email
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// updateUserProfileHandler updates the current user's profile information
-func (h *AuthHandler) UpdateUserProfileHandler(c *gin.Context) {
-	// Extract user info from JWT context (set by middleware)
-	userIdStr, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid authentication context",
+// getPublicKeyHandler provides the current JWT signing key in PEM format.
+// Verifiers should use the JWKS endpoint, which lists every accepted key.
+func (h *AuthHandler) GetPublicKeyHandler(c *gin.Context) {
+	publicKey, err := h.authService.GetPublicKey()
+	if err != nil {
+		logging.Log.Error("Failed to get public key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve public key",
 		})
 		return
 	}
 
-	var userUpdate models.User
-	if err := c.ShouldBindJSON(&userUpdate); err != nil {
-		logging.Log.Warn("Invalid profile update request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid request format",
-			"details": err.Error(),
-		})
+	c.JSON(http.StatusOK, publicKey)
+}
+
+// JWKSHandler serves every public key that verifies tokens issued by this service
+func (h *AuthHandler) JWKSHandler(c *gin.Context) {
+	keySet, err := h.authService.JWKS()
+	if err != nil {
+		logging.Log.Error("Failed to build JWKS", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve signing keys"})
 		return
 	}
+	c.JSON(http.StatusOK, keySet)
+}
 
-	userID, _ := strconv.ParseUint(userIdStr.(string), 10, 64)
-	userUpdate.ID = uint(userID)
+// RevocationsHandler serves the revocation list that the gateway polls.
+// It is registered outside the API base URL so the gateway never proxies it,
+// and requires a service token with the revocations:read scope.
+func (h *AuthHandler) RevocationsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authService.RevocationSnapshot())
+}
 
-	if err := h.authService.UpdateUserProfile(c.Request.Context(), &userUpdate); err != nil {
-		logging.Log.Error("Failed to update user profile",
-			zap.String("user_id", userIdStr.(string)),
-			zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update user profile",
-		})
+// GetLockedUsersHandler lists accounts that are locked after failed logins
+func (h *AuthHandler) GetLockedUsersHandler(c *gin.Context) {
+	users, err := h.authService.GetLockedUsers(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to get locked users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get locked users"})
 		return
 	}
 
-	c.JSON(http.StatusOK, UserResponse{
-		ID:      userIdStr.(string),
-		Email:   userUpdate.Email,
-		Name:    userUpdate.Name,
-		IsAdmin: userUpdate.IsAdmin,
+	locked := make([]LockedUserResponse, 0, len(users))
+	for _, user := range users {
+		locked = append(locked, LockedUserResponse{
+			ID:                  user.ID,
+			Email:               user.Email,
+			FailedLoginAttempts: user.FailedLoginAttempts,
+			LockedUntil:         *user.LockedUntil,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locked_users": locked,
 	})
 }
 
-// getPublicKeyHandler provides the JWT public key for token validation
-func (h *AuthHandler) GetPublicKeyHandler(c *gin.Context) {
-	publicKeyPEM, err := h.authService.GetPublicKeyPEM(c.Request.Context())
+// UnlockUserHandler clears a user's lockout and failed login counter
+func (h *AuthHandler) UnlockUserHandler(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		logging.Log.Error("Failed to get public key", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve public key",
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	adminID, _ := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+
+	if err := h.authService.UnlockUser(c.Request.Context(), uint(targetID), uint(adminID)); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		logging.Log.Error("Failed to unlock user", zap.Uint64("user_id", targetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"public_key": publicKeyPEM,
-		"algorithm":  "RS256",
-		"key_type":   "RSA",
+		"message": "User unlocked",
 	})
 }
 
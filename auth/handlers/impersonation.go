@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// StartImpersonationRequest represents the JSON payload for starting to act as a user
+type StartImpersonationRequest struct {
+	Reason          string `json:"reason" binding:"required,max=255"`          // recorded in the audit log
+	DurationMinutes int    `json:"duration_minutes" binding:"omitempty,min=1"` // capped at the configured maximum
+}
+
+// ImpersonationResponse carries the token an admin uses to act as a user
+type ImpersonationResponse struct {
+	AccessToken string       `json:"access_token"`
+	TokenType   string       `json:"token_type"`
+	ExpiresIn   int64        `json:"expires_in"`
+	User        UserResponse `json:"user"`
+	ActorID     string       `json:"actor_id"`
+}
+
+// ImpersonationHandler handles admins acting as other users
+type ImpersonationHandler struct {
+	impersonationService *services.ImpersonationService
+}
+
+// NewImpersonationHandler creates a new ImpersonationHandler
+func NewImpersonationHandler(impersonationService *services.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+	}
+}
+
+// StartHandler issues a short-lived token for the admin to act as the user.
+// The admin keeps their own tokens and goes back to them when done.
+func (h *ImpersonationHandler) StartHandler(c *gin.Context) {
+	targetID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	claims, _ := c.Value("claims").(*models.JWTClaims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+		return
+	}
+
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	token, err := h.impersonationService.Start(c.Request.Context(), claims, targetID, duration, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrUserInactive),
+			errors.Is(err, services.ErrCannotImpersonateSelf),
+			errors.Is(err, services.ErrAlreadyImpersonating):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrCannotImpersonateAdmin):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			logging.Log.Error("Failed to start impersonation", zap.Uint("user_id", targetID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ImpersonationResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.ExpiresIn,
+		User: UserResponse{
+			ID:    strconv.Itoa(int(token.User.ID)),
+			Email: token.User.Email,
+			Name:  token.User.Name,
+			Roles: token.Roles,
+		},
+		ActorID: claims.UserID,
+	})
+}
+
+// EndHandler revokes the impersonation token the request was made with
+func (h *ImpersonationHandler) EndHandler(c *gin.Context) {
+	claims, _ := c.Value("claims").(*models.JWTClaims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+		return
+	}
+
+	if err := h.impersonationService.End(c.Request.Context(), claims); err != nil {
+		if errors.Is(err, services.ErrNotImpersonating) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logging.Log.Error("Failed to end impersonation", zap.String("user_id", claims.UserID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// IntrospectRequest holds the parameters of an introspection request (RFC 7662)
+type IntrospectRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint"` // accepted and ignored; only access tokens can be introspected
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectHandler tells service accounts whether a token is active and what it grants
+func (h *OIDCHandler) IntrospectHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req IntrospectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	// client_secret_basic: the credentials are form encoded before base64
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = formDecode(id)
+		req.ClientSecret = formDecode(secret)
+	}
+
+	result, err := h.oidcService.Introspect(c.Request.Context(), req.ClientID, req.ClientSecret, req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthInvalidClient) {
+			c.Header("WWW-Authenticate", `Basic realm="introspect"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": services.ErrOAuthInvalidClient.Code})
+			return
+		}
+		logging.Log.Error("Token introspection failed", zap.String("client_id", req.ClientID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CurrentUserInfoHandler returns claims about the user the bearer token was issued to
+func (h *OIDCHandler) CurrentUserInfoHandler(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		c.Header("WWW-Authenticate", `Bearer`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		return
+	}
+
+	claims, err := h.oidcService.CurrentUserInfo(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthInvalidToken) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		logging.Log.Error("Userinfo request failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user info"})
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// InviteRequest represents the JSON payload for creating an invitation. Only
+// email is bound to a single person; without it anyone with the code can redeem it.
+type InviteRequest struct {
+	Email     string     `json:"email" binding:"omitempty,email"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses" binding:"omitempty,min=1,max=100"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// InviteLookupRequest represents the JSON payload for checking an invite code
+type InviteLookupRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// InvitationResponse describes an invitation to admins
+type InvitationResponse struct {
+	ID        uint       `json:"id"`
+	Email     string     `json:"email,omitempty"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	Status    string     `json:"status"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateInviteHandler issues an invitation with a role, expiry and number of uses.
+// The code and link are only returned here.
+func (h *RegistrationHandler) CreateInviteHandler(c *gin.Context) {
+	var req InviteRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	input := services.InvitationInput{
+		Email:   req.Email,
+		Role:    req.Role,
+		MaxUses: req.MaxUses,
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		input.ExpiresAt = *req.ExpiresAt
+	}
+
+	created, err := h.registrationService.CreateInvitation(c.Request.Context(), input, currentAdminID(c))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logging.Log.Error("Failed to create invite", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"invitation":  newInvitationResponse(created.Invitation),
+		"invite_code": created.Code,
+		"link":        created.Link,
+	})
+}
+
+// ListInvitesHandler returns invitations, newest first. Only redeemable ones are
+// listed unless all=true.
+func (h *RegistrationHandler) ListInvitesHandler(c *gin.Context) {
+	includeInactive := c.Query("all") == "true"
+
+	invitations, err := h.registrationService.ListInvitations(c.Request.Context(), includeInactive)
+	if err != nil {
+		logging.Log.Error("Failed to list invites", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+		return
+	}
+
+	response := make([]InvitationResponse, 0, len(invitations))
+	for i := range invitations {
+		response = append(response, newInvitationResponse(&invitations[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": response})
+}
+
+// RevokeInviteHandler stops an invitation from being redeemed
+func (h *RegistrationHandler) RevokeInviteHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	if err := h.registrationService.RevokeInvitation(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, services.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		logging.Log.Error("Failed to revoke invite", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// LookupInviteHandler tells the sign up page which address and role an invite
+// code is for. The code is sent in the body so that it stays out of request logs.
+func (h *RegistrationHandler) LookupInviteHandler(c *gin.Context) {
+	var req InviteLookupRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	invitation, err := h.registrationService.LookupInvitation(c.Request.Context(), req.Code, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts. Please try again later."})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidInvite) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invite code"})
+			return
+		}
+		logging.Log.Error("Failed to look up invite", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"role":       invitation.Role.Name,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// newInvitationResponse converts an invitation for admin responses
+func newInvitationResponse(invitation *models.Invitation) InvitationResponse {
+	return InvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role.Name,
+		MaxUses:   invitation.MaxUses,
+		Uses:      invitation.Uses,
+		Status:    invitation.Status(time.Now()),
+		ExpiresAt: invitation.ExpiresAt,
+		RevokedAt: invitation.RevokedAt,
+		CreatedBy: invitation.CreatedBy,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// magicLinkNonceCookie binds a sign-in link to the browser that asked for it
+const magicLinkNonceCookie = "magic_link_nonce"
+
+// MagicLinkRequest represents the JSON payload for requesting a sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// MagicLinkRoleResponse describes whether a role's users may sign in with emailed links
+type MagicLinkRoleResponse struct {
+	Role    string `json:"role"`
+	Enabled bool   `json:"enabled"`
+}
+
+// SetMagicLinkRoleRequest represents the JSON payload for turning magic links on or off for a role
+type SetMagicLinkRoleRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// MagicLinkHandler handles passwordless sign in with emailed links
+type MagicLinkHandler struct {
+	magicLinkService *services.MagicLinkService
+	authService      *services.AuthService
+	twoFactorService *services.TwoFactorService
+}
+
+// NewMagicLinkHandler creates a new MagicLinkHandler
+func NewMagicLinkHandler(magicLinkService *services.MagicLinkService, authService *services.AuthService, twoFactorService *services.TwoFactorService) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+	}
+}
+
+// RequestLinkHandler emails a sign-in link if the account may use one, and
+// stores the nonce the link is bound to in the browser
+func (h *MagicLinkHandler) RequestLinkHandler(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	nonce, ttl, err := h.magicLinkService.RequestLink(c.Request.Context(), req.Email, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many sign-in link requests. Please try again later.",
+			})
+			return
+		}
+		logging.Log.Error("Failed to process magic link request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to process sign-in link request",
+		})
+		return
+	}
+	setMagicLinkNonceCookie(c, nonce, ttl)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If this account can sign in by email, a sign-in link has been sent.",
+	})
+}
+
+// CallbackHandler signs the user in when they open the emailed link. The result
+// is handed to the UI in the URL fragment: a token pair exactly as returned by
+// password login, a 2FA challenge, or an error.
+func (h *MagicLinkHandler) CallbackHandler(c *gin.Context) {
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+
+	user, err := h.magicLinkService.CompleteLogin(c.Request.Context(), c.Query("token"), nonce)
+	if err != nil {
+		redirectMagicLinkError(c, err)
+		return
+	}
+	clearMagicLinkNonceCookie(c)
+
+	// Accounts with 2FA get a challenge instead of tokens, as with a password login
+	mfaEnabled, err := h.twoFactorService.IsEnabled(c.Request.Context(), user.ID)
+	if err != nil {
+		logging.Log.Error("Failed to check two-factor status", zap.Uint("user_id", user.ID), zap.Error(err))
+		redirectMagicLinkError(c, err)
+		return
+	}
+	if mfaEnabled {
+		challengeToken, challengeExpiresIn, err := h.twoFactorService.CreateChallenge(c.Request.Context(), user)
+		if err != nil {
+			logging.Log.Error("Failed to create login challenge", zap.Uint("user_id", user.ID), zap.Error(err))
+			redirectMagicLinkError(c, err)
+			return
+		}
+		redirectMagicLinkResult(c, url.Values{
+			"mfa_required":    {"true"},
+			"challenge_token": {challengeToken},
+			"expires_in":      {strconv.FormatInt(challengeExpiresIn, 10)},
+			"methods":         {"totp,recovery_code"},
+		})
+		return
+	}
+
+	accessToken, refreshToken, expiresIn, err := h.authService.GenerateTokenPair(c.Request.Context(), user)
+	if err != nil {
+		logging.Log.Error("Failed to generate tokens", zap.Uint("user_id", user.ID), zap.Error(err))
+		redirectMagicLinkError(c, err)
+		return
+	}
+
+	logging.Log.Info("User logged in with magic link", zap.Uint("user_id", user.ID))
+	redirectMagicLinkResult(c, url.Values{
+		"access_token":  {accessToken},
+		"refresh_token": {refreshToken},
+		"token_type":    {"Bearer"},
+		"expires_in":    {strconv.FormatInt(expiresIn, 10)},
+	})
+}
+
+// GetRoleSettingsHandler lists which roles may sign in with emailed links
+func (h *MagicLinkHandler) GetRoleSettingsHandler(c *gin.Context) {
+	roles, err := h.magicLinkService.ListRoles(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list magic link settings", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list magic link settings"})
+		return
+	}
+
+	response := make([]MagicLinkRoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, MagicLinkRoleResponse{Role: role.Role, Enabled: role.Enabled})
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": response})
+}
+
+// SetRoleSettingsHandler turns magic link sign in on or off for a role
+func (h *MagicLinkHandler) SetRoleSettingsHandler(c *gin.Context) {
+	var req SetMagicLinkRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	role := c.Param("role")
+	if err := h.magicLinkService.SetRoleEnabled(c.Request.Context(), role, *req.Enabled, currentAdminID(c)); err != nil {
+		if errors.Is(err, services.ErrUnknownRole) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logging.Log.Error("Failed to update magic link settings", zap.String("role", role), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update magic link settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MagicLinkRoleResponse{Role: role, Enabled: *req.Enabled})
+}
+
+// setMagicLinkNonceCookie stores the nonce of a sign-in link in the browser.
+// SameSite=Lax lets it through when the link is opened from an email.
+func setMagicLinkNonceCookie(c *gin.Context, nonce string, ttl time.Duration) {
+	secure := strings.HasPrefix(services.MagicLinkRedirect(nil), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkNonceCookie, nonce, int(ttl.Seconds()), services.MagicLinkPath(), "", secure, true)
+}
+
+// clearMagicLinkNonceCookie removes the nonce cookie once its link was used
+func clearMagicLinkNonceCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(magicLinkNonceCookie, "", -1, services.MagicLinkPath(), "", false, true)
+}
+
+// redirectMagicLinkResult sends the browser to the UI with the result in the URL fragment
+func redirectMagicLinkResult(c *gin.Context, values url.Values) {
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, services.MagicLinkRedirect(values))
+}
+
+// redirectMagicLinkError sends the browser to the UI with an error code for a failed sign in
+func redirectMagicLinkError(c *gin.Context, err error) {
+	code := "server_error"
+	switch {
+	case errors.Is(err, services.ErrInvalidMagicLink):
+		code = "invalid_link"
+	case errors.Is(err, services.ErrMagicLinkOtherBrowser):
+		code = "other_browser"
+	case errors.Is(err, services.ErrUserInactive):
+		code = "account_disabled"
+	default:
+		logging.Log.Error("Failed to complete magic link sign in", zap.Error(err))
+	}
+
+	values := url.Values{"error": {code}}
+	if code != "server_error" {
+		values.Set("error_description", err.Error())
+	}
+	redirectMagicLinkResult(c, values)
+}
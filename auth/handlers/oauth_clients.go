@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// CreateOAuthClientRequest represents the JSON payload for registering an OIDC client
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+	SkipConsent  bool     `json:"skip_consent"`
+}
+
+// UpdateOAuthClientRequest represents the JSON payload for updating an OIDC client.
+// Omitted fields are left unchanged.
+type UpdateOAuthClientRequest struct {
+	Name         *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	RedirectURIs *[]string `json:"redirect_uris"`
+	Scopes       *[]string `json:"scopes"`
+	SkipConsent  *bool     `json:"skip_consent"`
+}
+
+// OAuthClientResponse represents an OIDC client as seen by admins. The secret
+// is only included when it was just created or rotated.
+type OAuthClientResponse struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	SkipConsent  bool      `json:"skip_consent"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// OAuthClientHandler handles admin management of OIDC clients
+type OAuthClientHandler struct {
+	clientService *services.OAuthClientService
+}
+
+// NewOAuthClientHandler creates a new OAuthClientHandler
+func NewOAuthClientHandler(clientService *services.OAuthClientService) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		clientService: clientService,
+	}
+}
+
+// ListClientsHandler returns every registered client
+func (h *OAuthClientHandler) ListClientsHandler(c *gin.Context) {
+	clients, err := h.clientService.ListClients(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list OIDC clients", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list clients"})
+		return
+	}
+
+	response := make([]OAuthClientResponse, 0, len(clients))
+	for i := range clients {
+		response = append(response, newOAuthClientResponse(&clients[i], ""))
+	}
+	c.JSON(http.StatusOK, gin.H{"clients": response})
+}
+
+// GetClientHandler returns a single client
+func (h *OAuthClientHandler) GetClientHandler(c *gin.Context) {
+	id, ok := clientIDParam(c)
+	if !ok {
+		return
+	}
+
+	client, err := h.clientService.GetClient(c.Request.Context(), id)
+	if err != nil {
+		respondOAuthClientError(c, "get client", err)
+		return
+	}
+	c.JSON(http.StatusOK, newOAuthClientResponse(client, ""))
+}
+
+// CreateClientHandler registers a client and returns its secret once
+func (h *OAuthClientHandler) CreateClientHandler(c *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	client, secret, err := h.clientService.CreateClient(c.Request.Context(), services.OAuthClientInput{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		Public:       req.Public,
+		SkipConsent:  req.SkipConsent,
+	}, currentAdminID(c))
+	if err != nil {
+		respondOAuthClientError(c, "create client", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newOAuthClientResponse(client, secret))
+}
+
+// UpdateClientHandler changes a client's name, redirect URIs, scopes or consent setting
+func (h *OAuthClientHandler) UpdateClientHandler(c *gin.Context) {
+	id, ok := clientIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	client, err := h.clientService.UpdateClient(c.Request.Context(), id, services.UpdateOAuthClientInput{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		SkipConsent:  req.SkipConsent,
+	}, currentAdminID(c))
+	if err != nil {
+		respondOAuthClientError(c, "update client", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newOAuthClientResponse(client, ""))
+}
+
+// RotateSecretHandler issues a new secret for a confidential client
+func (h *OAuthClientHandler) RotateSecretHandler(c *gin.Context) {
+	id, ok := clientIDParam(c)
+	if !ok {
+		return
+	}
+
+	client, secret, err := h.clientService.RotateSecret(c.Request.Context(), id, currentAdminID(c))
+	if err != nil {
+		respondOAuthClientError(c, "rotate client secret", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newOAuthClientResponse(client, secret))
+}
+
+// DeleteClientHandler removes a client and revokes its tokens
+func (h *OAuthClientHandler) DeleteClientHandler(c *gin.Context) {
+	id, ok := clientIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.clientService.DeleteClient(c.Request.Context(), id, currentAdminID(c)); err != nil {
+		respondOAuthClientError(c, "delete client", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Client deleted"})
+}
+
+// newOAuthClientResponse converts a client for admin responses
+func newOAuthClientResponse(client *models.OAuthClient, secret string) OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:           client.ID,
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIList(),
+		Scopes:       strings.Fields(client.Scopes),
+		Public:       client.Public,
+		SkipConsent:  client.SkipConsent,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// clientIDParam parses the :id path parameter, writing a 400 response if it is invalid
+func clientIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondOAuthClientError maps client management errors to HTTP responses
+func respondOAuthClientError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+	case errors.Is(err, services.ErrInvalidRedirectURIs),
+		errors.Is(err, services.ErrRedirectURIsRequired),
+		errors.Is(err, services.ErrUnsupportedScope),
+		errors.Is(err, services.ErrPublicClientSecret):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logging.Log.Error("Failed to "+action, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
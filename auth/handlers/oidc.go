@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// oidcSessionCookie holds the provider's sign-in session
+const oidcSessionCookie = "oidc_session"
+
+//go:embed templates/oidc.html
+var templatesFS embed.FS
+
+var oidcTemplates = template.Must(template.ParseFS(templatesFS, "templates/oidc.html"))
+
+// scopeDescriptions are shown on the consent page
+var scopeDescriptions = map[string]string{
+	models.ScopeOpenID:        "Know who you are",
+	models.ScopeProfile:       "See your name",
+	models.ScopeEmail:         "See your email address",
+	models.ScopeRoles:         "See your roles on this server",
+	models.ScopeOfflineAccess: "Stay signed in when you are not using it",
+}
+
+// oidcPage is the data rendered by the provider's HTML pages
+type oidcPage struct {
+	Title      string
+	Error      string
+	Action     string
+	ClientName string
+	Params     services.AuthorizeRequest
+	Return     string // forward-auth return URL, sent instead of Params
+	Email      string
+	Challenge  string
+	CSRF       string
+	Scopes     []string
+}
+
+// ConsentResponse describes an application the user has approved
+type ConsentResponse struct {
+	ClientID  string    `json:"client_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// OIDCHandler serves the OpenID Connect provider endpoints
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDCHandler
+func NewOIDCHandler(oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// DiscoveryHandler serves the provider metadata
+func (h *OIDCHandler) DiscoveryHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oidcService.Discovery())
+}
+
+// JWKSHandler serves the public signing keys
+func (h *OIDCHandler) JWKSHandler(c *gin.Context) {
+	jwks, err := h.oidcService.JWKS()
+	if err != nil {
+		logging.Log.Error("Failed to build JWKS", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve signing keys"})
+		return
+	}
+	c.JSON(http.StatusOK, jwks)
+}
+
+// AuthorizeHandler starts an authorization code flow. Signed-in users who have
+// already approved the client are sent straight back with a code.
+func (h *OIDCHandler) AuthorizeHandler(c *gin.Context) {
+	var req services.AuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		h.renderError(c)
+		return
+	}
+
+	auth, ok := h.validateRequest(c, req)
+	if !ok {
+		return
+	}
+
+	user, authTime, err := h.oidcService.ResolveSession(c.Request.Context(), h.sessionCookie(c))
+	if err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+	if auth.HasPrompt("login") {
+		user = nil
+	}
+
+	if user == nil {
+		if auth.HasPrompt("none") {
+			h.redirectError(c, auth, services.ErrOAuthLoginRequired)
+			return
+		}
+		renderPage(c, http.StatusOK, "login", h.page(auth, "Sign in"))
+		return
+	}
+
+	h.continueAuthorization(c, auth, user, authTime)
+}
+
+// AuthorizeFormHandler handles the login, 2FA and consent forms of the authorization flow
+func (h *OIDCHandler) AuthorizeFormHandler(c *gin.Context) {
+	var req services.AuthorizeRequest
+	if err := c.ShouldBind(&req); err != nil {
+		h.renderError(c)
+		return
+	}
+
+	auth, ok := h.validateRequest(c, req)
+	if !ok {
+		return
+	}
+
+	switch c.PostForm("action") {
+	case "login":
+		h.handleLogin(c, auth)
+	case "2fa":
+		h.handleTwoFactor(c, auth)
+	case "consent":
+		h.handleConsent(c, auth)
+	default:
+		renderPage(c, http.StatusBadRequest, "login", h.page(auth, "Sign in"))
+	}
+}
+
+// handleLogin checks the password form and signs the user in
+func (h *OIDCHandler) handleLogin(c *gin.Context, auth *services.Authorization) {
+	email := c.PostForm("email")
+	user, challenge, err := h.oidcService.SignIn(c.Request.Context(), email, c.PostForm("password"))
+	if err != nil {
+		logging.Log.Warn("OIDC login failed", zap.String("email", email), zap.Error(err))
+		page := h.page(auth, "Sign in")
+		page.Email = email
+		page.Error = loginErrorMessage(err)
+		renderPage(c, http.StatusUnauthorized, "login", page)
+		return
+	}
+
+	if challenge != "" {
+		page := h.page(auth, "Two-factor authentication")
+		page.Challenge = challenge
+		renderPage(c, http.StatusOK, "two_factor", page)
+		return
+	}
+
+	h.signedIn(c, auth, user)
+}
+
+// handleTwoFactor checks the second factor of a login
+func (h *OIDCHandler) handleTwoFactor(c *gin.Context, auth *services.Authorization) {
+	challenge := c.PostForm("challenge")
+	user, err := h.oidcService.SignInTwoFactor(c.Request.Context(), challenge, c.PostForm("code"))
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.Is(err, services.ErrInvalidTwoFactorCode):
+			page := h.page(auth, "Two-factor authentication")
+			page.Challenge = challenge
+			page.Error = "Invalid code"
+			renderPage(c, http.StatusUnauthorized, "two_factor", page)
+			return
+		case errors.As(err, &throttled):
+			page := h.page(auth, "Two-factor authentication")
+			page.Challenge = challenge
+			page.Error = loginErrorMessage(err)
+			renderPage(c, http.StatusUnauthorized, "two_factor", page)
+			return
+		}
+		logging.Log.Warn("OIDC two-factor login failed", zap.Error(err))
+		page := h.page(auth, "Sign in")
+		page.Error = "Your sign-in expired. Please sign in again."
+		renderPage(c, http.StatusUnauthorized, "login", page)
+		return
+	}
+
+	h.signedIn(c, auth, user)
+}
+
+// handleConsent records the user's decision on the consent page
+func (h *OIDCHandler) handleConsent(c *gin.Context, auth *services.Authorization) {
+	session := h.sessionCookie(c)
+	user, authTime, err := h.oidcService.ResolveSession(c.Request.Context(), session)
+	if err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+	if user == nil || subtle.ConstantTimeCompare([]byte(c.PostForm("csrf")), []byte(csrfToken(session))) != 1 {
+		page := h.page(auth, "Sign in")
+		page.Error = "Your sign-in expired. Please sign in again."
+		renderPage(c, http.StatusUnauthorized, "login", page)
+		return
+	}
+
+	if c.PostForm("decision") != "allow" {
+		logging.Log.Info("OIDC consent denied", zap.Uint("user_id", user.ID), zap.String("client_id", auth.Client.ClientID))
+		h.redirectError(c, auth, services.ErrOAuthAccessDenied)
+		return
+	}
+
+	if err := h.oidcService.GrantConsent(c.Request.Context(), user.ID, auth); err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+	h.issueCode(c, auth, user, authTime)
+}
+
+// signedIn starts a provider session for a user who just logged in and continues the flow
+func (h *OIDCHandler) signedIn(c *gin.Context, auth *services.Authorization, user *models.User) {
+	session, duration, err := h.oidcService.CreateSession(user)
+	if err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+
+	secure := strings.HasPrefix(services.Issuer(), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcSessionCookie, session, int(duration.Seconds()), issuerPath(), "", secure, true)
+
+	// The consent form is checked against the new session
+	c.Request.AddCookie(&http.Cookie{Name: oidcSessionCookie, Value: session})
+
+	logging.Log.Info("OIDC provider login", zap.Uint("user_id", user.ID), zap.String("client_id", auth.Client.ClientID))
+	h.continueAuthorization(c, auth, user, time.Now())
+}
+
+// continueAuthorization asks for consent if needed, then returns a code to the client
+func (h *OIDCHandler) continueAuthorization(c *gin.Context, auth *services.Authorization, user *models.User, authTime time.Time) {
+	needsConsent, err := h.oidcService.NeedsConsent(c.Request.Context(), user.ID, auth)
+	if err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+
+	if needsConsent {
+		if auth.HasPrompt("none") {
+			h.redirectError(c, auth, services.ErrOAuthConsentRequired)
+			return
+		}
+		page := h.page(auth, "Authorize "+auth.Client.Name)
+		page.Email = user.Email
+		page.CSRF = csrfToken(h.sessionCookie(c))
+		for _, scope := range auth.Scopes {
+			page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+		}
+		renderPage(c, http.StatusOK, "consent", page)
+		return
+	}
+
+	h.issueCode(c, auth, user, authTime)
+}
+
+// issueCode redirects back to the client with an authorization code
+func (h *OIDCHandler) issueCode(c *gin.Context, auth *services.Authorization, user *models.User, authTime time.Time) {
+	redirect, err := h.oidcService.IssueCode(c.Request.Context(), user, auth, authTime)
+	if err != nil {
+		h.redirectError(c, auth, err)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, redirect)
+}
+
+// TokenHandler exchanges authorization codes and refresh tokens for tokens
+func (h *OIDCHandler) TokenHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req services.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	// client_secret_basic: the credentials are form encoded before base64
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = formDecode(id)
+		req.ClientSecret = formDecode(secret)
+	}
+
+	response, err := h.oidcService.Exchange(c.Request.Context(), req)
+	if err != nil {
+		var oauthErr *services.OAuthError
+		if !errors.As(err, &oauthErr) {
+			logging.Log.Error("OIDC token request failed", zap.String("client_id", req.ClientID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		status := http.StatusBadRequest
+		if oauthErr.Code == services.ErrOAuthInvalidClient.Code {
+			status = http.StatusUnauthorized
+			c.Header("WWW-Authenticate", `Basic realm="oidc"`)
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UserInfoHandler returns claims about the user the access token was issued for
+func (h *OIDCHandler) UserInfoHandler(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	claims, err := h.oidcService.UserInfo(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrOAuthInvalidToken) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token"})
+			return
+		}
+		logging.Log.Error("OIDC userinfo failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
+
+// ListConsentsHandler returns the applications the current user has approved
+func (h *OIDCHandler) ListConsentsHandler(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+
+	consents, err := h.oidcService.ListConsents(c.Request.Context(), uint(userID))
+	if err != nil {
+		logging.Log.Error("Failed to list consents", zap.Uint64("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list connected apps"})
+		return
+	}
+
+	response := make([]ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		response = append(response, ConsentResponse{
+			ClientID:  consent.ClientID,
+			Name:      h.oidcService.ClientName(c.Request.Context(), consent.ClientID),
+			Scopes:    strings.Fields(consent.Scopes),
+			GrantedAt: consent.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consents": response})
+}
+
+// RevokeConsentHandler disconnects an application from the current user's account
+func (h *OIDCHandler) RevokeConsentHandler(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+
+	if err := h.oidcService.RevokeConsent(c.Request.Context(), uint(userID), c.Param("client_id")); err != nil {
+		if errors.Is(err, services.ErrClientNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Connected app not found"})
+			return
+		}
+		logging.Log.Error("Failed to revoke consent", zap.Uint64("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disconnect app"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "App disconnected"})
+}
+
+// validateRequest validates an authorization request, rendering an error page
+// or redirecting back to the client if it is invalid
+func (h *OIDCHandler) validateRequest(c *gin.Context, req services.AuthorizeRequest) (*services.Authorization, bool) {
+	auth, err := h.oidcService.ValidateAuthorizeRequest(c.Request.Context(), req)
+	if err == nil {
+		return auth, true
+	}
+
+	if auth == nil {
+		if !errors.Is(err, services.ErrUnknownClient) && !errors.Is(err, services.ErrInvalidRedirectURI) {
+			logging.Log.Error("Failed to validate authorization request", zap.Error(err))
+		}
+		h.renderError(c)
+		return nil, false
+	}
+
+	h.redirectError(c, auth, err)
+	return nil, false
+}
+
+// redirectError reports an error to the client's redirect URI
+func (h *OIDCHandler) redirectError(c *gin.Context, auth *services.Authorization, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logging.Log.Error("OIDC authorization failed", zap.String("client_id", auth.Client.ClientID), zap.Error(err))
+	}
+	c.Redirect(http.StatusSeeOther, h.oidcService.ErrorRedirect(auth, err))
+}
+
+// page returns the common data for a page of the authorization flow
+func (h *OIDCHandler) page(auth *services.Authorization, title string) oidcPage {
+	return oidcPage{
+		Title:      title,
+		Action:     issuerPath() + "/authorize",
+		ClientName: auth.Client.Name,
+		Params:     auth.Request,
+	}
+}
+
+// renderError shows an error page for requests that cannot be redirected
+func (h *OIDCHandler) renderError(c *gin.Context) {
+	renderPage(c, http.StatusBadRequest, "error", oidcPage{Title: "Invalid request"})
+}
+
+// renderPage writes one of the provider's HTML pages
+func renderPage(c *gin.Context, status int, name string, page oidcPage) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := oidcTemplates.ExecuteTemplate(c.Writer, name, page); err != nil {
+		logging.Log.Error("Failed to render OIDC page", zap.String("page", name), zap.Error(err))
+	}
+}
+
+// sessionCookie returns the provider session cookie, if any
+func (h *OIDCHandler) sessionCookie(c *gin.Context) string {
+	session, _ := c.Cookie(oidcSessionCookie)
+	return session
+}
+
+// loginErrorMessage returns the message shown on the login form for an error
+func loginErrorMessage(err error) string {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		return "Too many failed login attempts. Please try again later."
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return "Invalid email or password"
+	case errors.Is(err, services.ErrUserInactive), errors.Is(err, services.ErrEmailNotVerified):
+		return err.Error()
+	default:
+		return "Sign-in failed. Please try again."
+	}
+}
+
+// csrfToken derives the consent form token from the session cookie, so only
+// pages rendered for that session can submit a decision
+func csrfToken(session string) string {
+	if session == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte("oidc-consent:" + session))
+	return hex.EncodeToString(sum[:])
+}
+
+// issuerPath returns the path component of the issuer URL, where the
+// provider's endpoints and cookie live
+func issuerPath() string {
+	parsed, err := url.Parse(services.Issuer())
+	if err != nil {
+		return "/"
+	}
+	return parsed.Path
+}
+
+// formDecode undoes the form encoding of client credentials sent with HTTP Basic
+func formDecode(value string) string {
+	decoded, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
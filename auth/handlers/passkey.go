@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// FinishPasskeyRegistrationRequest represents the JSON payload completing a passkey registration.
+// Credential is the PublicKeyCredential returned by navigator.credentials.create, serialized as JSON.
+type FinishPasskeyRegistrationRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Name       string          `json:"name" binding:"max=100"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// FinishPasskeyLoginRequest represents the JSON payload completing a passkey login.
+// Credential is the PublicKeyCredential returned by navigator.credentials.get, serialized as JSON.
+type FinishPasskeyLoginRequest struct {
+	SessionID  string          `json:"session_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// PasskeyHandler handles passkey registration, management and login
+type PasskeyHandler struct {
+	passkeyService *services.PasskeyService
+}
+
+// NewPasskeyHandler creates a new PasskeyHandler
+func NewPasskeyHandler(passkeyService *services.PasskeyService) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyService: passkeyService,
+	}
+}
+
+// BeginRegistrationHandler returns the options for creating a passkey for the current user
+func (h *PasskeyHandler) BeginRegistrationHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID, options, err := h.passkeyService.BeginRegistration(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserInactive) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+			return
+		}
+		logging.Log.Error("Failed to begin passkey registration", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishRegistrationHandler verifies and stores a new passkey for the current user
+func (h *PasskeyHandler) FinishRegistrationHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req FinishPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	passkey, err := h.passkeyService.FinishRegistration(c.Request.Context(), userID, req.SessionID, req.Name, req.Credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPasskeySession), errors.Is(err, services.ErrPasskeyRejected):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserInactive):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+		default:
+			logging.Log.Error("Failed to finish passkey registration", zap.Uint("user_id", userID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register passkey"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// ListHandler returns the current user's passkeys
+func (h *PasskeyHandler) ListHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	passkeys, err := h.passkeyService.List(c.Request.Context(), userID)
+	if err != nil {
+		logging.Log.Error("Failed to list passkeys", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passkeys": passkeys,
+	})
+}
+
+// DeleteHandler removes one of the current user's passkeys
+func (h *PasskeyHandler) DeleteHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	passkeyID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return
+	}
+
+	if err := h.passkeyService.Delete(c.Request.Context(), userID, uint(passkeyID)); err != nil {
+		if errors.Is(err, services.ErrPasskeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+			return
+		}
+		logging.Log.Error("Failed to delete passkey", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey deleted",
+	})
+}
+
+// BeginLoginHandler returns the options for a discoverable passkey login
+func (h *PasskeyHandler) BeginLoginHandler(c *gin.Context) {
+	sessionID, options, err := h.passkeyService.BeginLogin(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to begin passkey login", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to begin passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishLoginHandler verifies a passkey assertion and returns a token pair
+func (h *PasskeyHandler) FinishLoginHandler(c *gin.Context) {
+	var req FinishPasskeyLoginRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, accessToken, refreshToken, expiresIn, err := h.passkeyService.FinishLogin(c.Request.Context(), req.SessionID, req.Credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPasskeySession), errors.Is(err, services.ErrPasskeyRejected):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserInactive), errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			logging.Log.Error("Failed to finish passkey login", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+
+	logging.Log.Info("User logged in successfully with passkey", zap.String("email", user.Email))
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// ForgotPasswordRequest represents the JSON payload for requesting a reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the JSON payload for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,max=128"`
+}
+
+// ChangePasswordRequest represents the JSON payload for changing the current user's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,max=128"`
+}
+
+// PasswordHandler handles password change and recovery requests
+type PasswordHandler struct {
+	authService          *services.AuthService
+	passwordResetService *services.PasswordResetService
+}
+
+// NewPasswordHandler creates a new PasswordHandler
+func NewPasswordHandler(authService *services.AuthService, passwordResetService *services.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{
+		authService:          authService,
+		passwordResetService: passwordResetService,
+	}
+}
+
+// ForgotPasswordHandler emails a reset link. The response does not reveal whether the account exists.
+func (h *PasswordHandler) ForgotPasswordHandler(c *gin.Context) {
+	var req ForgotPasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.passwordResetService.RequestReset(c.Request.Context(), req.Email, c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many password reset requests. Please try again later.",
+			})
+			return
+		}
+		logging.Log.Error("Failed to process password reset request", zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If an account exists for this email, a password reset link has been sent.",
+	})
+}
+
+// ResetPasswordHandler sets a new password using a reset token
+func (h *PasswordHandler) ResetPasswordHandler(c *gin.Context) {
+	var req ResetPasswordRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.passwordResetService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid or expired password reset link",
+			})
+			return
+		}
+		logging.Log.Error("Failed to reset password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reset password",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password has been reset. Please log in with your new password.",
+	})
+}
+
+// ChangePasswordHandler changes the current user's password and signs out their other sessions
+func (h *PasswordHandler) ChangePasswordHandler(c *gin.Context) {
+	value, exists := c.Get("claims")
+	claims, ok := value.(*models.JWTClaims)
+	if !exists || !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid authentication context",
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	accessToken, refreshToken, expiresIn, err := h.authService.ChangePassword(c.Request.Context(), claims, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginThrottled(c, throttled)
+		case errors.Is(err, services.ErrInvalidCurrentPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		case errors.Is(err, services.ErrPasswordUnchanged):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current password"})
+		case errors.Is(err, services.ErrUserInactive):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+		default:
+			logging.Log.Error("Failed to change password",
+				zap.String("user_id", claims.UserID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		}
+		return
+	}
+
+	logging.Log.Info("Password changed successfully", zap.String("user_id", claims.UserID))
+
+	// Other sessions are revoked; the caller continues with these tokens
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+	})
+}
+
+// respondPasswordPolicyError writes a 400 response if err is a password policy violation
+func respondPasswordPolicyError(c *gin.Context, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Password does not meet the password policy",
+		"details": "Password " + policyErr.Reason,
+	})
+	return true
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// UpdateProfileRequest represents the JSON payload for editing the current
+// user's profile. Only these fields can be changed; omitted fields are left
+// unchanged. UpdatedAt must be the updated_at the client last read, and a new
+// email address needs the current password.
+type UpdateProfileRequest struct {
+	Name            *string    `json:"name" binding:"omitempty,min=1,max=100"`
+	Email           *string    `json:"email" binding:"omitempty,email"`
+	CurrentPassword string     `json:"current_password"`
+	UpdatedAt       *time.Time `json:"updated_at" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest represents the JSON payload for confirming a new email address
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ProfileResponse is the current user's own view of their profile
+type ProfileResponse struct {
+	UserResponse
+	PendingEmail   string    `json:"pending_email,omitempty"`   // new address awaiting confirmation
+	ImpersonatedBy string    `json:"impersonated_by,omitempty"` // email of the admin acting as the user
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ProfileHandler handles users editing their own profile
+type ProfileHandler struct {
+	profileService *services.ProfileService
+}
+
+// NewProfileHandler creates a new ProfileHandler
+func NewProfileHandler(profileService *services.ProfileService) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+	}
+}
+
+// UpdateProfileHandler applies a partial update to the current user's profile.
+// A changed email address is only used after it has been confirmed.
+func (h *ProfileHandler) UpdateProfileHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logging.Log.Warn("Invalid profile update request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Name == nil && req.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update; set name or email"})
+		return
+	}
+
+	user, pendingEmail, err := h.profileService.UpdateProfile(c.Request.Context(), userID, services.ProfileUpdate{
+		Name:            req.Name,
+		Email:           req.Email,
+		CurrentPassword: req.CurrentPassword,
+		UpdatedAt:       *req.UpdatedAt,
+	})
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginThrottled(c, throttled)
+		case errors.Is(err, services.ErrPasswordRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required to change the email address"})
+		case errors.Is(err, services.ErrInvalidCurrentPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		case errors.Is(err, services.ErrProfileConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "The profile was changed by another request; reload it and try again"})
+		case errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+		case errors.Is(err, services.ErrInvalidName):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be empty"})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+		default:
+			logging.Log.Error("Failed to update user profile",
+				zap.Uint("user_id", userID),
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user profile"})
+		}
+		return
+	}
+
+	// Roles cannot be changed here, so the token's roles are still current
+	var roles []string
+	if claims, ok := c.Get("claims"); ok {
+		roles = claims.(*models.JWTClaims).Roles
+	}
+
+	c.JSON(http.StatusOK, newProfileResponse(user, roles, pendingEmail))
+}
+
+// ConfirmEmailChangeHandler switches the account to a new email address. The
+// token is accepted as a query parameter (email link) or in a JSON body.
+func (h *ProfileHandler) ConfirmEmailChangeHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var req ConfirmEmailChangeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Confirmation token is required",
+			})
+			return
+		}
+		token = req.Token
+	}
+
+	user, err := h.profileService.ConfirmEmailChange(c.Request.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidEmailChange):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+		case errors.Is(err, services.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists"})
+		default:
+			logging.Log.Error("Failed to confirm email change", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm email change"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email address changed. Use the new address to log in.",
+		"email":   user.Email,
+	})
+}
+
+// newProfileResponse converts a user for the profile endpoints
+func newProfileResponse(user *models.User, roles []string, pendingEmail string) ProfileResponse {
+	return ProfileResponse{
+		UserResponse: UserResponse{
+			ID:    strconv.FormatUint(uint64(user.ID), 10),
+			Email: user.Email,
+			Name:  user.Name,
+			Roles: roles,
+		},
+		PendingEmail: pendingEmail,
+		UpdatedAt:    user.UpdatedAt,
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// RegisterRequest represents the JSON payload for registration requests
+type RegisterRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	Name       string `json:"name" binding:"required,max=100"`
+	Password   string `json:"password" binding:"required,max=128"`
+	InviteCode string `json:"invite_code"`
+}
+
+// VerifyEmailRequest represents the JSON payload for email verification
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest represents the JSON payload for resending a verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RegistrationModeRequest represents the JSON payload for changing the registration mode
+type RegistrationModeRequest struct {
+	Mode string `json:"mode" binding:"required,oneof=open invite disabled"`
+}
+
+// RegistrationHandler handles sign up and email verification requests
+type RegistrationHandler struct {
+	registrationService *services.RegistrationService
+}
+
+// NewRegistrationHandler creates a new RegistrationHandler
+func NewRegistrationHandler(registrationService *services.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{
+		registrationService: registrationService,
+	}
+}
+
+// RegisterHandler creates a new unverified account
+func (h *RegistrationHandler) RegisterHandler(c *gin.Context) {
+	var req RegisterRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logging.Log.Warn("Invalid registration request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.registrationService.Register(c.Request.Context(), services.RegisterInput{
+		Email:      req.Email,
+		Name:       req.Name,
+		Password:   req.Password,
+		InviteCode: req.InviteCode,
+		ClientIP:   c.ClientIP(),
+	})
+	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrRateLimited):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many attempts. Please try again later."})
+		case errors.Is(err, services.ErrRegistrationDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is currently disabled"})
+		case errors.Is(err, services.ErrInvalidInvite):
+			c.JSON(http.StatusForbidden, gin.H{"error": "A valid invite code for this email is required"})
+		case errors.Is(err, services.ErrEmailTaken):
+			// Answered like a new unverified account so that sign up does not reveal
+			// which addresses have accounts; the owner is emailed instead
+			respondVerificationPending(c)
+		default:
+			logging.Log.Error("Failed to register user", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		}
+		return
+	}
+
+	if !user.IsEmailVerified() {
+		respondVerificationPending(c)
+		return
+	}
+
+	// Only an invitation bound to the address verifies it, so this does not
+	// tell anyone without that invitation about the account
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Registration successful. You can now log in.",
+		"user": UserResponse{
+			ID:    strconv.FormatUint(uint64(user.ID), 10),
+			Email: user.Email,
+			Name:  user.Name,
+			Roles: models.RoleNames(user.Roles),
+		},
+	})
+}
+
+// VerifyEmailHandler confirms an email address. The token is accepted as a
+// query parameter (email link) or in a JSON body.
+func (h *RegistrationHandler) VerifyEmailHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		var req VerifyEmailRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Verification token is required",
+			})
+			return
+		}
+		token = req.Token
+	}
+
+	user, err := h.registrationService.VerifyEmail(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerification) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+		logging.Log.Error("Failed to verify email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully. You can now log in.",
+		"email":   user.Email,
+	})
+}
+
+// ResendVerificationHandler sends a new verification email.
+// The response is the same whether or not the account exists.
+func (h *RegistrationHandler) ResendVerificationHandler(c *gin.Context) {
+	var req ResendVerificationRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.registrationService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		logging.Log.Error("Failed to resend verification email", zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the account exists and is unverified, a new verification email has been sent.",
+	})
+}
+
+// GetRegistrationModeHandler returns the current registration mode
+func (h *RegistrationHandler) GetRegistrationModeHandler(c *gin.Context) {
+	mode, err := h.registrationService.Mode(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to get registration mode", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get registration mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": mode})
+}
+
+// SetRegistrationModeHandler switches between open, invite-only and disabled registration
+func (h *RegistrationHandler) SetRegistrationModeHandler(c *gin.Context) {
+	var req RegistrationModeRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.registrationService.SetMode(c.Request.Context(), req.Mode); err != nil {
+		logging.Log.Error("Failed to set registration mode", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set registration mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": req.Mode})
+}
+
+// respondVerificationPending answers a sign up that continues by email. New
+// accounts and addresses that already have one get the same response.
+func respondVerificationPending(c *gin.Context) {
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Registration received. Please check your email to continue.",
+	})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// CreateServiceAccountRequest represents the JSON payload for registering a service account
+type CreateServiceAccountRequest struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	Audiences []string `json:"audiences" binding:"required,min=1"`
+	Scopes    []string `json:"scopes"`
+}
+
+// UpdateServiceAccountRequest represents the JSON payload for updating a service
+// account. Omitted fields are left unchanged.
+type UpdateServiceAccountRequest struct {
+	Name      *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	Audiences *[]string `json:"audiences"`
+	Scopes    *[]string `json:"scopes"`
+	Disabled  *bool     `json:"disabled"`
+}
+
+// ServiceAccountResponse represents a service account as seen by admins. The
+// secret is only included when it was just created or rotated.
+type ServiceAccountResponse struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	Audiences    []string  `json:"audiences"`
+	Scopes       []string  `json:"scopes"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ServiceAccountHandler handles admin management of service accounts
+type ServiceAccountHandler struct {
+	accountService *services.ServiceAccountService
+}
+
+// NewServiceAccountHandler creates a new ServiceAccountHandler
+func NewServiceAccountHandler(accountService *services.ServiceAccountService) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		accountService: accountService,
+	}
+}
+
+// ListAccountsHandler returns every service account
+func (h *ServiceAccountHandler) ListAccountsHandler(c *gin.Context) {
+	accounts, err := h.accountService.ListAccounts(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list service accounts", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list service accounts"})
+		return
+	}
+
+	response := make([]ServiceAccountResponse, 0, len(accounts))
+	for i := range accounts {
+		response = append(response, newServiceAccountResponse(&accounts[i], ""))
+	}
+	c.JSON(http.StatusOK, gin.H{"service_accounts": response})
+}
+
+// CreateAccountHandler registers a service account and returns its secret once
+func (h *ServiceAccountHandler) CreateAccountHandler(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	account, secret, err := h.accountService.CreateAccount(c.Request.Context(), services.ServiceAccountInput{
+		Name:      req.Name,
+		Audiences: req.Audiences,
+		Scopes:    req.Scopes,
+	}, currentAdminID(c))
+	if err != nil {
+		respondServiceAccountError(c, "create service account", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newServiceAccountResponse(account, secret))
+}
+
+// UpdateAccountHandler changes a service account's name, audiences or scopes, or disables it
+func (h *ServiceAccountHandler) UpdateAccountHandler(c *gin.Context) {
+	id, ok := serviceAccountIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	account, err := h.accountService.UpdateAccount(c.Request.Context(), id, services.UpdateServiceAccountInput{
+		Name:      req.Name,
+		Audiences: req.Audiences,
+		Scopes:    req.Scopes,
+		Disabled:  req.Disabled,
+	}, currentAdminID(c))
+	if err != nil {
+		respondServiceAccountError(c, "update service account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newServiceAccountResponse(account, ""))
+}
+
+// RotateSecretHandler issues a new secret for a service account
+func (h *ServiceAccountHandler) RotateSecretHandler(c *gin.Context) {
+	id, ok := serviceAccountIDParam(c)
+	if !ok {
+		return
+	}
+
+	account, secret, err := h.accountService.RotateSecret(c.Request.Context(), id, currentAdminID(c))
+	if err != nil {
+		respondServiceAccountError(c, "rotate service account secret", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newServiceAccountResponse(account, secret))
+}
+
+// DeleteAccountHandler removes a service account
+func (h *ServiceAccountHandler) DeleteAccountHandler(c *gin.Context) {
+	id, ok := serviceAccountIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.accountService.DeleteAccount(c.Request.Context(), id, currentAdminID(c)); err != nil {
+		respondServiceAccountError(c, "delete service account", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
+
+// newServiceAccountResponse converts a service account for admin responses
+func newServiceAccountResponse(account *models.ServiceAccount, secret string) ServiceAccountResponse {
+	return ServiceAccountResponse{
+		ID:           account.ID,
+		ClientID:     account.ClientID,
+		ClientSecret: secret,
+		Name:         account.Name,
+		Audiences:    account.AudienceList(),
+		Scopes:       account.ScopeList(),
+		Disabled:     account.Disabled,
+		CreatedAt:    account.CreatedAt,
+	}
+}
+
+// serviceAccountIDParam parses the :id path parameter, writing a 400 response if it is invalid
+func serviceAccountIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondServiceAccountError maps service account management errors to HTTP responses
+func respondServiceAccountError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+	case errors.Is(err, services.ErrAudiencesRequired),
+		errors.Is(err, services.ErrInvalidServiceName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logging.Log.Error("Failed to "+action, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// SessionResponse describes a login session on one device
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // the session the request was made from
+}
+
+// SessionHandler handles listing and revoking login sessions
+type SessionHandler struct {
+	authService *services.AuthService
+}
+
+// NewSessionHandler creates a new SessionHandler
+func NewSessionHandler(authService *services.AuthService) *SessionHandler {
+	return &SessionHandler{
+		authService: authService,
+	}
+}
+
+// ListSessionsHandler returns the current user's active sessions
+func (h *SessionHandler) ListSessionsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.listSessions(c, userID, currentSessionID(c))
+}
+
+// RevokeSessionHandler signs out one of the current user's sessions
+func (h *SessionHandler) RevokeSessionHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	h.revokeSession(c, userID)
+}
+
+// RevokeOtherSessionsHandler signs out every session of the current user except this one
+func (h *SessionHandler) RevokeOtherSessionsHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := h.authService.RevokeOtherSessions(c.Request.Context(), userID, currentSessionID(c))
+	if err != nil {
+		logging.Log.Error("Failed to revoke other sessions", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions signed out",
+		"revoked": revoked,
+	})
+}
+
+// AdminListSessionsHandler returns a user's active sessions
+func (h *SessionHandler) AdminListSessionsHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	h.listSessions(c, userID, currentSessionID(c))
+}
+
+// AdminRevokeSessionHandler signs out one of a user's sessions
+func (h *SessionHandler) AdminRevokeSessionHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	h.revokeSession(c, userID)
+}
+
+// AdminRevokeAllSessionsHandler signs a user out everywhere
+func (h *SessionHandler) AdminRevokeAllSessionsHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.authService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		logging.Log.Error("Failed to load user", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := h.authService.RevokeAllSessions(c.Request.Context(), userID); err != nil {
+		logging.Log.Error("Failed to revoke sessions", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	logging.Log.Info("Admin signed user out everywhere", zap.Uint("user_id", userID), zap.Uint("admin_id", currentAdminID(c)))
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions signed out"})
+}
+
+// listSessions writes a user's sessions, marking the one with the given family ID as current
+func (h *SessionHandler) listSessions(c *gin.Context, userID uint, currentFamilyID string) {
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		logging.Log.Error("Failed to list sessions", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.FamilyID == currentFamilyID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// revokeSession signs out the session named by the :session_id path parameter
+func (h *SessionHandler) revokeSession(c *gin.Context, userID uint) {
+	sessionID, err := strconv.ParseUint(c.Param("session_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeUserSession(c.Request.Context(), userID, uint(sessionID)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		logging.Log.Error("Failed to revoke session", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
+
+// currentSessionID returns the session ("sid") of the caller's access token
+func currentSessionID(c *gin.Context) string {
+	if claims, ok := c.Value("claims").(*models.JWTClaims); ok {
+		return claims.Session
+	}
+	return ""
+}
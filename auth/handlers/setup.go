@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// SetupRequest represents the JSON payload for creating the first admin
+type SetupRequest struct {
+	Token    string `json:"token" binding:"required"` // setup token from the auth service log
+	Email    string `json:"email" binding:"required,email"`
+	Name     string `json:"name" binding:"required,max=100"`
+	Password string `json:"password" binding:"required,max=128"`
+}
+
+// SetupHandler handles first-run setup of a fresh install
+type SetupHandler struct {
+	bootstrapService *services.BootstrapService
+}
+
+// NewSetupHandler creates a new SetupHandler
+func NewSetupHandler(bootstrapService *services.BootstrapService) *SetupHandler {
+	return &SetupHandler{
+		bootstrapService: bootstrapService,
+	}
+}
+
+// StatusHandler tells the UI whether the first admin still has to be created
+func (h *SetupHandler) StatusHandler(c *gin.Context) {
+	required, err := h.bootstrapService.SetupRequired(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to check setup status", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check setup status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setup_required": required})
+}
+
+// CompleteSetupHandler creates the first admin. It answers 404 once an admin exists.
+func (h *SetupHandler) CompleteSetupHandler(c *gin.Context) {
+	var req SetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.bootstrapService.CompleteSetup(c.Request.Context(), req.Token, services.CreateUserInput{
+		Email:    req.Email,
+		Name:     req.Name,
+		Password: req.Password,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSetupComplete):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Setup is already complete"})
+		case errors.Is(err, services.ErrInvalidSetupToken):
+			logging.Log.Warn("Setup attempted with an invalid token", zap.String("client_ip", c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid setup token"})
+		default:
+			if respondPasswordPolicyError(c, err) {
+				return
+			}
+			respondUserAdminError(c, "complete setup", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAdminUserResponse(user))
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// TwoFactorLoginRequest represents the JSON payload for the second login step
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required,max=32"`
+}
+
+// TwoFactorCodeRequest represents the JSON payload for actions confirmed with a TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=16"`
+}
+
+// DisableTwoFactorRequest represents the JSON payload for turning off 2FA
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TwoFactorHandler handles 2FA enrollment and the second login step
+type TwoFactorHandler struct {
+	twoFactorService *services.TwoFactorService
+}
+
+// NewTwoFactorHandler creates a new TwoFactorHandler
+func NewTwoFactorHandler(twoFactorService *services.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+	}
+}
+
+// LoginTwoFactorHandler exchanges a login challenge and a TOTP or recovery code for tokens
+func (h *TwoFactorHandler) LoginTwoFactorHandler(c *gin.Context) {
+	var req TwoFactorLoginRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, accessToken, refreshToken, expiresIn, err := h.twoFactorService.CompleteChallenge(c.Request.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.As(err, &throttled):
+			respondLoginThrottled(c, throttled)
+		case errors.Is(err, services.ErrInvalidTwoFactorCode):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		case errors.Is(err, services.ErrInvalidChallenge), errors.Is(err, services.ErrTooManyAttempts):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserInactive), errors.Is(err, services.ErrTwoFactorNotEnabled):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		default:
+			logging.Log.Error("Failed to complete two-factor login", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+
+	logging.Log.Info("User logged in successfully with two-factor authentication", zap.String("email", user.Email))
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+	})
+}
+
+// StatusHandler reports whether 2FA is enabled for the current user
+func (h *TwoFactorHandler) StatusHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enabled, remaining, err := h.twoFactorService.Status(c.Request.Context(), userID)
+	if err != nil {
+		logging.Log.Error("Failed to get two-factor status", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// BeginTOTPHandler starts TOTP enrollment and returns the secret and QR code
+func (h *TwoFactorHandler) BeginTOTPHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		respondTwoFactorError(c, userID, "start TOTP enrollment", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTPHandler enables 2FA after checking a code from the authenticator app
+func (h *TwoFactorHandler) ConfirmTOTPHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, userID, "confirm TOTP enrollment", err)
+		return
+	}
+
+	// Recovery codes are only ever shown here and on regeneration
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodesHandler replaces the current user's recovery codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodesHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, userID, "regenerate recovery codes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableHandler turns off 2FA for the current user after re-checking their password
+func (h *TwoFactorHandler) DisableHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.twoFactorService.Disable(c.Request.Context(), userID, req.Password); err != nil {
+		respondTwoFactorError(c, userID, "disable two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// AdminResetHandler removes 2FA from a user who lost their authenticator and recovery codes
+func (h *TwoFactorHandler) AdminResetHandler(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	adminID, _ := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+
+	if err := h.twoFactorService.AdminReset(c.Request.Context(), uint(targetID), uint(adminID)); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		logging.Log.Error("Failed to reset two-factor authentication",
+			zap.Uint64("user_id", targetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication reset",
+	})
+}
+
+// currentUserID reads the authenticated user's ID set by the JWT middleware.
+// It writes a 401 response and returns false if the context is missing.
+func currentUserID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid authentication context",
+		})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// respondTwoFactorError maps 2FA service errors to HTTP responses
+func respondTwoFactorError(c *gin.Context, userID uint, action string, err error) {
+	var throttled *services.LoginThrottledError
+	switch {
+	case errors.As(err, &throttled):
+		respondLoginThrottled(c, throttled)
+	case errors.Is(err, services.ErrTwoFactorUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, services.ErrTwoFactorNotEnrolled),
+		errors.Is(err, services.ErrTwoFactorNotEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	case errors.Is(err, services.ErrInvalidCurrentPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password is incorrect"})
+	case errors.Is(err, services.ErrUserInactive):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication context"})
+	default:
+		logging.Log.Error("Failed to "+action, zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/auth/services"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// CreateUserRequest represents the JSON payload for creating a user as an admin
+type CreateUserRequest struct {
+	Email    string   `json:"email" binding:"required,email"`
+	Name     string   `json:"name" binding:"required,max=100"`
+	Password string   `json:"password" binding:"required,max=128"`
+	Roles    []string `json:"roles"`
+}
+
+// UpdateUserRequest represents the JSON payload for updating a user as an admin.
+// Omitted fields are left unchanged.
+type UpdateUserRequest struct {
+	Email     *string   `json:"email" binding:"omitempty,email"`
+	Name      *string   `json:"name" binding:"omitempty,min=1,max=100"`
+	Roles     *[]string `json:"roles"`
+	Disabled  *bool     `json:"disabled"`
+	MagicLink *bool     `json:"magic_link"`
+}
+
+// AdminUserResponse represents a user as seen by admins
+type AdminUserResponse struct {
+	ID            uint       `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	Roles         []string   `json:"roles"`
+	Disabled      bool       `json:"disabled"`
+	MagicLink     bool       `json:"magic_link"`
+	EmailVerified bool       `json:"email_verified"`
+	Locked        bool       `json:"locked"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// RoleResponse describes a role and the permissions it grants
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserAdminHandler handles admin user management requests
+type UserAdminHandler struct {
+	userAdminService     *services.UserAdminService
+	passwordResetService *services.PasswordResetService
+}
+
+// NewUserAdminHandler creates a new UserAdminHandler
+func NewUserAdminHandler(userAdminService *services.UserAdminService, passwordResetService *services.PasswordResetService) *UserAdminHandler {
+	return &UserAdminHandler{
+		userAdminService:     userAdminService,
+		passwordResetService: passwordResetService,
+	}
+}
+
+// ListUsersHandler returns a page of users. Query parameters: q, page, page_size.
+func (h *UserAdminHandler) ListUsersHandler(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultUserPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxUserPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page_size"})
+		return
+	}
+
+	users, total, err := h.userAdminService.ListUsers(c.Request.Context(), c.Query("q"), page, pageSize)
+	if err != nil {
+		logging.Log.Error("Failed to list users", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	response := make([]AdminUserResponse, 0, len(users))
+	for i := range users {
+		response = append(response, newAdminUserResponse(&users[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":     response,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetUserHandler returns a single user, including soft deleted users
+func (h *UserAdminHandler) GetUserHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userAdminService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		respondUserAdminError(c, "get user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// CreateUserHandler creates a verified user with a password chosen by the admin
+func (h *UserAdminHandler) CreateUserHandler(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userAdminService.CreateUser(c.Request.Context(), services.CreateUserInput{
+		Email:    req.Email,
+		Name:     req.Name,
+		Password: req.Password,
+		Roles:    req.Roles,
+	}, currentAdminID(c))
+	if err != nil {
+		if respondPasswordPolicyError(c, err) {
+			return
+		}
+		respondUserAdminError(c, "create user", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAdminUserResponse(user))
+}
+
+// UpdateUserHandler changes a user's name, email, roles, disabled state or magic link sign in
+func (h *UserAdminHandler) UpdateUserHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.userAdminService.UpdateUser(c.Request.Context(), userID, services.UpdateUserInput{
+		Email:     req.Email,
+		Name:      req.Name,
+		Roles:     req.Roles,
+		Disabled:  req.Disabled,
+		MagicLink: req.MagicLink,
+	}, currentAdminID(c))
+	if err != nil {
+		respondUserAdminError(c, "update user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// DeleteUserHandler soft deletes a user
+func (h *UserAdminHandler) DeleteUserHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userAdminService.DeleteUser(c.Request.Context(), userID, currentAdminID(c)); err != nil {
+		respondUserAdminError(c, "delete user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User deleted",
+	})
+}
+
+// RestoreUserHandler restores a soft deleted user
+func (h *UserAdminHandler) RestoreUserHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userAdminService.RestoreUser(c.Request.Context(), userID, currentAdminID(c))
+	if err != nil {
+		respondUserAdminError(c, "restore user", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newAdminUserResponse(user))
+}
+
+// ForcePasswordResetHandler invalidates a user's password and emails them a reset link
+func (h *UserAdminHandler) ForcePasswordResetHandler(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.passwordResetService.ForceReset(c.Request.Context(), userID, currentAdminID(c)); err != nil {
+		respondUserAdminError(c, "force password reset", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Password reset. The user has been signed out and emailed a reset link.",
+	})
+}
+
+// ListRolesHandler returns every role with its permissions
+func (h *UserAdminHandler) ListRolesHandler(c *gin.Context) {
+	roles, err := h.userAdminService.ListRoles(c.Request.Context())
+	if err != nil {
+		logging.Log.Error("Failed to list roles", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list roles"})
+		return
+	}
+
+	response := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		permissions := make([]string, 0, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			permissions = append(permissions, permission.Name)
+		}
+		response = append(response, RoleResponse{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: permissions,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": response})
+}
+
+// newAdminUserResponse converts a user for admin responses
+func newAdminUserResponse(user *models.User) AdminUserResponse {
+	response := AdminUserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		Roles:         models.RoleNames(user.Roles),
+		Disabled:      user.Disabled,
+		MagicLink:     user.MagicLink,
+		EmailVerified: user.IsEmailVerified(),
+		Locked:        user.IsLocked(time.Now()),
+		CreatedAt:     user.CreatedAt,
+	}
+	if user.DeletedAt.Valid {
+		deletedAt := user.DeletedAt.Time
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+// userIDParam parses the :id path parameter, writing a 400 response if it is invalid
+func userIDParam(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(userID), true
+}
+
+// currentAdminID returns the ID of the admin making the request
+func currentAdminID(c *gin.Context) uint {
+	adminID, _ := strconv.ParseUint(c.GetString("user_id"), 10, 64)
+	return uint(adminID)
+}
+
+// respondUserAdminError maps admin user management errors to HTTP responses
+func respondUserAdminError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrUserNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCannotModifySelf),
+		errors.Is(err, services.ErrUnknownRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		logging.Log.Error("Failed to "+action, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
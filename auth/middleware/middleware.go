@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/shashank/home-server/auth/services"
 	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
 )
 
 // jwtAuthMiddleware validates JWT tokens and extracts user information
@@ -52,7 +54,88 @@ func JwtAuthMiddleware() gin.HandlerFunc {
 		// Extract user information from claims and set in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
-		c.Set("user_is_admin", claims.IsAdmin)
+		c.Set("user_roles", claims.Roles)
+		c.Set("user_permissions", claims.Permissions)
+		c.Set("claims", claims)
+
+		// Audit events record the admin behind an impersonation token
+		if claims.IsImpersonation() {
+			if actorID, err := strconv.ParseUint(claims.Actor.Subject, 10, 64); err == nil {
+				c.Set("actor_id", claims.Actor.Subject)
+				c.Request = c.Request.WithContext(services.WithActor(c.Request.Context(), uint(actorID)))
+			}
+		}
+
+		c.Next()
+	})
+}
+
+// DenyImpersonation rejects requests made with an impersonation token, for
+// account security changes only the user themselves may make. It must run
+// after JwtAuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		claims, ok := c.Value("claims").(*models.JWTClaims)
+		if ok && claims.IsImpersonation() {
+			logging.Log.Warn("Blocked action while impersonating",
+				zap.String("admin_id", claims.Actor.Subject),
+				zap.String("user_id", claims.UserID),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This action is not allowed while impersonating a user",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// requestIDHeader carries the ID that ties audit events to request logs
+const requestIDHeader = "X-Request-ID"
+
+// ClientInfoMiddleware stores the caller's IP address, user agent and request ID
+// in the request context, where services read them to record sessions and audit
+// events. A request ID is generated unless a valid one was sent, and is echoed
+// in the response.
+func ClientInfoMiddleware() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !services.IsValidRequestID(requestID) {
+			requestID = services.NewRequestID()
+			c.Request.Header.Set(requestIDHeader, requestID)
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := services.WithClientInfo(c.Request.Context(), services.ClientInfo{
+			IPAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			RequestID: requestID,
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	})
+}
+
+// RequirePermission rejects requests whose token does not grant the permission.
+// It must run after JwtAuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		claims, ok := c.Value("claims").(*models.JWTClaims)
+		if !ok || !claims.HasPermission(permission) {
+			logging.Log.Warn("Permission denied",
+				zap.Any("user_id", c.Value("user_id")),
+				zap.String("permission", permission),
+				zap.String("path", c.Request.URL.Path))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Missing permission: " + permission,
+			})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	})
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// auditReasons are the short reasons stored for expected failures. Other
+// errors are recorded as "internal_error" so that database details stay in
+// the service logs.
+var auditReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrInvalidCredentials, "invalid_credentials"},
+	{ErrUserInactive, "account_disabled"},
+	{ErrEmailNotVerified, "email_not_verified"},
+	{ErrInvalidRefreshToken, "invalid_refresh_token"},
+	{ErrRefreshTokenReused, "refresh_token_reused"},
+	{ErrInvalidChallenge, "invalid_challenge"},
+	{ErrInvalidTwoFactorCode, "invalid_code"},
+	{ErrTooManyAttempts, "too_many_attempts"},
+	{ErrTwoFactorNotEnabled, "two_factor_not_enabled"},
+	{ErrPasskeyRejected, "passkey_rejected"},
+	{ErrPasskeyNotFound, "passkey_not_found"},
+	{ErrInvalidPasskeySession, "invalid_passkey_session"},
+	{ErrInvalidCurrentPassword, "invalid_current_password"},
+	{ErrPasswordUnchanged, "password_unchanged"},
+	{ErrInvalidResetToken, "invalid_reset_token"},
+	{ErrUnknownProvider, "unknown_provider"},
+	{ErrInvalidExternalState, "invalid_state"},
+	{ErrExternalLoginFailed, "login_failed"},
+	{ErrNoLinkedAccount, "no_linked_account"},
+	{ErrSessionNotFound, "session_not_found"},
+	{ErrInvalidInvite, "invalid_invite"},
+	{ErrEmailTaken, "email_taken"},
+	{ErrRegistrationDisabled, "registration_disabled"},
+	{ErrProfileConflict, "conflict"},
+	{ErrInvalidName, "invalid_name"},
+	{ErrInvalidEmailChange, "invalid_email_change"},
+	{ErrPasswordRequired, "password_required"},
+}
+
+// NewAuthEvent describes an event for the user with the given ID, or an unknown
+// user when it is 0. A non-nil err marks the event as a failure.
+func NewAuthEvent(eventType string, userID uint, err error) models.AuthEvent {
+	event := models.AuthEvent{
+		Type:    eventType,
+		Outcome: models.AuthOutcomeSuccess,
+	}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	if err != nil {
+		event.Outcome = models.AuthOutcomeFailure
+		event.Reason = auditReason(err)
+	}
+	return event
+}
+
+// auditReason maps an error to the reason stored with a failed event
+func auditReason(err error) string {
+	var throttled *LoginThrottledError
+	if errors.As(err, &throttled) {
+		return "throttled"
+	}
+	var policy *PasswordPolicyError
+	if errors.As(err, &policy) {
+		return "password_policy"
+	}
+	for _, known := range auditReasons {
+		if errors.Is(err, known.err) {
+			return known.reason
+		}
+	}
+	return "internal_error"
+}
+
+// RecordEvent writes an event to the audit log with the requesting device,
+// request ID and any impersonating admin taken from the context. The audit log must never block logins,
+// so failures to write are only logged.
+func (s *AuthService) RecordEvent(ctx context.Context, event models.AuthEvent) {
+	client := ClientInfoFrom(ctx)
+	event.IPAddress = client.IPAddress
+	event.UserAgent = client.UserAgent
+	event.RequestID = client.RequestID
+	if actorID := ActorFrom(ctx); actorID != 0 && event.ActorID == nil {
+		event.ActorID = &actorID
+	}
+
+	if err := s.authEventRepo.Create(ctx, &event); err != nil {
+		logging.Log.Error("Failed to record auth event",
+			zap.String("type", event.Type),
+			zap.String("outcome", event.Outcome),
+			zap.Error(err))
+	}
+}
+
+// ListEvents returns a page of audit log events matching the filter, newest first
+func (s *AuthService) ListEvents(ctx context.Context, filter db.AuthEventFilter, page, pageSize int) ([]models.AuthEvent, int64, error) {
+	return s.authEventRepo.Search(ctx, filter, page, pageSize)
+}
+
+// pruneAuthEvents deletes audit events older than the configured retention
+func (s *AuthService) pruneAuthEvents(ctx context.Context, now time.Time) (int64, error) {
+	retention := config.AppConfig.Auth.AuditRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	return s.authEventRepo.DeleteBefore(ctx, now.Add(-retention))
+}
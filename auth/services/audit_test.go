@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestNewAuthEvent(t *testing.T) {
+	event := NewAuthEvent(models.AuthEventLogin, 7, nil)
+	if event.Outcome != models.AuthOutcomeSuccess || event.Reason != "" {
+		t.Errorf("success event = %+v", event)
+	}
+	if event.UserID == nil || *event.UserID != 7 {
+		t.Errorf("UserID = %v, want 7", event.UserID)
+	}
+
+	if event := NewAuthEvent(models.AuthEventLogin, 0, ErrInvalidCredentials); event.UserID != nil {
+		t.Errorf("UserID = %v, want nil for an unknown user", *event.UserID)
+	}
+
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{ErrInvalidCredentials, "invalid_credentials"},
+		{fmt.Errorf("rotate: %w", ErrRefreshTokenReused), "refresh_token_reused"},
+		{&LoginThrottledError{}, "throttled"},
+		{errors.New("connection refused"), "internal_error"},
+	}
+	for _, tc := range cases {
+		event := NewAuthEvent(models.AuthEventLogin, 1, tc.err)
+		if event.Outcome != models.AuthOutcomeFailure || event.Reason != tc.want {
+			t.Errorf("NewAuthEvent(%v) = %s/%s, want failure/%s", tc.err, event.Outcome, event.Reason, tc.want)
+		}
+	}
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	cases := map[string]bool{
+		"":                                     false,
+		"0f8e2c1a-4b7d-4c1e-9a2b-3d5f6e7a8b9c": true,
+		"abc_DEF.123":                          true,
+		"has space":                            false,
+		"line\nbreak":                          false,
+		string(make([]byte, 65)):               false,
+	}
+	for id, want := range cases {
+		if got := IsValidRequestID(id); got != want {
+			t.Errorf("IsValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+	if id := NewRequestID(); !IsValidRequestID(id) {
+		t.Errorf("NewRequestID() = %q is not valid", id)
+	}
+}
@@ -2,10 +2,6 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"strconv"
@@ -13,88 +9,111 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/shashank/home-server/common/config"
 	"github.com/shashank/home-server/common/db"
 	"github.com/shashank/home-server/common/logging"
 	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/revocation"
 )
 
-// JWT key pair for signing and validation
+// revocations holds revoked access tokens and per-user token versions.
+// It is checked by ValidateJWTToken and served to the gateway.
+var revocations = revocation.NewList()
+
+// Errors returned when checking credentials
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Errors returned by the refresh token flow
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrUserInactive        = errors.New("user account is disabled or no longer exists")
+)
+
+// Errors returned when changing a password
 var (
-	privateKey *rsa.PrivateKey
-	publicKey  *rsa.PublicKey
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrPasswordUnchanged      = errors.New("new password must differ from the current password")
 )
 
 type AuthService struct {
-	userRepo *db.UserRepository
+	userRepo         *db.UserRepository
+	roleRepo         *db.RoleRepository
+	refreshTokenRepo *db.RefreshTokenRepository
+	revokedTokenRepo *db.RevokedTokenRepository
+	sessionRepo      *db.SessionRepository
+	authEventRepo    *db.AuthEventRepository
+	twoFactorRepo    *db.TwoFactorRepository
 }
 
-func NewAuthService(userRepo *db.UserRepository) *AuthService {
+func NewAuthService(userRepo *db.UserRepository, roleRepo *db.RoleRepository, refreshTokenRepo *db.RefreshTokenRepository, revokedTokenRepo *db.RevokedTokenRepository, sessionRepo *db.SessionRepository, authEventRepo *db.AuthEventRepository, twoFactorRepo *db.TwoFactorRepository) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revokedTokenRepo: revokedTokenRepo,
+		sessionRepo:      sessionRepo,
+		authEventRepo:    authEventRepo,
+		twoFactorRepo:    twoFactorRepo,
 	}
 }
 
-// initializeJWTKeys generates RSA key pair for JWT signing
-func InitializeJWTKeys() error {
-	// Get key size from config, fallback to 2048 if not set
-	keySize := config.AppConfig.JWT.KeySize
-	if keySize == 0 {
-		keySize = 2048
-	}
-
-	// Generate private key
-	privKey, err := rsa.GenerateKey(rand.Reader, keySize)
-	if err != nil {
-		return fmt.Errorf("failed to generate private key: %w", err)
-	}
+// Authenticate checks a user's email and password. Callers decide whether a
+// second factor is required before issuing tokens with GenerateTokenPair.
+// Every attempt is recorded in the audit log.
+func (s *AuthService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, userID, err := s.validateUserCredentials(ctx, email, password)
 
-	privateKey = privKey
-	publicKey = &privKey.PublicKey
+	event := NewAuthEvent(models.AuthEventLogin, userID, err)
+	event.Email = email
+	s.RecordEvent(ctx, event)
 
-	logging.Log.Info("JWT keys initialized successfully",
-		zap.Int("key_size", keySize))
-	return nil
+	return user, err
 }
 
-// Login handles user login and returns JWT tokens
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, string, int64, error) {
-	user, err := s.validateUserCredentials(ctx, email, password)
+// Logout revokes the presented access token and the refresh token family of its session
+func (s *AuthService) Logout(ctx context.Context, claims *models.JWTClaims) error {
+	userID, err := strconv.ParseUint(claims.UserID, 10, 64)
 	if err != nil {
-		return "", "", 0, err
+		return fmt.Errorf("invalid user id in claims: %w", err)
 	}
 
-	// Generate token pair
-	accessToken, refreshToken, expiresIn, err := GenerateTokenPair(user)
-	if err != nil {
-		return "", "", 0, err
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := s.revokeAccessToken(ctx, claims.ID, uint(userID), claims.ExpiresAt.Time); err != nil {
+			return err
+		}
 	}
 
-	return accessToken, refreshToken, expiresIn, nil
-}
+	if claims.Session != "" {
+		if err := s.revokeSession(ctx, claims.Session); err != nil {
+			return err
+		}
+	}
 
-// Logout handles user logout and token invalidation
-func (s *AuthService) Logout(ctx context.Context, userID uint) error {
-	// We use Stateless JWT (most common in microservices). The backend does not store tokens.
-	// With stateless JWTs, there is no real "logout" on the backend — the JWT remains valid until expiration.
-	//
-	// For true logout functionality, you would need to:
-	// 1. Implement a token blacklist (store invalidated tokens in Redis/DB until expiry)
-	// 2. Use short-lived access tokens (15-30 minutes) to minimize exposure
-	// 3. Client-side: remove tokens from storage immediately
-	//
-	// For now, this is a no-op that logs the logout event.
-
-	logging.Log.Info("User logout processed (stateless JWT - token remains valid until expiry)",
-		zap.Uint("user_id", userID))
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventLogout, uint(userID), nil))
+	logging.Log.Info("User logout processed",
+		zap.Uint("user_id", uint(userID)),
+		zap.String("session", claims.Session))
 
 	return nil
 }
 
-// GenerateTokenPair creates both access and refresh tokens for a user
-func GenerateTokenPair(user *models.User) (accessToken, refreshToken string, expiresIn int64, err error) {
+// GenerateTokenPair creates an access token and a refresh token that starts a new token family
+func (s *AuthService) GenerateTokenPair(ctx context.Context, user *models.User) (accessToken, refreshToken string, expiresIn int64, err error) {
+	familyID, err := generateID()
+	if err != nil {
+		return "", "", 0, err
+	}
+	return s.issueTokenPair(ctx, user, familyID)
+}
+
+// issueTokenPair signs an access token, stores a new refresh token in the given
+// family and records the family's session with the requesting device's details
+func (s *AuthService) issueTokenPair(ctx context.Context, user *models.User, familyID string) (accessToken, refreshToken string, expiresIn int64, err error) {
 	now := time.Now()
 
 	// Get durations from config
@@ -102,13 +121,28 @@ func GenerateTokenPair(user *models.User) (accessToken, refreshToken string, exp
 	refreshTokenDuration := config.AppConfig.JWT.RefreshTokenDuration
 	issuer := config.AppConfig.JWT.Issuer
 
+	jti, err := generateID()
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	// Roles are read fresh so that changes apply from the next refresh
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to load user roles: %w", err)
+	}
+
 	// Generate access token
 	accessClaims := models.JWTClaims{
-		UserID:  strconv.Itoa(int(user.ID)),
-		Email:   user.Email,
-		IsAdmin: user.IsAdmin,
-		Type:    models.TokenTypeAccess,
+		UserID:      strconv.Itoa(int(user.ID)),
+		Email:       user.Email,
+		Roles:       models.RoleNames(roles),
+		Permissions: models.PermissionNames(roles),
+		Type:        models.TokenTypeAccess,
+		Session:     familyID,
+		Version:     user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			Issuer:    issuer,
 			Subject:   strconv.Itoa(int(user.ID)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -117,37 +151,36 @@ func GenerateTokenPair(user *models.User) (accessToken, refreshToken string, exp
 		},
 	}
 
-	accessTokenObj := jwt.NewWithClaims(jwt.SigningMethodRS256, accessClaims)
-	accessToken, err = accessTokenObj.SignedString(privateKey)
+	accessToken, err = signJWT(accessClaims)
 	if err != nil {
 		return "", "", 0, fmt.Errorf("failed to sign access token: %w", err)
 	}
 
-	// Generate refresh token
-	refreshClaims := models.JWTClaims{
-		UserID:  strconv.Itoa(int(user.ID)),
-		Email:   user.Email,
-		IsAdmin: user.IsAdmin,
-		Type:    models.TokenTypeRefresh,
-		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    issuer,
-			Subject:   strconv.Itoa(int(user.ID)),
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(refreshTokenDuration)),
-			NotBefore: jwt.NewNumericDate(now),
-		},
+	// Generate an opaque refresh token; only its hash is persisted
+	refreshToken, err = generateOpaqueToken()
+	if err != nil {
+		return "", "", 0, err
 	}
 
-	refreshTokenObj := jwt.NewWithClaims(jwt.SigningMethodRS256, refreshClaims)
-	refreshToken, err = refreshTokenObj.SignedString(privateKey)
-	if err != nil {
-		return "", "", 0, fmt.Errorf("failed to sign refresh token: %w", err)
+	record := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(refreshTokenDuration).UTC(),
+	}
+	if err := s.refreshTokenRepo.Create(ctx, record); err != nil {
+		return "", "", 0, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	if err := s.recordSession(ctx, user.ID, familyID, now, record.ExpiresAt); err != nil {
+		return "", "", 0, err
 	}
 
 	expiresIn = int64(accessTokenDuration.Seconds())
 
 	logging.Log.Debug("Generated token pair",
 		zap.Uint("user_id", user.ID),
+		zap.String("family_id", familyID),
 		zap.Int64("expires_in", expiresIn))
 
 	return accessToken, refreshToken, expiresIn, nil
@@ -155,14 +188,33 @@ func GenerateTokenPair(user *models.User) (accessToken, refreshToken string, exp
 
 // validateJWTToken validates and parses a JWT token
 func ValidateJWTToken(tokenString string) (*models.JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return publicKey, nil
-	})
+	return validateTokenOfType(tokenString, models.TokenTypeAccess)
+}
+
+// validateTokenOfType parses a token signed by this service and checks that it
+// has the expected type and has not been revoked
+func validateTokenOfType(tokenString, tokenType string) (*models.JWTClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens of one type must never be accepted in place of another
+	if claims.Type != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+
+	if revocations.IsRevoked(claims) {
+		return nil, errors.New("token has been revoked")
+	}
+
+	return claims, nil
+}
 
+// parseToken checks the signature and lifetime of a token signed by this
+// service, whatever its type. It does not check revocation.
+func parseToken(tokenString string) (*models.JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, verificationKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -171,86 +223,211 @@ func ValidateJWTToken(tokenString string) (*models.JWTClaims, error) {
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token claims")
 	}
-
-	// Validate token type (should be "access" for API requests)
-	if claims.Type != models.TokenTypeAccess {
-		return nil, errors.New("invalid token type")
-	}
-
 	return claims, nil
 }
 
-// hashPassword creates a bcrypt hash of the password
+// hashPassword hashes a password with the configured algorithm
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return hashers.hash(password)
 }
 
-// verifyPassword checks if the provided password matches the hash
+// verifyPassword checks if the provided password matches the hash, whichever
+// accepted algorithm produced it
 func verifyPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	ok, err := hashers.verify(password, hash)
+	if err != nil {
+		logging.Log.Warn("Failed to verify password hash", zap.Error(err))
+	}
+	return ok
 }
 
-// validateUserCredentials validates user email and password
-func (s *AuthService) validateUserCredentials(ctx context.Context, email, password string) (*models.User, error) {
+// validateUserCredentials validates user email and password. Unknown emails and
+// wrong passwords return the same errors, throttling included, and take the same
+// time. The ID of the account the email belongs to is returned even when the
+// check fails, for auditing.
+func (s *AuthService) validateUserCredentials(ctx context.Context, email, password string) (*models.User, uint, error) {
+	email = normalizeEmail(email)
+	cfg := config.AppConfig.Auth.Lockout
+
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if user == nil {
-		return nil, errors.New("user not found")
+		burnPasswordCheck(password)
+		if err := unknownEmailLogins.checkAndRecord(cfg, email, time.Now()); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, ErrInvalidCredentials
+	}
+
+	// The attempt counts as failed until the password turns out to be right
+	claimed, err := s.claimLoginAttempt(ctx, user)
+	if err != nil {
+		burnPasswordCheck(password)
+		return nil, user.ID, err
 	}
 
 	if !verifyPassword(password, user.Password) {
-		return nil, errors.New("invalid credentials")
+		logLockout(user, claimed)
+		return nil, user.ID, ErrInvalidCredentials
+	}
+
+	// The plain password is only available here, so old hashes are upgraded now
+	if hashers.needsRehash(user.Password) {
+		s.upgradePasswordHash(ctx, user.ID, user.Password, password)
 	}
 
-	return user, nil
+	// With 2FA the attempt stays counted until the second factor passes, so
+	// fetching new login challenges cannot reset the counter
+	mfaEnabled, err := s.twoFactorRepo.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, user.ID, err
+	}
+	if !mfaEnabled {
+		if err := s.userRepo.ClearFailedLogins(ctx, user.ID); err != nil {
+			return nil, user.ID, err
+		}
+	}
+
+	if user.Disabled {
+		return nil, user.ID, ErrUserInactive
+	}
+
+	if !user.IsEmailVerified() {
+		return nil, user.ID, ErrEmailNotVerified
+	}
+
+	return user, user.ID, nil
+}
+
+// upgradePasswordHash replaces a user's password hash with one made by the
+// configured algorithm. Failures are logged; the old hash keeps working. A
+// password changed since oldHash was read is left alone.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, userID uint, oldHash, password string) {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		logging.Log.Error("Failed to upgrade password hash", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	replaced, err := s.userRepo.ReplacePasswordHash(ctx, userID, oldHash, hashed)
+	if err != nil {
+		logging.Log.Error("Failed to upgrade password hash", zap.Uint("user_id", userID), zap.Error(err))
+		return
+	}
+	if !replaced {
+		logging.Log.Info("Password changed during login; hash not upgraded", zap.Uint("user_id", userID))
+		return
+	}
+	logging.Log.Info("Password hash upgraded", zap.Uint("user_id", userID))
+}
+
+// ValidateRefreshToken looks up a refresh token and checks that it can still be used.
+// Presenting a token that was already rotated revokes its whole family.
+func (s *AuthService) ValidateRefreshToken(ctx context.Context, tokenString string) (*models.RefreshToken, error) {
+	record, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(tokenString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	if record == nil || record.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if record.UsedAt != nil {
+		s.revokeReusedFamily(ctx, record)
+		return nil, ErrRefreshTokenReused
+	}
+
+	if record.IsExpired(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return record, nil
 }
 
-// validateRefreshToken validates a refresh token and returns the user
-func (s *AuthService) ValidateRefreshToken(ctx context.Context, tokenString string) (*models.User, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RefreshTokens rotates a refresh token and returns a new token pair in the same family
+func (s *AuthService) RefreshTokens(ctx context.Context, tokenString string) (*models.User, string, string, int64, error) {
+	record, err := s.ValidateRefreshToken(ctx, tokenString)
+	if err != nil {
+		// Reuse is recorded with the family's owner by revokeReusedFamily
+		if !errors.Is(err, ErrRefreshTokenReused) {
+			s.RecordEvent(ctx, NewAuthEvent(models.AuthEventTokenRefresh, 0, err))
 		}
-		return publicKey, nil
-	})
+		return nil, "", "", 0, err
+	}
+
+	// Tokens issued to OIDC clients are refreshed at the OIDC token endpoint
+	if record.ClientID != "" {
+		s.RecordEvent(ctx, NewAuthEvent(models.AuthEventTokenRefresh, record.UserID, ErrInvalidRefreshToken))
+		return nil, "", "", 0, ErrInvalidRefreshToken
+	}
 
+	// Mark the token as used before issuing a successor. Losing this race
+	// means another request already rotated it, which is treated as reuse.
+	marked, err := s.refreshTokenRepo.MarkUsed(ctx, record.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse refresh token: %w", err)
+		return nil, "", "", 0, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !marked {
+		s.revokeReusedFamily(ctx, record)
+		return nil, "", "", 0, ErrRefreshTokenReused
 	}
 
-	claims, ok := token.Claims.(*models.JWTClaims)
-	if !ok || !token.Valid {
-		return nil, errors.New("invalid refresh token claims")
+	// Always reload the user so that deleted or disabled accounts cannot refresh
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, "", "", 0, fmt.Errorf("failed to load user: %w", err)
+	}
+	if user == nil || user.Disabled {
+		if err := s.revokeSession(ctx, record.FamilyID); err != nil {
+			logging.Log.Error("Failed to revoke session",
+				zap.String("family_id", record.FamilyID), zap.Error(err))
+		}
+		s.RecordEvent(ctx, NewAuthEvent(models.AuthEventTokenRefresh, record.UserID, ErrUserInactive))
+		return nil, "", "", 0, ErrUserInactive
 	}
 
-	// Validate token type (should be "refresh")
-	if claims.Type != models.TokenTypeRefresh {
-		return nil, errors.New("invalid token type for refresh")
+	accessToken, refreshToken, expiresIn, err := s.issueTokenPair(ctx, user, record.FamilyID)
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventTokenRefresh, user.ID, err))
+	if err != nil {
+		return nil, "", "", 0, err
 	}
 
-	// TODO: Check if refresh token exists in database and is not revoked
+	return user, accessToken, refreshToken, expiresIn, nil
+}
 
-	// Return user from claims (in production, fetch from database)
-	userID, _ := strconv.ParseUint(claims.UserID, 10, 0)
-	return &models.User{
-		BaseModel: models.BaseModel{
-			ID: uint(userID),
-		},
-		Email:   claims.Email,
-		IsAdmin: claims.IsAdmin,
-	}, nil
+// revokeReusedFamily revokes a token family after a rotated token was presented again
+func (s *AuthService) revokeReusedFamily(ctx context.Context, record *models.RefreshToken) {
+	logging.Log.Warn("Refresh token reuse detected, revoking token family",
+		zap.Uint("user_id", record.UserID),
+		zap.String("family_id", record.FamilyID))
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventTokenRefresh, record.UserID, ErrRefreshTokenReused))
+
+	if err := s.revokeSession(ctx, record.FamilyID); err != nil {
+		logging.Log.Error("Failed to revoke session",
+			zap.String("family_id", record.FamilyID), zap.Error(err))
+	}
 }
 
-// invalidateRefreshToken marks a refresh token as invalid
+// InvalidateRefreshToken revokes the family of a refresh token owned by the given user
 func (s *AuthService) InvalidateRefreshToken(ctx context.Context, tokenString string, userID uint) error {
-	// TODO: Implement database logic to mark token as revoked
+	record, err := s.refreshTokenRepo.GetByHash(ctx, hashToken(tokenString))
+	if err != nil {
+		return fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+	if record == nil || record.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	if err := s.revokeSession(ctx, record.FamilyID); err != nil {
+		return err
+	}
+
 	logging.Log.Info("Refresh token invalidated",
-		zap.Uint("user_id", userID))
+		zap.Uint("user_id", userID),
+		zap.String("family_id", record.FamilyID))
 	return nil
 }
 
@@ -266,31 +443,70 @@ func (s *AuthService) CheckDatabaseHealth(ctx context.Context) error {
 	return nil
 }
 
-// GetPublicKeyPEM returns the public key in PEM format for the gateway service
-func (s *AuthService) GetPublicKeyPEM(ctx context.Context) (string, error) {
-	if publicKey == nil {
-		return "", errors.New("public key not initialized")
+// CreateUser creates a new user
+func (s *AuthService) CreateUser(ctx context.Context, user *models.User) error {
+	return s.userRepo.Create(ctx, user)
+}
+
+// GetUserRoles returns the user's roles with their permissions
+func (s *AuthService) GetUserRoles(ctx context.Context, userID uint) ([]models.Role, error) {
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+// ChangePassword verifies the current password, stores the new one and revokes
+// every other session. A fresh token pair for the caller's session is returned.
+func (s *AuthService) ChangePassword(ctx context.Context, claims *models.JWTClaims, currentPassword, newPassword string) (string, string, int64, error) {
+	userID, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid user id in claims: %w", err)
 	}
 
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	accessToken, refreshToken, expiresIn, err := s.changePassword(ctx, uint(userID), currentPassword, newPassword)
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventPasswordChange, uint(userID), err))
+	return accessToken, refreshToken, expiresIn, err
+}
+
+// changePassword does the work of ChangePassword
+func (s *AuthService) changePassword(ctx context.Context, userID uint, currentPassword, newPassword string) (string, string, int64, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal public key: %w", err)
+		return "", "", 0, err
+	}
+	if user == nil || user.Disabled {
+		return "", "", 0, ErrUserInactive
+	}
+
+	if err := s.verifyCurrentPassword(ctx, user, currentPassword); err != nil {
+		return "", "", 0, err
+	}
+	if currentPassword == newPassword {
+		return "", "", 0, ErrPasswordUnchanged
+	}
+	if err := ValidatePassword(newPassword, user.Email); err != nil {
+		return "", "", 0, err
 	}
 
-	pubKeyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: pubKeyBytes,
-	})
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return "", "", 0, fmt.Errorf("failed to update password: %w", err)
+	}
 
-	return string(pubKeyPEM), nil
-}
+	// Revoke everything, then start a fresh session for the caller
+	if err := s.RevokeAllSessions(ctx, user.ID); err != nil {
+		return "", "", 0, err
+	}
 
-// CreateUser creates a new user
-func (s *AuthService) CreateUser(ctx context.Context, user *models.User) error {
-	return s.userRepo.Create(ctx, user)
-}
+	user, err = s.userRepo.GetByID(ctx, user.ID)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to reload user: %w", err)
+	}
+	if user == nil {
+		return "", "", 0, ErrUserInactive
+	}
 
-// UpdateUserProfile updates the user's profile information
-func (s *AuthService) UpdateUserProfile(ctx context.Context, user *models.User) error {
-	return s.userRepo.Update(ctx, user)
+	logging.Log.Info("Password changed", zap.Uint("user_id", user.ID))
+	return s.GenerateTokenPair(ctx, user)
 }
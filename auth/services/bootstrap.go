@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// defaultBootstrapAdminName is used when BOOTSTRAP_ADMIN_NAME is unset
+const defaultBootstrapAdminName = "Admin"
+
+// Errors returned by first-run setup
+var (
+	ErrSetupComplete     = errors.New("setup is already complete")
+	ErrInvalidSetupToken = errors.New("invalid setup token")
+)
+
+// BootstrapService creates the first admin of a fresh install, either from the
+// environment at startup or through the setup endpoint with a one-time token.
+type BootstrapService struct {
+	roleRepo    *db.RoleRepository
+	userAdmin   *UserAdminService
+	authService *AuthService
+
+	mu        sync.Mutex
+	tokenHash string // hash of the setup token; empty when setup is not available
+}
+
+// NewBootstrapService creates a new BootstrapService
+func NewBootstrapService(roleRepo *db.RoleRepository, userAdmin *UserAdminService, authService *AuthService) *BootstrapService {
+	return &BootstrapService{
+		roleRepo:    roleRepo,
+		userAdmin:   userAdmin,
+		authService: authService,
+	}
+}
+
+// SetupURL returns the URL of the first-run setup endpoint
+func SetupURL() string {
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.API.BaseURL + "/auth/setup"
+}
+
+// Bootstrap runs at startup. When no active admin exists it creates one from
+// auth.bootstrap, or otherwise enables the setup endpoint and logs its token.
+// A bootstrap admin that cannot be created is logged and falls back to the token.
+func (s *BootstrapService) Bootstrap(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists, err := s.adminExists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if cfg := config.AppConfig.Auth.Bootstrap; cfg.AdminEmail != "" {
+		user, err := s.createAdminFromConfig(ctx, cfg)
+		if err == nil {
+			logging.Log.Warn("Created the first admin from the environment",
+				zap.Uint("user_id", user.ID),
+				zap.String("email", user.Email))
+			return nil
+		}
+		logging.Log.Error("Failed to create the first admin from the environment", zap.Error(err))
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	s.tokenHash = hashToken(token)
+
+	// The token is only ever shown here, to whoever can read the service's log
+	logging.Log.Warn("No admin account exists; create one with the setup token",
+		zap.String("setup_url", SetupURL()),
+		zap.String("setup_token", token))
+	return nil
+}
+
+// SetupRequired reports whether the setup endpoint accepts a new admin. It
+// turns itself off once an admin exists, however that admin was created.
+func (s *BootstrapService) SetupRequired(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setupRequired(ctx)
+}
+
+// CompleteSetup creates the first admin with the setup token from the log.
+// The token stops working as soon as it has been used.
+func (s *BootstrapService) CompleteSetup(ctx context.Context, token string, input CreateUserInput) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	required, err := s.setupRequired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !required {
+		return nil, ErrSetupComplete
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(s.tokenHash)) != 1 {
+		return nil, ErrInvalidSetupToken
+	}
+
+	input.Roles = []string{models.RoleAdmin}
+	user, err := s.userAdmin.CreateUser(ctx, input, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.tokenHash = ""
+
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventAdminBootstrap, user.ID, nil))
+	logging.Log.Warn("Created the first admin with the setup token",
+		zap.Uint("user_id", user.ID),
+		zap.String("email", user.Email))
+	return user, nil
+}
+
+// setupRequired is SetupRequired for callers holding the lock
+func (s *BootstrapService) setupRequired(ctx context.Context) (bool, error) {
+	if s.tokenHash == "" {
+		return false, nil
+	}
+	exists, err := s.adminExists(ctx)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		s.tokenHash = ""
+		logging.Log.Info("An admin exists; setup endpoint disabled")
+		return false, nil
+	}
+	return true, nil
+}
+
+// createAdminFromConfig creates the admin named by the bootstrap environment variables
+func (s *BootstrapService) createAdminFromConfig(ctx context.Context, cfg config.BootstrapConfig) (*models.User, error) {
+	if cfg.AdminPasswordFile == "" {
+		return nil, errors.New("BOOTSTRAP_ADMIN_PASSWORD_FILE is not set")
+	}
+	data, err := os.ReadFile(cfg.AdminPasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin password file: %w", err)
+	}
+
+	name := strings.TrimSpace(cfg.AdminName)
+	if name == "" {
+		name = defaultBootstrapAdminName
+	}
+	user, err := s.userAdmin.CreateUser(ctx, CreateUserInput{
+		Email:    cfg.AdminEmail,
+		Name:     name,
+		Password: strings.TrimRight(string(data), "\r\n"),
+		Roles:    []string{models.RoleAdmin},
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventAdminBootstrap, user.ID, nil))
+	return user, nil
+}
+
+// adminExists reports whether any admin can log in
+func (s *BootstrapService) adminExists(ctx context.Context) (bool, error) {
+	count, err := s.roleRepo.CountActiveUsersWithRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return false, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count > 0, nil
+}
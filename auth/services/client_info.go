@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"strings"
+)
+
+// maxUserAgentLength bounds the user agent stored with a session
+const maxUserAgentLength = 512
+
+// ClientInfo describes the device a request came from
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	RequestID string // correlates audit events with request logs
+}
+
+// clientInfoKey is the context key for ClientInfo
+type clientInfoKey struct{}
+
+// WithClientInfo returns a context that carries the requesting device's details,
+// so that services can record them without every call passing them along
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// maxRequestIDLength bounds request IDs accepted from callers
+const maxRequestIDLength = 64
+
+// NewRequestID returns a random identifier for a request that arrived without a valid one
+func NewRequestID() string {
+	id, err := generateID()
+	if err != nil {
+		return ""
+	}
+	return id
+}
+
+// IsValidRequestID reports whether a caller supplied request ID is safe to store and log
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") == ""
+}
+
+// ClientInfoFrom returns the device details stored in the context, if any
+func ClientInfoFrom(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	if len(info.UserAgent) > maxUserAgentLength {
+		info.UserAgent = info.UserAgent[:maxUserAgentLength]
+	}
+	return info
+}
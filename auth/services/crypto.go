@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// ErrEncryptionUnavailable is returned when no encryption key is configured
+var ErrEncryptionUnavailable = errors.New("encryption key is not configured")
+
+// secretBox encrypts small secrets for storage with AES-256-GCM
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+// newSecretBox creates a secretBox from a base64 encoded 32-byte key
+func newSecretBox(encodedKey string) (*secretBox, error) {
+	if encodedKey == "" {
+		return nil, ErrEncryptionUnavailable
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key encoding: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &secretBox{aead: aead}, nil
+}
+
+// Seal encrypts plaintext bound to the given context (e.g. "totp:42") so the
+// ciphertext cannot be moved to another row. The result is base64 encoded.
+func (b *secretBox) Seal(plaintext []byte, context string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, plaintext, []byte(context))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal with the same context
+func (b *secretBox) Open(ciphertext string, context string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext encoding: %w", err)
+	}
+
+	nonceSize := b.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	plaintext, err := b.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(context))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box, err := newSecretBox(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+	if err != nil {
+		t.Fatalf("newSecretBox failed: %v", err)
+	}
+
+	sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"), "totp:1")
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Fatal("Expected secret not to appear in ciphertext")
+	}
+
+	opened, err := box.Open(sealed, "totp:1")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if string(opened) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Expected original secret, got %q", opened)
+	}
+
+	if _, err := box.Open(sealed, "totp:2"); err == nil {
+		t.Error("Expected decryption with a different context to fail")
+	}
+}
+
+func TestSecretBoxKeyValidation(t *testing.T) {
+	if _, err := newSecretBox(""); !errors.Is(err, ErrEncryptionUnavailable) {
+		t.Errorf("Expected ErrEncryptionUnavailable, got %v", err)
+	}
+	if _, err := newSecretBox(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("Expected short key to be rejected")
+	}
+}
@@ -0,0 +1,583 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned by sign in with upstream providers
+var (
+	ErrUnknownProvider       = errors.New("unknown identity provider")
+	ErrInvalidExternalState  = errors.New("invalid or expired external sign in")
+	ErrExternalLoginFailed   = errors.New("the identity provider did not confirm the sign in")
+	ErrNoLinkedAccount       = errors.New("no account is linked to this identity")
+	ErrIdentityLinked        = errors.New("this identity is already linked to another account")
+	ErrProviderAlreadyLinked = errors.New("an identity from this provider is already linked to the account")
+	ErrIdentityNotFound      = errors.New("no identity from this provider is linked to the account")
+	ErrLastLoginMethod       = errors.New("cannot remove the only way to sign in to the account")
+)
+
+// providerNamePattern restricts provider names to values that are safe in URLs and setting keys
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ExternalProvider describes a configured upstream provider
+type ExternalProvider struct {
+	Name          string
+	DisplayName   string
+	AutoProvision bool
+}
+
+// ExternalLoginResult is the outcome of a provider callback
+type ExternalLoginResult struct {
+	User        *models.User
+	Provider    string
+	Linked      bool // the identity was linked to a signed-in user rather than used to log in
+	Provisioned bool // a new account was created for the identity
+}
+
+// externalStatePayload is the server-side state of a sign in kept until the callback
+type externalStatePayload struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// externalClaims holds the verified ID token claims used to find or create a user
+type externalClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// ExternalLoginService signs users in with upstream OpenID Connect providers
+// and manages the identities linked to local accounts
+type ExternalLoginService struct {
+	identityRepo *db.ExternalIdentityRepository
+	userRepo     *db.UserRepository
+	roleRepo     *db.RoleRepository
+	passkeyRepo  *db.PasskeyRepository
+	tokenRepo    *db.OneTimeTokenRepository
+	settingRepo  *db.SettingRepository
+	providers    []*upstreamProvider
+}
+
+// NewExternalLoginService creates a new ExternalLoginService from the auth.external configuration
+func NewExternalLoginService(identityRepo *db.ExternalIdentityRepository, userRepo *db.UserRepository, roleRepo *db.RoleRepository, passkeyRepo *db.PasskeyRepository, tokenRepo *db.OneTimeTokenRepository, settingRepo *db.SettingRepository) (*ExternalLoginService, error) {
+	providers := make([]*upstreamProvider, 0, len(config.AppConfig.Auth.External.Providers))
+	seen := make(map[string]bool)
+	for _, cfg := range config.AppConfig.Auth.External.Providers {
+		if !providerNamePattern.MatchString(cfg.Name) {
+			return nil, fmt.Errorf("invalid external provider name %q", cfg.Name)
+		}
+		if seen[cfg.Name] {
+			return nil, fmt.Errorf("external provider %q is configured twice", cfg.Name)
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("external provider %q needs an issuer and a client ID", cfg.Name)
+		}
+		seen[cfg.Name] = true
+		providers = append(providers, newUpstreamProvider(cfg, externalCallbackURL(cfg.Name)))
+	}
+
+	return &ExternalLoginService{
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		passkeyRepo:  passkeyRepo,
+		tokenRepo:    tokenRepo,
+		settingRepo:  settingRepo,
+		providers:    providers,
+	}, nil
+}
+
+// ListProviders returns the configured providers with their current auto-provisioning setting
+func (s *ExternalLoginService) ListProviders(ctx context.Context) ([]ExternalProvider, error) {
+	list := make([]ExternalProvider, 0, len(s.providers))
+	for _, p := range s.providers {
+		autoProvision, err := s.autoProvision(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ExternalProvider{
+			Name:          p.cfg.Name,
+			DisplayName:   p.displayName(),
+			AutoProvision: autoProvision,
+		})
+	}
+	return list, nil
+}
+
+// SetAutoProvision controls whether signing in with a provider may create new accounts
+func (s *ExternalLoginService) SetAutoProvision(ctx context.Context, providerName string, enabled bool, adminID uint) error {
+	if s.provider(providerName) == nil {
+		return ErrUnknownProvider
+	}
+	if err := s.settingRepo.Set(ctx, models.ExternalAutoProvisionSetting(providerName), strconv.FormatBool(enabled)); err != nil {
+		return fmt.Errorf("failed to update auto-provisioning: %w", err)
+	}
+
+	logging.Log.Info("External provider auto-provisioning changed",
+		zap.String("provider", providerName),
+		zap.Bool("enabled", enabled),
+		zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// BeginLogin starts signing in with a provider. It returns the URL to send the
+// browser to and the state value, which the caller must also bind to the browser
+// for the returned duration. A non-zero linkUserID links the identity to that
+// signed-in user instead of logging in.
+func (s *ExternalLoginService) BeginLogin(ctx context.Context, providerName string, linkUserID uint) (string, string, time.Duration, error) {
+	p := s.provider(providerName)
+	if p == nil {
+		return "", "", 0, ErrUnknownProvider
+	}
+
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", 0, err
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", 0, err
+	}
+	payload := externalStatePayload{
+		Provider: providerName,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+
+	authURL, err := p.authCodeURL(ctx, state, payload.Nonce, payload.Verifier)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to encode external login state: %w", err)
+	}
+	ttl := config.AppConfig.Auth.External.StateDuration
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeExternalLogin,
+		UserID:    linkUserID,
+		TokenHash: hashToken(state),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+		Payload:   string(encoded),
+	}); err != nil {
+		return "", "", 0, fmt.Errorf("failed to store external login state: %w", err)
+	}
+
+	return authURL, state, ttl, nil
+}
+
+// CompleteLogin handles the provider's callback. It verifies the ID token and
+// resolves the local user: an existing link first, then a verified email
+// matching a verified local account, then auto-provisioning if enabled.
+// The caller issues tokens exactly as for a password login.
+func (s *ExternalLoginService) CompleteLogin(ctx context.Context, providerName, state, code string) (*ExternalLoginResult, error) {
+	p := s.provider(providerName)
+	if p == nil {
+		return nil, ErrUnknownProvider
+	}
+
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeExternalLogin, hashToken(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up external login state: %w", err)
+	}
+	if record == nil || !record.IsUsable(time.Now()) {
+		return nil, ErrInvalidExternalState
+	}
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume external login state: %w", err)
+	}
+	if !consumed {
+		return nil, ErrInvalidExternalState
+	}
+
+	var payload externalStatePayload
+	if err := json.Unmarshal([]byte(record.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode external login state: %w", err)
+	}
+	if payload.Provider != providerName {
+		return nil, ErrInvalidExternalState
+	}
+
+	claims, err := p.exchange(ctx, code, payload.Verifier, payload.Nonce)
+	if err != nil {
+		logging.Log.Warn("External sign in rejected", zap.String("provider", providerName), zap.Error(err))
+		return nil, ErrExternalLoginFailed
+	}
+
+	if record.UserID != 0 {
+		user, err := s.link(ctx, record.UserID, providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &ExternalLoginResult{User: user, Provider: providerName, Linked: true}, nil
+	}
+
+	result, err := s.resolveUser(ctx, p, claims)
+	if err != nil {
+		return nil, err
+	}
+	if result.User.Disabled {
+		return nil, ErrUserInactive
+	}
+
+	logging.Log.Info("User signed in with external provider",
+		zap.Uint("user_id", result.User.ID),
+		zap.String("provider", providerName),
+		zap.Bool("provisioned", result.Provisioned))
+	return result, nil
+}
+
+// ListIdentities returns the identities linked to a user
+func (s *ExternalLoginService) ListIdentities(ctx context.Context, userID uint) ([]models.ExternalIdentity, error) {
+	return s.identityRepo.ListForUser(ctx, userID)
+}
+
+// Unlink removes the identity a user linked at a provider, unless it is the
+// account's only way to sign in
+func (s *ExternalLoginService) Unlink(ctx context.Context, userID uint, providerName string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserInactive
+	}
+
+	identities, err := s.identityRepo.ListForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" && len(identities) <= 1 {
+		passkeys, err := s.passkeyRepo.ListForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(passkeys) == 0 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	deleted, err := s.identityRepo.DeleteForUser(ctx, userID, providerName)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrIdentityNotFound
+	}
+
+	logging.Log.Info("External identity unlinked", zap.Uint("user_id", userID), zap.String("provider", providerName))
+	return nil
+}
+
+// link attaches an identity to a signed-in user
+func (s *ExternalLoginService) link(ctx context.Context, userID uint, providerName string, claims *externalClaims) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, ErrUserInactive
+	}
+
+	existing, err := s.identityRepo.GetBySubject(ctx, providerName, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityLinked
+		}
+		return user, s.identityRepo.RecordLogin(ctx, existing.ID, claims.Email)
+	}
+
+	if err := s.createIdentity(ctx, user.ID, providerName, claims); err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("External identity linked", zap.Uint("user_id", user.ID), zap.String("provider", providerName))
+	return user, nil
+}
+
+// resolveUser finds or creates the local user for a verified identity
+func (s *ExternalLoginService) resolveUser(ctx context.Context, p *upstreamProvider, claims *externalClaims) (*ExternalLoginResult, error) {
+	result := &ExternalLoginResult{Provider: p.cfg.Name}
+
+	identity, err := s.identityRepo.GetBySubject(ctx, p.cfg.Name, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserInactive
+		}
+		if err := s.identityRepo.RecordLogin(ctx, identity.ID, claims.Email); err != nil {
+			return nil, err
+		}
+		result.User = user
+		return result, nil
+	}
+
+	// Without a link, only an address the provider vouches for can be matched or used
+	email := normalizeEmail(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return nil, ErrNoLinkedAccount
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		// An unverified local account may have been registered by someone else
+		if !user.IsEmailVerified() {
+			return nil, ErrNoLinkedAccount
+		}
+		linked, err := s.identityRepo.GetForUser(ctx, user.ID, p.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		if linked != nil {
+			return nil, ErrProviderAlreadyLinked
+		}
+		if err := s.createIdentity(ctx, user.ID, p.cfg.Name, claims); err != nil {
+			return nil, err
+		}
+
+		logging.Log.Info("External identity linked by verified email", zap.Uint("user_id", user.ID), zap.String("provider", p.cfg.Name))
+		result.User = user
+		return result, nil
+	}
+
+	autoProvision, err := s.autoProvision(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if !autoProvision {
+		return nil, ErrNoLinkedAccount
+	}
+
+	inUse, err := s.userRepo.EmailInUse(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if inUse {
+		return nil, ErrNoLinkedAccount
+	}
+
+	result.User, err = s.provisionUser(ctx, p.cfg.Name, email, claims)
+	if err != nil {
+		return nil, err
+	}
+	result.Provisioned = true
+	return result, nil
+}
+
+// provisionUser creates an account without a password for a new identity.
+// If linking fails the account is still matched by its verified email next time.
+func (s *ExternalLoginService) provisionUser(ctx context.Context, providerName, email string, claims *externalClaims) (*models.User, error) {
+	role, err := s.roleRepo.GetByName(ctx, config.AppConfig.Auth.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("default role %q does not exist", config.AppConfig.Auth.DefaultRole)
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = email
+	}
+	now := time.Now().UTC()
+	user := &models.User{
+		Email:           email,
+		Name:            name,
+		Roles:           []models.Role{*role},
+		EmailVerifiedAt: &now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := s.createIdentity(ctx, user.ID, providerName, claims); err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("User provisioned from external provider", zap.Uint("user_id", user.ID), zap.String("provider", providerName))
+	return user, nil
+}
+
+// createIdentity stores a new link between a provider subject and a user
+func (s *ExternalLoginService) createIdentity(ctx context.Context, userID uint, providerName string, claims *externalClaims) error {
+	now := time.Now().UTC()
+	if err := s.identityRepo.Create(ctx, &models.ExternalIdentity{
+		UserID:      userID,
+		Provider:    providerName,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return fmt.Errorf("failed to link external identity: %w", err)
+	}
+	return nil
+}
+
+// autoProvision reports whether a provider may create accounts, falling back to the configured default
+func (s *ExternalLoginService) autoProvision(ctx context.Context, p *upstreamProvider) (bool, error) {
+	value, err := s.settingRepo.Get(ctx, models.ExternalAutoProvisionSetting(p.cfg.Name), strconv.FormatBool(p.cfg.AutoProvision))
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// provider returns the configured provider with the given name, or nil
+func (s *ExternalLoginService) provider(name string) *upstreamProvider {
+	for _, p := range s.providers {
+		if p.cfg.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ExternalLoginRedirect returns the UI page that receives the result of an
+// external sign in. The values go in the URL fragment so they never reach a server log.
+func ExternalLoginRedirect(values url.Values) string {
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.Auth.External.UIRedirect + "#" + values.Encode()
+}
+
+// ExternalLoginPath returns the path under which the sign in and callback endpoints live
+func ExternalLoginPath() string {
+	return config.AppConfig.API.BaseURL + "/auth/external"
+}
+
+// externalCallbackURL returns the redirect URI registered with a provider
+func externalCallbackURL(providerName string) string {
+	return publicLink(ExternalLoginPath()+"/"+providerName+"/callback", nil)
+}
+
+// upstreamProvider talks to one upstream OpenID Connect provider. Discovery
+// happens on first use so that an unreachable provider does not stop the service.
+type upstreamProvider struct {
+	cfg         config.ExternalProviderConfig
+	redirectURL string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// newUpstreamProvider creates a provider client that redirects back to redirectURL
+func newUpstreamProvider(cfg config.ExternalProviderConfig, redirectURL string) *upstreamProvider {
+	return &upstreamProvider{cfg: cfg, redirectURL: redirectURL}
+}
+
+// displayName returns the label shown on the login page
+func (p *upstreamProvider) displayName() string {
+	if p.cfg.DisplayName != "" {
+		return p.cfg.DisplayName
+	}
+	return p.cfg.Name
+}
+
+// discover fetches and caches the provider's discovery document
+func (p *upstreamProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover provider %q: %w", p.cfg.Name, err)
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+// oauth2Config returns the client configuration for the provider's endpoints
+func (p *upstreamProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	// Upstream scopes are passed through as configured; only openid is required
+	if !containsScope(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// authCodeURL builds the provider's authorization URL with the state, nonce and PKCE challenge
+func (p *upstreamProvider) authCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return p.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// exchange redeems an authorization code and verifies the returned ID token
+func (p *upstreamProvider) exchange(ctx context.Context, code, verifier, nonce string) (*externalClaims, error) {
+	provider, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims externalClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	return &claims, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shashank/home-server/common/config"
+)
+
+// mockProvider is a minimal upstream OpenID Connect provider for tests
+type mockProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string // PKCE challenge from the last authorization request
+	nonce     string // nonce to put in issued ID tokens
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	m := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   m.server.URL,
+			"aud":   "home-server",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": m.nonce,
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Errorf("failed to sign id_token: %v", err)
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "upstream-access",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestUpstreamProviderLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	p := newUpstreamProvider(config.ExternalProviderConfig{
+		Name:         "mock",
+		Issuer:       mock.server.URL,
+		ClientID:     "home-server",
+		ClientSecret: "secret",
+	}, "http://localhost:8080/api/v1/auth/external/mock/callback")
+	ctx := context.Background()
+
+	authURL, err := p.authCodeURL(ctx, "state-1", "nonce-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatalf("authCodeURL() error: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL is missing parameters: %s", authURL)
+	}
+	if query.Get("scope") != "openid email profile" {
+		t.Errorf("scope = %q, want the default scopes", query.Get("scope"))
+	}
+	mock.challenge = query.Get("code_challenge")
+	mock.nonce = "nonce-1"
+	mock.claims = jwt.MapClaims{"sub": "user-42", "email": "alice@example.com", "email_verified": true, "name": "Alice"}
+
+	claims, err := p.exchange(ctx, "good-code", "verifier-0123456789-0123456789-0123456789", "nonce-1")
+	if err != nil {
+		t.Fatalf("exchange() error: %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	if _, err := p.exchange(ctx, "good-code", "wrong-verifier-0123456789-0123456789-0123", "nonce-1"); err == nil {
+		t.Error("expected a wrong PKCE verifier to be rejected")
+	}
+	if _, err := p.exchange(ctx, "good-code", "verifier-0123456789-0123456789-0123456789", "other-nonce"); err == nil {
+		t.Error("expected a mismatched nonce to be rejected")
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned by forward-auth checks
+var (
+	ErrForwardAuthRequired = errors.New("sign-in required")
+	ErrForwardAccessDenied = errors.New("you do not have access to this app")
+	ErrForwardUnknownApp   = errors.New("unknown forward-auth app")
+)
+
+// ForwardIdentity is the user a forward-auth check succeeded for, passed on to the app
+type ForwardIdentity struct {
+	User  *models.User
+	Roles []string
+}
+
+// ForwardAuthService checks requests to apps that rely on a reverse proxy for
+// their login. Users sign in once and get a cookie that every such app accepts;
+// API clients can send an access token instead.
+type ForwardAuthService struct {
+	userRepo    *db.UserRepository
+	roleRepo    *db.RoleRepository
+	authService *AuthService
+}
+
+// NewForwardAuthService creates a new ForwardAuthService
+func NewForwardAuthService(userRepo *db.UserRepository, roleRepo *db.RoleRepository, authService *AuthService) *ForwardAuthService {
+	return &ForwardAuthService{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		authService: authService,
+	}
+}
+
+// ForwardLoginURL returns the URL of the forward-auth login page
+func ForwardLoginURL() string {
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.API.BaseURL + "/auth/forward/login"
+}
+
+// ForwardCookie returns the name and domain of the forward-auth cookie
+func ForwardCookie() (string, string) {
+	cfg := config.AppConfig.Auth.ForwardAuth
+	return cfg.CookieName, cfg.CookieDomain
+}
+
+// CreateSession starts a login session for the forward-auth cookie and returns
+// the cookie's signed value and lifetime. The session is listed with the user's
+// other devices and can be signed out like them.
+func (s *ForwardAuthService) CreateSession(ctx context.Context, user *models.User) (string, time.Duration, error) {
+	jti, err := generateID()
+	if err != nil {
+		return "", 0, err
+	}
+	familyID, err := generateID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	duration := config.AppConfig.Auth.ForwardAuth.SessionDuration
+	if err := s.authService.recordSession(ctx, user.ID, familyID, now, now.Add(duration)); err != nil {
+		return "", 0, err
+	}
+
+	session, err := signJWT(models.JWTClaims{
+		UserID:  strconv.Itoa(int(user.ID)),
+		Email:   user.Email,
+		Type:    models.TokenTypeForward,
+		Session: familyID,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    config.AppConfig.JWT.Issuer,
+			Subject:   strconv.Itoa(int(user.ID)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		},
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign forward-auth session: %w", err)
+	}
+	return session, duration, nil
+}
+
+// Verify checks a request to a protected app. An access token is used when the
+// request has one, otherwise the session cookie. A check without an app name is
+// rejected, so a proxy rule that forgets it does not let every user in.
+func (s *ForwardAuthService) Verify(ctx context.Context, app, accessToken, session string) (*ForwardIdentity, error) {
+	allowed, ok := forwardApp(app)
+	if !ok {
+		logging.Log.Warn("Forward-auth check for unknown app", zap.String("app", app))
+		return nil, ErrForwardUnknownApp
+	}
+
+	var user *models.User
+	var err error
+	if accessToken != "" {
+		user, err = s.accessTokenUser(ctx, accessToken)
+	} else {
+		user, _, err = s.sessionUser(ctx, session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Roles are read fresh, so role changes apply without signing in again
+	userRoles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	roles := models.RoleNames(userRoles)
+
+	if !hasAnyRole(roles, allowed.Roles) {
+		logging.Log.Info("Forward-auth access denied",
+			zap.Uint("user_id", user.ID),
+			zap.String("app", app),
+			zap.Strings("roles", roles))
+		return nil, ErrForwardAccessDenied
+	}
+
+	return &ForwardIdentity{User: user, Roles: roles}, nil
+}
+
+// SignedIn reports whether a forward-auth cookie belongs to a signed-in user
+func (s *ForwardAuthService) SignedIn(ctx context.Context, session string) bool {
+	user, _, err := s.sessionUser(ctx, session)
+	return err == nil && user != nil
+}
+
+// Logout ends the login session of a forward-auth cookie, so that copies of the
+// cookie stop working too
+func (s *ForwardAuthService) Logout(ctx context.Context, session string) error {
+	_, claims, err := s.sessionUser(ctx, session)
+	if errors.Is(err, ErrForwardAuthRequired) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.authService.Logout(ctx, claims)
+}
+
+// accessTokenUser returns the active user of an access token
+func (s *ForwardAuthService) accessTokenUser(ctx context.Context, accessToken string) (*models.User, error) {
+	claims, err := validateTokenOfType(accessToken, models.TokenTypeAccess)
+	if err != nil {
+		return nil, ErrForwardAuthRequired
+	}
+	return s.requireActiveUser(ctx, claims.UserID)
+}
+
+// sessionUser returns the active user of a forward-auth cookie and its claims.
+// The cookie's login session must not have been signed out.
+func (s *ForwardAuthService) sessionUser(ctx context.Context, session string) (*models.User, *models.JWTClaims, error) {
+	if session == "" {
+		return nil, nil, ErrForwardAuthRequired
+	}
+	claims, err := validateTokenOfType(session, models.TokenTypeForward)
+	if err != nil || claims.Session == "" {
+		return nil, nil, ErrForwardAuthRequired
+	}
+
+	active, err := s.authService.sessionActive(ctx, claims.Session)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !active {
+		return nil, nil, ErrForwardAuthRequired
+	}
+
+	user, err := s.requireActiveUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, claims, nil
+}
+
+// requireActiveUser loads a user by ID string, returning ErrForwardAuthRequired
+// if they are deleted or disabled
+func (s *ForwardAuthService) requireActiveUser(ctx context.Context, id string) (*models.User, error) {
+	user, err := s.activeUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrForwardAuthRequired
+	}
+	return user, nil
+}
+
+// SafeRedirect checks a return URL from the login page, so that it cannot be
+// used to send users to other sites. Relative paths and URLs on the public_url
+// host or within the cookie domain are allowed.
+func SafeRedirect(rd string) (string, bool) {
+	target, err := url.Parse(rd)
+	if err != nil || rd == "" {
+		return "", false
+	}
+
+	if target.Scheme == "" && target.Host == "" {
+		// "//host" and "/\host" are treated by browsers as other sites
+		if !strings.HasPrefix(rd, "/") || strings.HasPrefix(rd, "//") || strings.HasPrefix(rd, "/\\") {
+			return "", false
+		}
+		return rd, true
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" || target.User != nil {
+		return "", false
+	}
+	host := strings.ToLower(target.Hostname())
+
+	if public, err := url.Parse(config.AppConfig.Auth.PublicURL); err == nil && host == strings.ToLower(public.Hostname()) {
+		return target.String(), true
+	}
+	domain := strings.ToLower(strings.TrimPrefix(config.AppConfig.Auth.ForwardAuth.CookieDomain, "."))
+	if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+		return target.String(), true
+	}
+	return "", false
+}
+
+// activeUser loads a user by ID string, returning nil if they are deleted or disabled
+func (s *ForwardAuthService) activeUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := s.userRepo.GetByID(ctx, uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// forwardApp returns the configuration of a protected app
+func forwardApp(name string) (config.ForwardAuthAppConfig, bool) {
+	for _, app := range config.AppConfig.Auth.ForwardAuth.Apps {
+		if app.Name == name {
+			return app, true
+		}
+	}
+	return config.ForwardAuthAppConfig{}, false
+}
+
+// hasAnyRole reports whether the user has one of the allowed roles. No allowed
+// roles means any user may pass.
+func hasAnyRole(roles, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, role := range allowed {
+		if containsScope(roles, role) {
+			return true
+		}
+	}
+	return false
+}
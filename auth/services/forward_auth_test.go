@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	previous := config.AppConfig
+	defer func() { config.AppConfig = previous }()
+	config.AppConfig = &config.Config{}
+	config.AppConfig.Auth.PublicURL = "https://home.example.com"
+	config.AppConfig.Auth.ForwardAuth.CookieDomain = ".apps.example.com"
+
+	tests := []struct {
+		rd   string
+		safe bool
+	}{
+		{"/an/dashboard", true},
+		{"https://home.example.com/apps/wiki/", true},
+		{"https://wiki.apps.example.com/page?x=1", true},
+		{"http://apps.example.com/", true},
+		{"", false},
+		{"//evil.com/", false},
+		{"/\\evil.com", false},
+		{"relative/path", false},
+		{"https://evil.com/", false},
+		{"https://home.example.com.evil.com/", false},
+		{"https://evilapps.example.com/", false},
+		{"javascript:alert(1)", false},
+		{"https://user@home.example.com/", false},
+	}
+	for _, tt := range tests {
+		if _, ok := SafeRedirect(tt.rd); ok != tt.safe {
+			t.Errorf("SafeRedirect(%q) safe = %v, want %v", tt.rd, ok, tt.safe)
+		}
+	}
+}
+
+func TestHasAnyRole(t *testing.T) {
+	if !hasAnyRole([]string{"guest"}, nil) {
+		t.Error("expected an app without roles to allow every user")
+	}
+	if !hasAnyRole([]string{"guest", "family"}, []string{"admin", "family"}) {
+		t.Error("expected a matching role to be allowed")
+	}
+	if hasAnyRole([]string{"guest"}, []string{"admin"}) {
+		t.Error("expected a user without a matching role to be denied")
+	}
+}
+
+func TestVerifyRequiresAConfiguredApp(t *testing.T) {
+	previous := config.AppConfig
+	defer func() { config.AppConfig = previous }()
+	config.AppConfig = &config.Config{}
+	config.AppConfig.Auth.ForwardAuth.Apps = []config.ForwardAuthAppConfig{{Name: "wiki"}}
+	previousLog := logging.Log
+	defer func() { logging.Log = previousLog }()
+	logging.Log = zap.NewNop()
+
+	s := &ForwardAuthService{}
+	for _, app := range []string{"", "photos"} {
+		if _, err := s.Verify(context.Background(), app, "", "session"); !errors.Is(err, ErrForwardUnknownApp) {
+			t.Errorf("Verify(app=%q) = %v, want ErrForwardUnknownApp", app, err)
+		}
+	}
+}
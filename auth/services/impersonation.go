@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// maxImpersonationReason bounds the reason stored with the audit event
+const maxImpersonationReason = 255
+
+// Errors returned by impersonation
+var (
+	ErrAlreadyImpersonating   = errors.New("already impersonating a user")
+	ErrNotImpersonating       = errors.New("not an impersonation session")
+	ErrCannotImpersonateSelf  = errors.New("admins cannot impersonate themselves")
+	ErrCannotImpersonateAdmin = errors.New("users who can manage users cannot be impersonated")
+)
+
+// ImpersonationToken is an access token for an admin acting as another user
+type ImpersonationToken struct {
+	AccessToken string
+	ExpiresIn   int64
+	User        *models.User
+	Roles       []string
+}
+
+// actorKey is the context key for the ID of an impersonating admin
+type actorKey struct{}
+
+// WithActor returns a context recording that an admin is acting as the
+// request's user, so that audit events name both of them
+func WithActor(ctx context.Context, actorID uint) context.Context {
+	return context.WithValue(ctx, actorKey{}, actorID)
+}
+
+// ActorFrom returns the impersonating admin stored in the context, or 0
+func ActorFrom(ctx context.Context) uint {
+	actorID, _ := ctx.Value(actorKey{}).(uint)
+	return actorID
+}
+
+// ImpersonationService lets admins see the app as another user. Impersonation
+// tokens are access tokens for the user with an "act" claim naming the admin;
+// they cannot be refreshed and expire after auth.impersonation_duration at most.
+// They are revoked with the admin's session or token version, so signing the
+// admin out, disabling or demoting them ends their impersonations.
+type ImpersonationService struct {
+	userRepo    *db.UserRepository
+	roleRepo    *db.RoleRepository
+	authService *AuthService
+}
+
+// NewImpersonationService creates a new ImpersonationService
+func NewImpersonationService(userRepo *db.UserRepository, roleRepo *db.RoleRepository, authService *AuthService) *ImpersonationService {
+	return &ImpersonationService{
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		authService: authService,
+	}
+}
+
+// Start issues a token for the admin to act as the target user. A zero or too
+// long duration is replaced by the configured maximum.
+func (s *ImpersonationService) Start(ctx context.Context, admin *models.JWTClaims, targetID uint, duration time.Duration, reason string) (*ImpersonationToken, error) {
+	if admin.IsImpersonation() {
+		return nil, ErrAlreadyImpersonating
+	}
+	adminID, err := strconv.ParseUint(admin.UserID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id in claims: %w", err)
+	}
+	if uint(adminID) == targetID {
+		return nil, ErrCannotImpersonateSelf
+	}
+
+	user, err := s.userRepo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Disabled {
+		return nil, ErrUserInactive
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user roles: %w", err)
+	}
+	// Acting as another admin would hand over their powers without a trace of their consent
+	permissions := models.PermissionNames(roles)
+	if containsScope(permissions, models.PermissionUsersManage) {
+		return nil, ErrCannotImpersonateAdmin
+	}
+
+	if maxDuration := config.AppConfig.Auth.ImpersonationDuration; duration <= 0 || duration > maxDuration {
+		duration = maxDuration
+	}
+
+	jti, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessToken, err := signJWT(models.JWTClaims{
+		UserID:      strconv.Itoa(int(user.ID)),
+		Email:       user.Email,
+		Roles:       models.RoleNames(roles),
+		Permissions: permissions,
+		Type:        models.TokenTypeAccess,
+		Version:     user.TokenVersion,
+		Actor:       &models.Actor{Subject: admin.UserID, Email: admin.Email, Session: admin.Session, Version: admin.Version},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    config.AppConfig.JWT.Issuer,
+			Subject:   strconv.Itoa(int(user.ID)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	event := NewAuthEvent(models.AuthEventImpersonationStart, user.ID, nil)
+	actorID := uint(adminID)
+	event.ActorID = &actorID
+	event.Reason = strings.TrimSpace(reason)
+	if len(event.Reason) > maxImpersonationReason {
+		event.Reason = event.Reason[:maxImpersonationReason]
+	}
+	s.authService.RecordEvent(ctx, event)
+
+	logging.Log.Warn("Impersonation started",
+		zap.Uint("admin_id", actorID),
+		zap.Uint("user_id", user.ID),
+		zap.Duration("duration", duration),
+		zap.String("jti", jti))
+
+	return &ImpersonationToken{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(duration.Seconds()),
+		User:        user,
+		Roles:       models.RoleNames(roles),
+	}, nil
+}
+
+// End revokes an impersonation token before it expires
+func (s *ImpersonationService) End(ctx context.Context, claims *models.JWTClaims) error {
+	if !claims.IsImpersonation() {
+		return ErrNotImpersonating
+	}
+	userID, err := strconv.ParseUint(claims.UserID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user id in claims: %w", err)
+	}
+
+	if err := s.authService.revokeAccessToken(ctx, claims.ID, uint(userID), claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventImpersonationEnd, uint(userID), nil))
+	logging.Log.Warn("Impersonation ended",
+		zap.String("admin_id", claims.Actor.Subject),
+		zap.Uint("user_id", uint(userID)),
+		zap.String("jti", claims.ID))
+	return nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestActorFrom(t *testing.T) {
+	if got := ActorFrom(context.Background()); got != 0 {
+		t.Errorf("ActorFrom(empty context) = %d, want 0", got)
+	}
+	if got := ActorFrom(WithActor(context.Background(), 3)); got != 3 {
+		t.Errorf("ActorFrom() = %d, want 3", got)
+	}
+}
+
+func TestActorClaim(t *testing.T) {
+	claims := models.JWTClaims{UserID: "7", Actor: &models.Actor{Subject: "1", Email: "admin@example.com", Session: "family-1", Version: 2}}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("failed to encode claims: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"act":{"sub":"1","email":"admin@example.com","sid":"family-1","ver":2}`) {
+		t.Errorf("encoded claims = %s, want an act claim naming the admin", encoded)
+	}
+
+	var decoded models.JWTClaims
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("failed to decode claims: %v", err)
+	}
+	if !decoded.IsImpersonation() || decoded.Actor.Subject != "1" {
+		t.Errorf("decoded actor = %+v, want subject 1", decoded.Actor)
+	}
+	if (&models.JWTClaims{UserID: "7"}).IsImpersonation() {
+		t.Error("expected a token without act not to be an impersonation")
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Introspection is a token introspection response (RFC 7662). Inactive tokens
+// only report active=false, so callers cannot tell a revoked token from a forged one.
+type Introspection struct {
+	Active      bool          `json:"active"`
+	Type        string        `json:"type,omitempty"` // "access", "oidc_access" or "service"
+	Subject     string        `json:"sub,omitempty"`
+	Username    string        `json:"username,omitempty"` // email of the user the token was issued to
+	ClientID    string        `json:"client_id,omitempty"`
+	Scope       string        `json:"scope,omitempty"`
+	Roles       []string      `json:"roles,omitempty"`
+	Permissions []string      `json:"permissions,omitempty"`
+	SessionID   string        `json:"sid,omitempty"`
+	Actor       *models.Actor `json:"act,omitempty"` // admin impersonating the user
+	Issuer      string        `json:"iss,omitempty"`
+	Audience    []string      `json:"aud,omitempty"`
+	IssuedAt    int64         `json:"iat,omitempty"`
+	ExpiresAt   int64         `json:"exp,omitempty"`
+	JWTID       string        `json:"jti,omitempty"`
+}
+
+// introspectableTypes are the token types handed to clients as bearer tokens
+var introspectableTypes = []string{models.TokenTypeAccess, models.TokenTypeOIDCAccess, models.TokenTypeService}
+
+// IntrospectionEndpoint returns the URL of the introspection endpoint
+func IntrospectionEndpoint() string {
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.API.BaseURL + "/auth/introspect"
+}
+
+// Introspect reports whether a token is currently valid and what it grants.
+// Only service accounts may introspect tokens. Tokens that are malformed,
+// expired, not signed by this service or of another type are simply inactive.
+func (s *OIDCService) Introspect(ctx context.Context, clientID, secret, token string) (*Introspection, error) {
+	account, err := s.serviceAccounts.authenticate(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := parseToken(token)
+	if err != nil || !containsScope(introspectableTypes, claims.Type) {
+		return &Introspection{Active: false}, nil
+	}
+	if revocations.IsRevoked(claims) {
+		return &Introspection{Active: false}, nil
+	}
+
+	// Tokens stop being active when the user or service account they were
+	// issued to is deleted or disabled
+	if claims.Type == models.TokenTypeService {
+		subject, err := s.serviceAccounts.activeAccount(ctx, claims.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if subject == nil {
+			return &Introspection{Active: false}, nil
+		}
+	} else {
+		user, err := s.activeUser(ctx, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return &Introspection{Active: false}, nil
+		}
+	}
+
+	result := &Introspection{
+		Active:      true,
+		Type:        claims.Type,
+		Subject:     claims.Subject,
+		Username:    claims.Email,
+		ClientID:    claims.ClientID,
+		Scope:       claims.Scope,
+		Roles:       claims.Roles,
+		Permissions: claims.Permissions,
+		SessionID:   claims.Session,
+		Actor:       claims.Actor,
+		Issuer:      claims.Issuer,
+		Audience:    claims.Audience,
+		JWTID:       claims.ID,
+	}
+	if claims.IssuedAt != nil {
+		result.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.ExpiresAt != nil {
+		result.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+
+	logging.Log.Debug("Token introspected",
+		zap.String("client_id", account.ClientID),
+		zap.String("type", claims.Type),
+		zap.String("sub", claims.Subject))
+	return result, nil
+}
+
+// CurrentUserInfo returns claims about the user a token was issued to. Tokens
+// from a login get the user's profile, roles and permissions; tokens issued to
+// OIDC clients only get the claims their scopes allow, as at the OIDC userinfo endpoint.
+func (s *OIDCService) CurrentUserInfo(ctx context.Context, token string) (map[string]interface{}, error) {
+	claims, err := parseToken(token)
+	if err != nil || revocations.IsRevoked(claims) {
+		return nil, ErrOAuthInvalidToken
+	}
+	if claims.Type != models.TokenTypeAccess && claims.Type != models.TokenTypeOIDCAccess {
+		return nil, ErrOAuthInvalidToken
+	}
+
+	user, err := s.activeUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrOAuthInvalidToken
+	}
+
+	if claims.Type == models.TokenTypeOIDCAccess {
+		return s.userClaims(ctx, user, strings.Fields(claims.Scope))
+	}
+
+	info, err := s.userClaims(ctx, user, []string{models.ScopeProfile, models.ScopeEmail})
+	if err != nil {
+		return nil, err
+	}
+	// Roles are read fresh, so they may be newer than the token's
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	info["roles"] = models.RoleNames(roles)
+	info["permissions"] = models.PermissionNames(roles)
+	return info, nil
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Invitation codes are short enough to read out or type: 10 characters from an
+// alphabet without look-alikes (0/O, 1/I/L), shown as XXXXX-XXXXX. That gives
+// about 50 bits, plenty for a code that expires and can only be tried
+// auth.invite_attempts_per_ip times an hour from one client.
+const (
+	inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	inviteCodeLength   = 10
+)
+
+// ErrInvitationNotFound is returned for unknown or already revoked invitations
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+// InvitationInput holds the settings of a new invitation. Zero values get defaults:
+// the configured default role, one use and the configured invite lifetime.
+type InvitationInput struct {
+	Email     string
+	Role      string
+	MaxUses   int
+	ExpiresAt time.Time
+}
+
+// CreatedInvitation is a new invitation with the code and link to hand out.
+// The code cannot be retrieved again later.
+type CreatedInvitation struct {
+	Invitation *models.Invitation
+	Code       string
+	Link       string
+}
+
+// CreateInvitation issues an invitation and emails it when it is bound to an address
+func (s *RegistrationService) CreateInvitation(ctx context.Context, input InvitationInput, createdBy uint) (*CreatedInvitation, error) {
+	roleName := input.Role
+	if roleName == "" {
+		roleName = config.AppConfig.Auth.DefaultRole
+	}
+	role, err := s.roleRepo.GetByName(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownRole, roleName)
+	}
+
+	maxUses := input.MaxUses
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	expiresAt := input.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(config.AppConfig.Auth.InviteTokenDuration)
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		Email:     normalizeEmail(input.Email),
+		RoleID:    role.ID,
+		Role:      *role,
+		CodeHash:  hashToken(normalizeInviteCode(code)),
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedBy: createdBy,
+	}
+	if err := s.invitationRepo.Create(ctx, invitation); err != nil {
+		return nil, fmt.Errorf("failed to store invitation: %w", err)
+	}
+
+	query := url.Values{"invite": {code}}
+	if invitation.Email != "" {
+		query.Set("email", invitation.Email)
+	}
+	link := publicLink("/an/register", query)
+
+	if invitation.Email != "" {
+		if err := s.mailer.Send(ctx, mail.Message{
+			To:      invitation.Email,
+			Subject: "You're invited to Home Server",
+			Body: fmt.Sprintf("You have been invited to create an account.\n\n"+
+				"Open this link to sign up:\n%s\n\n"+
+				"Or use this invite code: %s\n\n"+
+				"The invite expires on %s.\n",
+				link, code, invitation.ExpiresAt.Format(time.RFC1123)),
+		}); err != nil {
+			logging.Log.Error("Failed to send invite email", zap.Error(err))
+		}
+	}
+
+	logging.Log.Info("Invitation created",
+		zap.Uint("invitation_id", invitation.ID),
+		zap.Uint("created_by", createdBy),
+		zap.String("role", role.Name),
+		zap.Int("max_uses", maxUses),
+		zap.Time("expires_at", invitation.ExpiresAt))
+
+	return &CreatedInvitation{Invitation: invitation, Code: code, Link: link}, nil
+}
+
+// ListInvitations returns invitations newest first, by default only those that
+// can still be redeemed
+func (s *RegistrationService) ListInvitations(ctx context.Context, includeInactive bool) ([]models.Invitation, error) {
+	return s.invitationRepo.List(ctx, includeInactive)
+}
+
+// RevokeInvitation stops an invitation from being redeemed. Accounts already
+// created with it are not affected.
+func (s *RegistrationService) RevokeInvitation(ctx context.Context, id uint) error {
+	revoked, err := s.invitationRepo.Revoke(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	if !revoked {
+		return ErrInvitationNotFound
+	}
+
+	logging.Log.Info("Invitation revoked", zap.Uint("invitation_id", id))
+	return nil
+}
+
+// LookupInvitation returns a redeemable invitation by its code, so that the sign
+// up page can show the invited address and role
+func (s *RegistrationService) LookupInvitation(ctx context.Context, code, clientIP string) (*models.Invitation, error) {
+	if !s.ipLimiter.Allow(clientIP) {
+		logging.Log.Warn("Invite lookup rate limit exceeded", zap.String("ip", clientIP))
+		return nil, ErrRateLimited
+	}
+	return s.lookupInvitation(ctx, code)
+}
+
+// lookupInvitation is LookupInvitation without the rate limit, for callers that applied it
+func (s *RegistrationService) lookupInvitation(ctx context.Context, code string) (*models.Invitation, error) {
+	invitation, err := s.invitationRepo.GetByCodeHash(ctx, hashToken(normalizeInviteCode(code)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up invitation: %w", err)
+	}
+	if invitation == nil || !invitation.IsUsable(time.Now()) {
+		return nil, ErrInvalidInvite
+	}
+	return invitation, nil
+}
+
+// generateInviteCode returns a random code formatted as XXXXX-XXXXX
+func generateInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeLength)
+	code := make([]byte, 0, inviteCodeLength+1)
+	for len(code) < inviteCodeLength+1 {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate invite code: %w", err)
+		}
+		for _, b := range buf {
+			// Rejection sampling keeps every character equally likely
+			if int(b) >= 256-256%len(inviteCodeAlphabet) {
+				continue
+			}
+			if len(code) == inviteCodeLength/2 {
+				code = append(code, '-')
+			}
+			code = append(code, inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)])
+			if len(code) == inviteCodeLength+1 {
+				break
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// normalizeInviteCode makes short codes case and separator insensitive. Other
+// values, such as long codes from invites issued before short codes, are only trimmed.
+func normalizeInviteCode(code string) string {
+	code = strings.TrimSpace(code)
+	compact := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(compact) != inviteCodeLength {
+		return code
+	}
+	for _, c := range compact {
+		if !strings.ContainsRune(inviteCodeAlphabet, c) {
+			return code
+		}
+	}
+	return compact
+}
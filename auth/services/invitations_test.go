@@ -0,0 +1,45 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateInviteCode(t *testing.T) {
+	format := regexp.MustCompile(`^[` + inviteCodeAlphabet + `]{5}-[` + inviteCodeAlphabet + `]{5}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			t.Fatalf("generateInviteCode() error: %v", err)
+		}
+		if !format.MatchString(code) {
+			t.Fatalf("generateInviteCode() = %q, want XXXXX-XXXXX from the code alphabet", code)
+		}
+		if seen[code] {
+			t.Fatalf("generateInviteCode() repeated %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeInviteCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"ABCDE-FGHJK", "ABCDEFGHJK"},
+		{" abcde-fghjk ", "ABCDEFGHJK"},
+		{"abcde fghjk", "ABCDEFGHJK"},
+		// Codes from before short codes are case sensitive and kept as they are
+		{"Qm9vLWxvbmctb3BhcXVlLXRva2VuLXZhbHVlLWhlcmU", "Qm9vLWxvbmctb3BhcXVlLXRva2VuLXZhbHVlLWhlcmU"},
+		// Look-alike characters are not in the alphabet, so the value is left alone
+		{"abcde-fghj0", "abcde-fghj0"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeInviteCode(tt.input); got != tt.want {
+			t.Errorf("normalizeInviteCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
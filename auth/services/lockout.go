@@ -0,0 +1,265 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// LoginThrottledError is returned when an account must wait before another
+// password attempt, either because of progressive delays or a lockout
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "account is temporarily locked after too many failed login attempts"
+	}
+	return "too many failed login attempts, please wait before trying again"
+}
+
+const (
+	// unknownLoginRetention is how long failed logins for emails without an account are remembered
+	unknownLoginRetention = 24 * time.Hour
+	// unknownLoginCapacity bounds how many emails without an account are tracked at once
+	unknownLoginCapacity = 10000
+	// maxClaimRetries is how often an attempt re-reads the counters after losing a race
+	maxClaimRetries = 3
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// unknownEmailLogins throttles and locks emails without an account exactly like
+// real accounts, so that a 429 does not reveal whether an account exists
+var unknownEmailLogins = newFailedLoginTracker(unknownLoginCapacity)
+
+// failedLoginTracker keeps the failed login counters of unknown emails in memory.
+// Entries use the lockout fields of models.User so that checkLoginThrottle applies.
+// At most capacity emails are kept; the one that failed longest ago is dropped
+// first, which only ever forgets emails that have no account to protect.
+type failedLoginTracker struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recent failure first
+}
+
+// trackedLogin is a failedLoginTracker entry
+type trackedLogin struct {
+	email string
+	user  models.User
+}
+
+// newFailedLoginTracker creates a tracker holding at most capacity emails
+func newFailedLoginTracker(capacity int) *failedLoginTracker {
+	return &failedLoginTracker{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// checkAndRecord rejects an attempt for the email while it is throttled or
+// locked, and otherwise counts it as failed, locking the email at the same
+// threshold as accounts. Both happen under one lock so that parallel attempts
+// cannot all pass the throttle.
+func (t *failedLoginTracker) checkAndRecord(cfg config.LockoutConfig, email string, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(now)
+
+	element := t.entries[email]
+	if element == nil {
+		element = t.order.PushFront(&trackedLogin{email: email})
+		t.entries[email] = element
+		for t.order.Len() > t.capacity {
+			t.remove(t.order.Back())
+		}
+	}
+
+	entry := &element.Value.(*trackedLogin).user
+	if err := checkLoginThrottle(cfg, entry, now); err != nil {
+		return err
+	}
+
+	t.order.MoveToFront(element)
+	entry.FailedLoginAttempts++
+	lastFailure := now
+	entry.LastFailedLoginAt = &lastFailure
+	if entry.FailedLoginAttempts >= cfg.Threshold {
+		lockedUntil := now.Add(cfg.Duration)
+		entry.LockedUntil = &lockedUntil
+	}
+	return nil
+}
+
+// expire drops emails whose last failure is older than unknownLoginRetention
+func (t *failedLoginTracker) expire(now time.Time) {
+	for element := t.order.Back(); element != nil; element = t.order.Back() {
+		entry := &element.Value.(*trackedLogin).user
+		if entry.LastFailedLoginAt != nil && (now.Sub(*entry.LastFailedLoginAt) <= unknownLoginRetention || entry.IsLocked(now)) {
+			return
+		}
+		t.remove(element)
+	}
+}
+
+// remove drops a tracked email
+func (t *failedLoginTracker) remove(element *list.Element) {
+	delete(t.entries, element.Value.(*trackedLogin).email)
+	t.order.Remove(element)
+}
+
+// burnPasswordCheck spends the same time as a real password comparison so that
+// logins for unknown emails cannot be told apart by response time
+func burnPasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hashPassword("dummy-password-for-timing")
+	})
+	hashers.verify(password, dummyHash)
+}
+
+// loginDelay returns how long to wait after the given number of consecutive
+// failures. The first ThrottleAfter failures are free; each further failure
+// doubles the delay up to MaxDelay.
+func loginDelay(cfg config.LockoutConfig, failures int) time.Duration {
+	if failures < cfg.ThrottleAfter || cfg.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := cfg.BaseDelay
+	for i := cfg.ThrottleAfter; i < failures && delay < cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	if cfg.MaxDelay > 0 && delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return delay
+}
+
+// checkLoginThrottle rejects an attempt while the account is locked or still
+// inside its progressive delay window
+func checkLoginThrottle(cfg config.LockoutConfig, user *models.User, now time.Time) error {
+	if user.IsLocked(now) {
+		return &LoginThrottledError{RetryAfter: user.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if user.LastFailedLoginAt == nil {
+		return nil
+	}
+	nextAttempt := user.LastFailedLoginAt.Add(loginDelay(cfg, user.FailedLoginAttempts))
+	if now.Before(nextAttempt) {
+		return &LoginThrottledError{RetryAfter: nextAttempt.Sub(now)}
+	}
+	return nil
+}
+
+// loginAttemptStore holds the failed login counters of accounts
+type loginAttemptStore interface {
+	ClaimLoginAttempt(ctx context.Context, userID uint, seenAttempts, threshold int, lockDuration time.Duration) (*models.User, bool, error)
+	GetByID(ctx context.Context, userID uint) (*models.User, error)
+}
+
+// claimLoginAttempt counts an attempt against the account before its password
+// or code is checked, once the throttle allows it. Callers clear the counters
+// when the attempt succeeds. The updated counters are returned.
+func (s *AuthService) claimLoginAttempt(ctx context.Context, user *models.User) (*models.User, error) {
+	return claimLoginAttempt(ctx, s.userRepo, config.AppConfig.Auth.Lockout, user)
+}
+
+// claimLoginAttempt does the work of AuthService.claimLoginAttempt. The throttle
+// is checked against the same counters the increment is conditional on, so
+// parallel attempts cannot all slip through.
+func claimLoginAttempt(ctx context.Context, store loginAttemptStore, cfg config.LockoutConfig, user *models.User) (*models.User, error) {
+	current := user
+
+	for i := 0; i < maxClaimRetries; i++ {
+		if err := checkLoginThrottle(cfg, current, time.Now()); err != nil {
+			return nil, err
+		}
+
+		updated, claimed, err := store.ClaimLoginAttempt(ctx, user.ID, current.FailedLoginAttempts, cfg.Threshold, cfg.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count login attempt: %w", err)
+		}
+		if claimed {
+			return updated, nil
+		}
+
+		// Another attempt changed the counters first; check against the new ones
+		current, err = store.GetByID(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrInvalidCredentials
+		}
+	}
+
+	return nil, &LoginThrottledError{RetryAfter: cfg.BaseDelay}
+}
+
+// verifyCurrentPassword re-checks the password of a signed-in user before a
+// sensitive change. Attempts are throttled and counted like logins, so an
+// access token cannot be used to guess the password.
+func (s *AuthService) verifyCurrentPassword(ctx context.Context, user *models.User, password string) error {
+	claimed, err := s.claimLoginAttempt(ctx, user)
+	if err != nil {
+		burnPasswordCheck(password)
+		return err
+	}
+
+	if !verifyPassword(password, user.Password) {
+		logLockout(user, claimed)
+		return ErrInvalidCurrentPassword
+	}
+	return s.userRepo.ClearFailedLogins(ctx, user.ID)
+}
+
+// logLockout logs when a failed attempt locked the account
+func logLockout(user, updated *models.User) {
+	now := time.Now()
+	if updated.IsLocked(now) && !user.IsLocked(now) {
+		logging.Log.Warn("Account locked after repeated failed logins",
+			zap.Uint("user_id", user.ID),
+			zap.Int("failed_attempts", updated.FailedLoginAttempts),
+			zap.Time("locked_until", *updated.LockedUntil))
+	}
+}
+
+// GetLockedUsers returns accounts that are currently locked
+func (s *AuthService) GetLockedUsers(ctx context.Context) ([]models.User, error) {
+	return s.userRepo.GetLockedUsers(ctx, time.Now().UTC())
+}
+
+// UnlockUser clears a user's failed login counter and lockout
+func (s *AuthService) UnlockUser(ctx context.Context, userID, adminID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.userRepo.ClearFailedLogins(ctx, userID); err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+
+	logging.Log.Info("Account unlocked by admin", zap.Uint("user_id", userID), zap.Uint("admin_id", adminID))
+	return nil
+}
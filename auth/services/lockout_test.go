@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestLoginDelay(t *testing.T) {
+	cfg := config.LockoutConfig{
+		ThrottleAfter: 3,
+		BaseDelay:     time.Second,
+		MaxDelay:      10 * time.Second,
+	}
+
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		if got := loginDelay(cfg, tc.failures); got != tc.want {
+			t.Errorf("loginDelay(%d) = %v, want %v", tc.failures, got, tc.want)
+		}
+	}
+}
+
+func TestCheckLoginThrottle(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	now := time.Now()
+
+	lastFailure := now.Add(-500 * time.Millisecond)
+	lockedUntil := now.Add(time.Minute)
+
+	cases := []struct {
+		name       string
+		user       models.User
+		wantLocked bool
+		wantErr    bool
+	}{
+		{"no failures", models.User{}, false, false},
+		{"below throttle", models.User{FailedLoginAttempts: 2, LastFailedLoginAt: &lastFailure}, false, false},
+		{"inside delay", models.User{FailedLoginAttempts: 3, LastFailedLoginAt: &lastFailure}, false, true},
+		{"locked", models.User{FailedLoginAttempts: 10, LockedUntil: &lockedUntil}, true, true},
+	}
+
+	for _, tc := range cases {
+		err := checkLoginThrottle(cfg, &tc.user, now)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tc.name, err, tc.wantErr)
+			continue
+		}
+		var throttled *LoginThrottledError
+		if err != nil && (!errors.As(err, &throttled) || throttled.Locked != tc.wantLocked) {
+			t.Errorf("%s: got %v, want locked=%v", tc.name, err, tc.wantLocked)
+		}
+	}
+}
+
+func TestUnknownEmailsAreThrottledLikeAccounts(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second, Threshold: 4, Duration: time.Minute}
+	tracker := newFailedLoginTracker(100)
+	now := time.Now()
+
+	for i := 0; i < cfg.ThrottleAfter; i++ {
+		if err := tracker.checkAndRecord(cfg, "nobody@example.com", now); err != nil {
+			t.Fatalf("unexpected error before the throttle starts: %v", err)
+		}
+	}
+	var throttled *LoginThrottledError
+	if err := tracker.checkAndRecord(cfg, "nobody@example.com", now); !errors.As(err, &throttled) || throttled.Locked {
+		t.Fatalf("expected a throttle delay after %d failures, got %v", cfg.ThrottleAfter, err)
+	}
+	if err := tracker.checkAndRecord(cfg, "other@example.com", now); err != nil {
+		t.Errorf("expected other emails to be unaffected, got %v", err)
+	}
+
+	if err := tracker.checkAndRecord(cfg, "nobody@example.com", now.Add(time.Second)); err != nil {
+		t.Fatalf("expected an attempt once the delay passed, got %v", err)
+	}
+	if err := tracker.checkAndRecord(cfg, "nobody@example.com", now.Add(4*time.Second)); err != nil {
+		t.Fatalf("expected an attempt once the delay passed, got %v", err)
+	}
+	if err := tracker.checkAndRecord(cfg, "nobody@example.com", now.Add(30*time.Second)); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("expected a lockout after %d failures, got %v", cfg.Threshold, err)
+	}
+	if err := tracker.checkAndRecord(cfg, "nobody@example.com", now.Add(2*time.Minute)); err != nil {
+		t.Errorf("expected the lockout to expire, got %v", err)
+	}
+}
+
+func TestUnknownEmailThrottleHoldsForParallelAttempts(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Threshold: 100, Duration: time.Hour}
+	tracker := newFailedLoginTracker(100)
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tracker.checkAndRecord(cfg, "nobody@example.com", now) == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != int32(cfg.ThrottleAfter) {
+		t.Errorf("%d parallel attempts passed the throttle, want %d", got, cfg.ThrottleAfter)
+	}
+}
+
+func TestUnknownEmailTrackerIsBounded(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Threshold: 100, Duration: time.Hour}
+	tracker := newFailedLoginTracker(3)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		if err := tracker.checkAndRecord(cfg, fmt.Sprintf("user%d@example.com", i), now.Add(time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatalf("unexpected error for a new email: %v", err)
+		}
+	}
+	if len(tracker.entries) != 3 || tracker.order.Len() != 3 {
+		t.Fatalf("tracker holds %d emails, want 3", len(tracker.entries))
+	}
+	if _, ok := tracker.entries["user0@example.com"]; ok {
+		t.Errorf("expected the oldest email to be dropped")
+	}
+	if err := tracker.checkAndRecord(cfg, "user9@example.com", now); err == nil {
+		t.Errorf("expected the most recent email to still be throttled")
+	}
+
+	if err := tracker.checkAndRecord(cfg, "late@example.com", now.Add(unknownLoginRetention+time.Minute)); err != nil {
+		t.Fatalf("unexpected error for a new email: %v", err)
+	}
+	if len(tracker.entries) != 1 {
+		t.Errorf("expected emails past the retention to be dropped, %d left", len(tracker.entries))
+	}
+}
+
+// memoryAttemptStore keeps failed login counters like UserRepository does
+type memoryAttemptStore struct {
+	mu   sync.Mutex
+	user models.User
+}
+
+func (m *memoryAttemptStore) ClaimLoginAttempt(_ context.Context, userID uint, seenAttempts, threshold int, lockDuration time.Duration) (*models.User, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.user.ID != userID || m.user.FailedLoginAttempts != seenAttempts {
+		return nil, false, nil
+	}
+	now := time.Now()
+	m.user.FailedLoginAttempts++
+	m.user.LastFailedLoginAt = &now
+	if m.user.FailedLoginAttempts >= threshold {
+		lockedUntil := now.Add(lockDuration)
+		m.user.LockedUntil = &lockedUntil
+	}
+	updated := m.user
+	return &updated, true, nil
+}
+
+func (m *memoryAttemptStore) GetByID(_ context.Context, userID uint) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.user.ID != userID {
+		return nil, nil
+	}
+	user := m.user
+	return &user, nil
+}
+
+func TestCyclingLoginChallengesLocksTheAccount(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 100, Threshold: 6, Duration: time.Hour}
+	store := &memoryAttemptStore{user: models.User{BaseModel: models.BaseModel{ID: 1}}}
+	ctx := context.Background()
+
+	// Each cycle is a correct password, which leaves the counter up because
+	// the account has 2FA, followed by a wrong code on the new challenge
+	for cycle := 0; cycle < cfg.Threshold/2; cycle++ {
+		for step := 0; step < 2; step++ {
+			current, _ := store.GetByID(ctx, 1)
+			if _, err := claimLoginAttempt(ctx, store, cfg, current); err != nil {
+				t.Fatalf("cycle %d: unexpected error before the threshold: %v", cycle, err)
+			}
+		}
+	}
+
+	current, _ := store.GetByID(ctx, 1)
+	var throttled *LoginThrottledError
+	if _, err := claimLoginAttempt(ctx, store, cfg, current); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("expected the account to be locked after %d attempts across challenges, got %v", cfg.Threshold, err)
+	}
+}
+
+func TestLoginThrottleHoldsForParallelAttempts(t *testing.T) {
+	cfg := config.LockoutConfig{ThrottleAfter: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Threshold: 100, Duration: time.Hour}
+	store := &memoryAttemptStore{user: models.User{BaseModel: models.BaseModel{ID: 1}}}
+	ctx := context.Background()
+
+	// Every attempt starts from the same stale read, like parallel logins
+	stale, _ := store.GetByID(ctx, 1)
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := claimLoginAttempt(ctx, store, cfg, stale); err == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != int32(cfg.ThrottleAfter) {
+		t.Errorf("%d parallel attempts passed the throttle, want %d", got, cfg.ThrottleAfter)
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
+	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/ratelimit"
+)
+
+// Errors returned by magic link sign in
+var (
+	ErrInvalidMagicLink      = errors.New("invalid or expired sign-in link")
+	ErrMagicLinkOtherBrowser = errors.New("open the sign-in link in the browser you requested it from")
+)
+
+// MagicLinkRole is a role and whether its users may sign in with emailed links
+type MagicLinkRole struct {
+	Role    string
+	Enabled bool
+}
+
+// MagicLinkService signs users in with single-use links sent to their email.
+// Each link is bound to the browser that asked for it by a nonce cookie, so a
+// forwarded or intercepted email cannot be used elsewhere.
+type MagicLinkService struct {
+	userRepo     *db.UserRepository
+	roleRepo     *db.RoleRepository
+	tokenRepo    *db.OneTimeTokenRepository
+	settingRepo  *db.SettingRepository
+	authService  *AuthService
+	mailer       mail.Mailer
+	emailLimiter *ratelimit.KeyedLimiter
+	ipLimiter    *ratelimit.KeyedLimiter
+}
+
+// NewMagicLinkService creates a new MagicLinkService
+func NewMagicLinkService(userRepo *db.UserRepository, roleRepo *db.RoleRepository, tokenRepo *db.OneTimeTokenRepository, settingRepo *db.SettingRepository, authService *AuthService, mailer mail.Mailer) *MagicLinkService {
+	cfg := config.AppConfig.Auth.MagicLink
+	return &MagicLinkService{
+		userRepo:     userRepo,
+		roleRepo:     roleRepo,
+		tokenRepo:    tokenRepo,
+		settingRepo:  settingRepo,
+		authService:  authService,
+		mailer:       mailer,
+		emailLimiter: ratelimit.PerWindow(cfg.RequestsPerEmail, time.Hour),
+		ipLimiter:    ratelimit.PerWindow(cfg.RequestsPerIP, time.Hour),
+	}
+}
+
+// MagicLinkPath returns the path under which the request and callback endpoints live
+func MagicLinkPath() string {
+	return config.AppConfig.API.BaseURL + "/auth/magic-link"
+}
+
+// MagicLinkRedirect returns the UI page that receives the result of a sign in,
+// with the given values in the URL fragment
+func MagicLinkRedirect(values url.Values) string {
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.Auth.MagicLink.UIRedirect + "#" + values.Encode()
+}
+
+// RequestLink returns a nonce for the caller to store in the browser and, if the
+// account may use magic links, emails a sign-in link bound to that nonce. Only
+// rate limiting is reported so that accounts and their settings cannot be
+// enumerated. The account is looked up and emailed in the background, so every
+// request gets a nonce and takes the same time.
+func (s *MagicLinkService) RequestLink(ctx context.Context, email, clientIP string) (string, time.Duration, error) {
+	email = normalizeEmail(email)
+	ttl := config.AppConfig.Auth.MagicLink.TokenDuration
+
+	if !s.ipLimiter.Allow(clientIP) || !s.emailLimiter.Allow(email) {
+		logging.Log.Warn("Magic link rate limit exceeded", zap.String("ip", clientIP))
+		return "", 0, ErrRateLimited
+	}
+
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	go s.requestLink(context.WithoutCancel(ctx), email, nonce, ttl)
+	return nonce, ttl, nil
+}
+
+// requestLink does the work of RequestLink after the caller was answered, so
+// failures are only logged
+func (s *MagicLinkService) requestLink(ctx context.Context, email, nonce string, ttl time.Duration) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		logging.Log.Error("Failed to look up account for magic link", zap.Error(err))
+		return
+	}
+	if user == nil || user.Disabled || !user.IsEmailVerified() {
+		logging.Log.Info("Magic link requested for unknown or inactive account")
+		return
+	}
+	allowed, err := s.allowed(ctx, user)
+	if err != nil {
+		logging.Log.Error("Failed to check magic link sign in", zap.Uint("user_id", user.ID), zap.Error(err))
+		return
+	}
+	if !allowed {
+		logging.Log.Info("Magic link requested for account without magic link sign in", zap.Uint("user_id", user.ID))
+		return
+	}
+
+	if err := s.sendLink(ctx, user, nonce, ttl); err != nil {
+		logging.Log.Error("Failed to send magic link", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+}
+
+// CompleteLogin checks a sign-in link against the nonce from the browser that
+// opened it and returns the user to sign in. Every attempt is recorded in the audit log.
+func (s *MagicLinkService) CompleteLogin(ctx context.Context, token, nonce string) (*models.User, error) {
+	user, userID, err := s.completeLogin(ctx, token, nonce)
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventMagicLinkLogin, userID, err))
+	return user, err
+}
+
+// completeLogin does the work of CompleteLogin and returns the ID of the user
+// the link belongs to, when known
+func (s *MagicLinkService) completeLogin(ctx context.Context, token, nonce string) (*models.User, uint, error) {
+	if token == "" {
+		return nil, 0, ErrInvalidMagicLink
+	}
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeMagicLink, hashToken(token))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up sign-in link: %w", err)
+	}
+	if err := checkMagicLink(record, nonce, time.Now()); err != nil {
+		if errors.Is(err, ErrMagicLinkOtherBrowser) {
+			logging.Log.Warn("Magic link opened without its browser nonce", zap.Uint("user_id", record.UserID))
+			return nil, record.UserID, err
+		}
+		return nil, 0, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, record.UserID, err
+	}
+	if user == nil || user.Email != record.Email {
+		return nil, record.UserID, ErrInvalidMagicLink
+	}
+	if user.Disabled {
+		return nil, user.ID, ErrUserInactive
+	}
+	// An admin may have turned magic links off after the link was sent
+	allowed, err := s.allowed(ctx, user)
+	if err != nil {
+		return nil, user.ID, err
+	}
+	if !allowed {
+		return nil, user.ID, ErrInvalidMagicLink
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, user.ID, fmt.Errorf("failed to consume sign-in link: %w", err)
+	}
+	if !consumed {
+		return nil, user.ID, ErrInvalidMagicLink
+	}
+
+	logging.Log.Info("Magic link accepted", zap.Uint("user_id", user.ID))
+	return user, user.ID, nil
+}
+
+// ListRoles returns every role with whether its users may sign in with emailed links
+func (s *MagicLinkService) ListRoles(ctx context.Context) ([]MagicLinkRole, error) {
+	roles, err := s.roleRepo.ListWithPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]MagicLinkRole, 0, len(roles))
+	for _, role := range roles {
+		enabled, err := s.roleEnabled(ctx, role.Name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, MagicLinkRole{Role: role.Name, Enabled: enabled})
+	}
+	return list, nil
+}
+
+// SetRoleEnabled controls whether users with a role may sign in with emailed links
+func (s *MagicLinkService) SetRoleEnabled(ctx context.Context, roleName string, enabled bool, adminID uint) error {
+	role, err := s.roleRepo.GetByName(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return ErrUnknownRole
+	}
+	if err := s.settingRepo.Set(ctx, models.MagicLinkRoleSetting(role.Name), strconv.FormatBool(enabled)); err != nil {
+		return fmt.Errorf("failed to update magic link setting: %w", err)
+	}
+
+	logging.Log.Info("Magic link sign in changed for role",
+		zap.String("role", role.Name),
+		zap.Bool("enabled", enabled),
+		zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// allowed reports whether the user may sign in with emailed links, either by
+// themselves or through one of their roles
+func (s *MagicLinkService) allowed(ctx context.Context, user *models.User) (bool, error) {
+	if user.MagicLink {
+		return true, nil
+	}
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load user roles: %w", err)
+	}
+	enabledRoles := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		enabled, err := s.roleEnabled(ctx, role.Name)
+		if err != nil {
+			return false, err
+		}
+		enabledRoles[role.Name] = enabled
+	}
+	return magicLinkAllowed(user, roles, enabledRoles), nil
+}
+
+// magicLinkAllowed decides whether a user with the given roles may sign in with
+// emailed links, given which roles have them turned on
+func magicLinkAllowed(user *models.User, roles []models.Role, enabledRoles map[string]bool) bool {
+	if user.MagicLink {
+		return true
+	}
+	for _, role := range roles {
+		if enabledRoles[role.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMagicLink checks a stored sign-in link against the nonce from the browser
+// that opened it. A link opened in another browser stays usable, so that it can
+// still be opened in the right one.
+func checkMagicLink(record *models.OneTimeToken, nonce string, now time.Time) error {
+	if record == nil || !record.IsUsable(now) {
+		return ErrInvalidMagicLink
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(hashToken(nonce)), []byte(record.Payload)) != 1 {
+		return ErrMagicLinkOtherBrowser
+	}
+	return nil
+}
+
+// roleEnabled reads the magic link setting of a role; roles are off until an admin turns them on
+func (s *MagicLinkService) roleEnabled(ctx context.Context, roleName string) (bool, error) {
+	value, err := s.settingRepo.Get(ctx, models.MagicLinkRoleSetting(roleName), "false")
+	if err != nil {
+		return false, err
+	}
+	return value == "true", nil
+}
+
+// sendLink invalidates earlier sign-in links and emails a new one bound to the nonce
+func (s *MagicLinkService) sendLink(ctx context.Context, user *models.User, nonce string, ttl time.Duration) error {
+	// Only the most recent link stays valid, matching the browser's latest nonce
+	if err := s.tokenRepo.InvalidateForUser(ctx, models.TokenPurposeMagicLink, user.ID); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeMagicLink,
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+		Payload:   hashToken(nonce),
+	}); err != nil {
+		return fmt.Errorf("failed to store sign-in link: %w", err)
+	}
+
+	link := publicLink(MagicLinkPath()+"/callback", url.Values{"token": {token}})
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open this link to sign in:\n%s\n\n"+
+			"Open it in the same browser you asked for it from. The link expires in %s "+
+			"and can only be used once. If you did not ask for it, you can ignore this email.\n",
+			user.Name, link, ttl),
+	}); err != nil {
+		return fmt.Errorf("failed to send sign-in email: %w", err)
+	}
+
+	logging.Log.Info("Magic link email sent", zap.Uint("user_id", user.ID))
+	return nil
+}
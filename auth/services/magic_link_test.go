@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestCheckMagicLink(t *testing.T) {
+	now := time.Now()
+	used := now.Add(-time.Minute)
+	link := func() *models.OneTimeToken {
+		return &models.OneTimeToken{
+			Purpose:   models.TokenPurposeMagicLink,
+			ExpiresAt: now.Add(time.Minute),
+			Payload:   hashToken("browser-nonce"),
+		}
+	}
+
+	if err := checkMagicLink(link(), "browser-nonce", now); err != nil {
+		t.Errorf("expected the link to be accepted in its browser, got %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		record *models.OneTimeToken
+		nonce  string
+		want   error
+	}{
+		{"unknown link", nil, "browser-nonce", ErrInvalidMagicLink},
+		{"other browser", link(), "other-nonce", ErrMagicLinkOtherBrowser},
+		{"no nonce cookie", link(), "", ErrMagicLinkOtherBrowser},
+		{"already used", func() *models.OneTimeToken { r := link(); r.UsedAt = &used; return r }(), "browser-nonce", ErrInvalidMagicLink},
+		{"expired", func() *models.OneTimeToken { r := link(); r.ExpiresAt = now.Add(-time.Second); return r }(), "browser-nonce", ErrInvalidMagicLink},
+	}
+
+	for _, tc := range cases {
+		if err := checkMagicLink(tc.record, tc.nonce, now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: checkMagicLink() = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestMagicLinkAllowed(t *testing.T) {
+	family := []models.Role{{Name: models.RoleFamily}}
+	guestAndFamily := []models.Role{{Name: models.RoleGuest}, {Name: models.RoleFamily}}
+
+	cases := []struct {
+		name    string
+		user    models.User
+		roles   []models.Role
+		enabled map[string]bool
+		want    bool
+	}{
+		{"off by default", models.User{}, family, nil, false},
+		{"role turned on", models.User{}, family, map[string]bool{models.RoleFamily: true}, true},
+		{"other role turned on", models.User{}, family, map[string]bool{models.RoleGuest: true}, false},
+		{"any of the user's roles", models.User{}, guestAndFamily, map[string]bool{models.RoleFamily: true}, true},
+		{"turned on for the user", models.User{MagicLink: true}, family, nil, true},
+		{"user without roles", models.User{}, nil, map[string]bool{models.RoleFamily: true}, false},
+	}
+
+	for _, tc := range cases {
+		if got := magicLinkAllowed(&tc.user, tc.roles, tc.enabled); got != tc.want {
+			t.Errorf("%s: magicLinkAllowed() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned by OIDC client management
+var (
+	ErrClientNotFound       = errors.New("client not found")
+	ErrInvalidRedirectURIs  = errors.New("redirect URIs must be absolute http or https URLs without a fragment")
+	ErrUnsupportedScope     = errors.New("unsupported scope")
+	ErrRedirectURIsRequired = errors.New("at least one redirect URI is required")
+	ErrPublicClientSecret   = errors.New("public clients do not have a secret")
+)
+
+// OAuthClientInput holds the fields an admin sets on a client
+type OAuthClientInput struct {
+	Name         string
+	RedirectURIs []string
+	Scopes       []string // allowed scopes; openid is always included
+	Public       bool
+	SkipConsent  bool
+}
+
+// UpdateOAuthClientInput holds the client fields an admin may change; nil fields are left as they are
+type UpdateOAuthClientInput struct {
+	Name         *string
+	RedirectURIs *[]string
+	Scopes       *[]string
+	SkipConsent  *bool
+}
+
+// OAuthClientService implements admin management of OIDC clients
+type OAuthClientService struct {
+	oauthRepo        *db.OAuthRepository
+	refreshTokenRepo *db.RefreshTokenRepository
+}
+
+// NewOAuthClientService creates a new OAuthClientService
+func NewOAuthClientService(oauthRepo *db.OAuthRepository, refreshTokenRepo *db.RefreshTokenRepository) *OAuthClientService {
+	return &OAuthClientService{
+		oauthRepo:        oauthRepo,
+		refreshTokenRepo: refreshTokenRepo,
+	}
+}
+
+// ListClients returns every registered client
+func (s *OAuthClientService) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	return s.oauthRepo.ListClients(ctx)
+}
+
+// GetClient returns a client by its database ID
+func (s *OAuthClientService) GetClient(ctx context.Context, id uint) (*models.OAuthClient, error) {
+	client, err := s.oauthRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrClientNotFound
+	}
+	return client, nil
+}
+
+// CreateClient registers a client. For confidential clients the secret is
+// returned once and only its hash is stored.
+func (s *OAuthClientService) CreateClient(ctx context.Context, input OAuthClientInput, adminID uint) (*models.OAuthClient, string, error) {
+	redirectURIs, err := validateRedirectURIs(input.RedirectURIs)
+	if err != nil {
+		return nil, "", err
+	}
+	scopes, err := validateClientScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientID, err := generateID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         strings.TrimSpace(input.Name),
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+		Public:       input.Public,
+		SkipConsent:  input.SkipConsent,
+		CreatedBy:    adminID,
+	}
+
+	var secret string
+	if !input.Public {
+		if secret, err = generateOpaqueToken(); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := s.oauthRepo.Create(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("failed to create client: %w", err)
+	}
+
+	logging.Log.Info("OIDC client created",
+		zap.String("client_id", client.ClientID),
+		zap.String("name", client.Name),
+		zap.Bool("public", client.Public),
+		zap.Uint("admin_id", adminID))
+	return client, secret, nil
+}
+
+// UpdateClient changes a client's name, redirect URIs, scopes or consent setting
+func (s *OAuthClientService) UpdateClient(ctx context.Context, id uint, input UpdateOAuthClientInput, adminID uint) (*models.OAuthClient, error) {
+	client, err := s.GetClient(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		client.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.RedirectURIs != nil {
+		redirectURIs, err := validateRedirectURIs(*input.RedirectURIs)
+		if err != nil {
+			return nil, err
+		}
+		client.RedirectURIs = strings.Join(redirectURIs, " ")
+	}
+	if input.Scopes != nil {
+		scopes, err := validateClientScopes(*input.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		client.Scopes = strings.Join(scopes, " ")
+	}
+	if input.SkipConsent != nil {
+		client.SkipConsent = *input.SkipConsent
+	}
+
+	if err := s.oauthRepo.Update(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to update client: %w", err)
+	}
+
+	logging.Log.Info("OIDC client updated", zap.String("client_id", client.ClientID), zap.Uint("admin_id", adminID))
+	return client, nil
+}
+
+// RotateSecret replaces a confidential client's secret and returns the new one
+func (s *OAuthClientService) RotateSecret(ctx context.Context, id uint, adminID uint) (*models.OAuthClient, string, error) {
+	client, err := s.GetClient(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if client.Public {
+		return nil, "", ErrPublicClientSecret
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	client.SecretHash = hashToken(secret)
+
+	if err := s.oauthRepo.Update(ctx, client); err != nil {
+		return nil, "", fmt.Errorf("failed to rotate client secret: %w", err)
+	}
+
+	logging.Log.Warn("OIDC client secret rotated", zap.String("client_id", client.ClientID), zap.Uint("admin_id", adminID))
+	return client, secret, nil
+}
+
+// DeleteClient removes a client, its consents and every refresh token issued to it
+func (s *OAuthClientService) DeleteClient(ctx context.Context, id uint, adminID uint) error {
+	client, err := s.GetClient(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.oauthRepo.DeleteClient(ctx, client); err != nil {
+		return fmt.Errorf("failed to delete client: %w", err)
+	}
+	if err := s.refreshTokenRepo.RevokeForClient(ctx, client.ClientID, 0); err != nil {
+		return fmt.Errorf("failed to revoke client refresh tokens: %w", err)
+	}
+
+	logging.Log.Warn("OIDC client deleted", zap.String("client_id", client.ClientID), zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// validateRedirectURIs checks and de-duplicates redirect URIs
+func validateRedirectURIs(uris []string) ([]string, error) {
+	valid := make([]string, 0, len(uris))
+	seen := make(map[string]bool)
+	for _, raw := range uris {
+		raw = strings.TrimSpace(raw)
+		parsed, err := url.Parse(raw)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" ||
+			(parsed.Scheme != "http" && parsed.Scheme != "https") || strings.ContainsAny(raw, " \t\n") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRedirectURIs, raw)
+		}
+		if !seen[raw] {
+			seen[raw] = true
+			valid = append(valid, raw)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, ErrRedirectURIsRequired
+	}
+	return valid, nil
+}
+
+// validateClientScopes checks that every scope is supported and adds openid
+func validateClientScopes(scopes []string) ([]string, error) {
+	for _, scope := range scopes {
+		if !containsScope(models.SupportedScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedScope, scope)
+		}
+	}
+	return mergeScopes([]string{models.ScopeOpenID}, scopes), nil
+}
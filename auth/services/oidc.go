@@ -0,0 +1,794 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/jwks"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// OAuthError is an error reported to OIDC clients using an OAuth 2.0 error code
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// newOAuthError creates an OAuthError with a specific description
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// Errors returned by the OpenID Connect provider
+var (
+	ErrOAuthInvalidClient   = newOAuthError("invalid_client", "client authentication failed")
+	ErrOAuthInvalidGrant    = newOAuthError("invalid_grant", "the code or refresh token is invalid, expired or was issued to another client")
+	ErrOAuthUnsupportedType = newOAuthError("unsupported_grant_type", "supported grant types are authorization_code, refresh_token and client_credentials")
+	ErrOAuthAccessDenied    = newOAuthError("access_denied", "the user denied the request")
+	ErrOAuthLoginRequired   = newOAuthError("login_required", "the user is not signed in")
+	ErrOAuthConsentRequired = newOAuthError("consent_required", "the user has not approved this application")
+	ErrOAuthInvalidToken    = newOAuthError("invalid_token", "the access token is invalid or expired")
+	ErrOAuthInvalidScope    = newOAuthError("invalid_scope", "the requested scope is not allowed for this client")
+	ErrOAuthInvalidTarget   = newOAuthError("invalid_target", "the requested audience is not allowed for this client")
+
+	// Errors that must not be sent to the redirect URI, because it cannot be trusted
+	ErrUnknownClient      = errors.New("unknown client")
+	ErrInvalidRedirectURI = errors.New("redirect_uri is not registered for this client")
+)
+
+// OIDC grant types, prompt values and PKCE method
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials" // used by service accounts
+
+	promptNone    = "none"
+	promptLogin   = "login"
+	promptConsent = "consent"
+
+	pkceMethodS256 = "S256"
+)
+
+// AuthorizeRequest holds the parameters of an authorization request
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	Nonce               string `form:"nonce"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Prompt              string `form:"prompt"`
+}
+
+// Authorization is a validated authorization request
+type Authorization struct {
+	Request AuthorizeRequest
+	Client  *models.OAuthClient
+	Scopes  []string // requested scopes the client is allowed, always including openid
+}
+
+// HasPrompt reports whether the request asked for the given prompt value
+func (a *Authorization) HasPrompt(prompt string) bool {
+	for _, p := range strings.Fields(a.Request.Prompt) {
+		if p == prompt {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenRequest holds the parameters of a token endpoint request
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`    // client_credentials only
+	Audience     string `form:"audience"` // client_credentials only
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// OIDCTokenResponse is returned by the token endpoint
+type OIDCTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// DiscoveryDocument is served at /.well-known/openid-configuration
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// codePayload is the state stored with an authorization code
+type codePayload struct {
+	ClientID      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	AuthTime      int64  `json:"auth_time"`
+}
+
+// OIDCService implements the OpenID Connect provider: sign-in sessions,
+// consent, authorization codes, tokens and userinfo
+type OIDCService struct {
+	oauthRepo        *db.OAuthRepository
+	userRepo         *db.UserRepository
+	roleRepo         *db.RoleRepository
+	tokenRepo        *db.OneTimeTokenRepository
+	refreshTokenRepo *db.RefreshTokenRepository
+	authService      *AuthService
+	twoFactorService *TwoFactorService
+	serviceAccounts  *ServiceAccountService
+}
+
+// NewOIDCService creates a new OIDCService
+func NewOIDCService(oauthRepo *db.OAuthRepository, userRepo *db.UserRepository, roleRepo *db.RoleRepository, tokenRepo *db.OneTimeTokenRepository, refreshTokenRepo *db.RefreshTokenRepository, authService *AuthService, twoFactorService *TwoFactorService, serviceAccounts *ServiceAccountService) *OIDCService {
+	return &OIDCService{
+		oauthRepo:        oauthRepo,
+		userRepo:         userRepo,
+		roleRepo:         roleRepo,
+		tokenRepo:        tokenRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+		serviceAccounts:  serviceAccounts,
+	}
+}
+
+// Issuer returns the provider's issuer URL
+func Issuer() string {
+	if issuer := config.AppConfig.Auth.OIDC.Issuer; issuer != "" {
+		return strings.TrimRight(issuer, "/")
+	}
+	return strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + config.AppConfig.API.BaseURL + "/auth/oidc"
+}
+
+// Discovery returns the provider metadata
+func (s *OIDCService) Discovery() DiscoveryDocument {
+	issuer := Issuer()
+	return DiscoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		IntrospectionEndpoint:             IntrospectionEndpoint(),
+		JWKSURI:                           issuer + "/jwks",
+		ScopesSupported:                   models.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name", "roles"},
+	}
+}
+
+// JWKS returns the public keys that verify ID and access tokens
+func (s *OIDCService) JWKS() (jwks.Set, error) {
+	return s.authService.JWKS()
+}
+
+// ValidateAuthorizeRequest checks an authorization request. ErrUnknownClient and
+// ErrInvalidRedirectURI must be shown to the user; any other error is reported
+// to the client through ErrorRedirect.
+func (s *OIDCService) ValidateAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	client, err := s.oauthRepo.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrUnknownClient
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	auth := &Authorization{Request: req, Client: client}
+
+	if req.ResponseType != "code" {
+		return auth, newOAuthError("unsupported_response_type", "only the authorization code flow is supported")
+	}
+
+	auth.Scopes = grantableScopes(strings.Fields(req.Scope), client.ScopeList())
+	if len(auth.Scopes) == 0 || auth.Scopes[0] != models.ScopeOpenID {
+		return auth, newOAuthError("invalid_scope", "the openid scope is required")
+	}
+
+	if req.CodeChallengeMethod != pkceMethodS256 {
+		return auth, newOAuthError("invalid_request", "PKCE with code_challenge_method S256 is required")
+	}
+	if n := len(req.CodeChallenge); n < 43 || n > 128 {
+		return auth, newOAuthError("invalid_request", "code_challenge is missing or malformed")
+	}
+
+	return auth, nil
+}
+
+// ErrorRedirect builds the redirect that reports an error back to the client
+func (s *OIDCService) ErrorRedirect(auth *Authorization, err error) string {
+	oauthErr := &OAuthError{}
+	if !errors.As(err, &oauthErr) {
+		oauthErr = newOAuthError("server_error", "the request could not be completed")
+	}
+
+	params := url.Values{}
+	params.Set("error", oauthErr.Code)
+	params.Set("error_description", oauthErr.Description)
+	return redirectWithParams(auth.Request.RedirectURI, params, auth.Request.State)
+}
+
+// SignIn checks a user's password for the provider's login form. If the user
+// has 2FA enabled, a login challenge is returned instead of the user.
+func (s *OIDCService) SignIn(ctx context.Context, email, password string) (*models.User, string, error) {
+	user, err := s.authService.Authenticate(ctx, normalizeEmail(email), password)
+	if err != nil {
+		return nil, "", err
+	}
+
+	enabled, err := s.twoFactorService.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if enabled {
+		challenge, _, err := s.twoFactorService.CreateChallenge(ctx, user)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, challenge, nil
+	}
+
+	return user, "", nil
+}
+
+// SignInTwoFactor completes a login challenge started by SignIn
+func (s *OIDCService) SignInTwoFactor(ctx context.Context, challenge, code string) (*models.User, error) {
+	return s.twoFactorService.VerifyChallenge(ctx, challenge, strings.TrimSpace(code))
+}
+
+// CreateSession returns a signed value for the provider's sign-in cookie and its lifetime
+func (s *OIDCService) CreateSession(user *models.User) (string, time.Duration, error) {
+	jti, err := generateID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	duration := config.AppConfig.Auth.OIDC.SessionDuration
+	claims := models.JWTClaims{
+		UserID:  strconv.Itoa(int(user.ID)),
+		Type:    models.TokenTypeOIDCSession,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    Issuer(),
+			Subject:   strconv.Itoa(int(user.ID)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		},
+	}
+
+	session, err := signJWT(claims)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign session: %w", err)
+	}
+	return session, duration, nil
+}
+
+// ResolveSession returns the signed-in user and the time they authenticated.
+// It returns a nil user when the cookie is missing, invalid or revoked.
+func (s *OIDCService) ResolveSession(ctx context.Context, session string) (*models.User, time.Time, error) {
+	if session == "" {
+		return nil, time.Time{}, nil
+	}
+
+	claims, err := validateTokenOfType(session, models.TokenTypeOIDCSession)
+	if err != nil {
+		return nil, time.Time{}, nil
+	}
+
+	user, err := s.activeUser(ctx, claims.UserID)
+	if err != nil || user == nil {
+		return nil, time.Time{}, err
+	}
+	return user, claims.IssuedAt.Time, nil
+}
+
+// NeedsConsent reports whether the user must approve the client's requested scopes
+func (s *OIDCService) NeedsConsent(ctx context.Context, userID uint, auth *Authorization) (bool, error) {
+	if auth.Client.SkipConsent {
+		return false, nil
+	}
+	if auth.HasPrompt(promptConsent) {
+		return true, nil
+	}
+
+	consent, err := s.oauthRepo.GetConsent(ctx, userID, auth.Client.ClientID)
+	if err != nil {
+		return false, err
+	}
+	return consent == nil || !consent.Covers(auth.Scopes), nil
+}
+
+// GrantConsent records that the user approved the client's requested scopes
+func (s *OIDCService) GrantConsent(ctx context.Context, userID uint, auth *Authorization) error {
+	scopes := auth.Scopes
+	consent, err := s.oauthRepo.GetConsent(ctx, userID, auth.Client.ClientID)
+	if err != nil {
+		return err
+	}
+	if consent != nil {
+		scopes = mergeScopes(strings.Fields(consent.Scopes), scopes)
+	}
+
+	if err := s.oauthRepo.SaveConsent(ctx, &models.OAuthConsent{
+		UserID:   userID,
+		ClientID: auth.Client.ClientID,
+		Scopes:   strings.Join(scopes, " "),
+	}); err != nil {
+		return fmt.Errorf("failed to save consent: %w", err)
+	}
+
+	logging.Log.Info("OIDC consent granted",
+		zap.Uint("user_id", userID),
+		zap.String("client_id", auth.Client.ClientID),
+		zap.Strings("scopes", auth.Scopes))
+	return nil
+}
+
+// IssueCode creates an authorization code and returns the redirect that delivers it
+func (s *OIDCService) IssueCode(ctx context.Context, user *models.User, auth *Authorization, authTime time.Time) (string, error) {
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(codePayload{
+		ClientID:      auth.Client.ClientID,
+		RedirectURI:   auth.Request.RedirectURI,
+		Scope:         strings.Join(auth.Scopes, " "),
+		Nonce:         auth.Request.Nonce,
+		CodeChallenge: auth.Request.CodeChallenge,
+		AuthTime:      authTime.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode authorization code: %w", err)
+	}
+
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeOIDCCode,
+		UserID:    user.ID,
+		TokenHash: hashToken(code),
+		ExpiresAt: time.Now().Add(config.AppConfig.Auth.OIDC.CodeDuration).UTC(),
+		Payload:   string(payload),
+	}); err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+	return redirectWithParams(auth.Request.RedirectURI, params, auth.Request.State), nil
+}
+
+// Exchange handles a token endpoint request
+func (s *OIDCService) Exchange(ctx context.Context, req TokenRequest) (*OIDCTokenResponse, error) {
+	// Service accounts are not OIDC clients and only use client_credentials
+	if req.GrantType == GrantTypeClientCredentials {
+		return s.serviceAccounts.IssueToken(ctx, req)
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantTypeRefreshToken:
+		return s.exchangeRefreshToken(ctx, client, req.RefreshToken)
+	default:
+		return nil, ErrOAuthUnsupportedType
+	}
+}
+
+// exchangeCode redeems an authorization code for tokens
+func (s *OIDCService) exchangeCode(ctx context.Context, client *models.OAuthClient, req TokenRequest) (*OIDCTokenResponse, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeOIDCCode, hashToken(req.Code))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up authorization code: %w", err)
+	}
+	if record == nil || !record.IsUsable(time.Now()) {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume authorization code: %w", err)
+	}
+	if !consumed {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	var payload codePayload
+	if err := json.Unmarshal([]byte(record.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode authorization code: %w", err)
+	}
+	if payload.ClientID != client.ClientID || payload.RedirectURI != req.RedirectURI {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, payload.CodeChallenge) {
+		return nil, newOAuthError("invalid_grant", "code_verifier does not match the code challenge")
+	}
+
+	user, err := s.activeUser(ctx, strconv.Itoa(int(record.UserID)))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	familyID, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("OIDC authorization code redeemed",
+		zap.Uint("user_id", user.ID),
+		zap.String("client_id", client.ClientID))
+	return s.issueClientTokens(ctx, user, client, strings.Fields(payload.Scope), payload.Nonce, time.Unix(payload.AuthTime, 0), familyID)
+}
+
+// exchangeRefreshToken rotates a refresh token issued to the client
+func (s *OIDCService) exchangeRefreshToken(ctx context.Context, client *models.OAuthClient, refreshToken string) (*OIDCTokenResponse, error) {
+	record, err := s.authService.ValidateRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			return nil, ErrOAuthInvalidGrant
+		}
+		return nil, err
+	}
+	if record.ClientID != client.ClientID {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	marked, err := s.refreshTokenRepo.MarkUsed(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if !marked {
+		s.authService.revokeReusedFamily(ctx, record)
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	user, err := s.activeUser(ctx, strconv.Itoa(int(record.UserID)))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if err := s.refreshTokenRepo.RevokeFamily(ctx, record.FamilyID); err != nil {
+			logging.Log.Error("Failed to revoke refresh token family",
+				zap.String("family_id", record.FamilyID), zap.Error(err))
+		}
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	return s.issueClientTokens(ctx, user, client, strings.Fields(record.Scope), "", time.Time{}, record.FamilyID)
+}
+
+// issueClientTokens signs an access token and ID token for the client, and
+// stores a refresh token when offline_access was granted
+func (s *OIDCService) issueClientTokens(ctx context.Context, user *models.User, client *models.OAuthClient, scopes []string, nonce string, authTime time.Time, familyID string) (*OIDCTokenResponse, error) {
+	now := time.Now()
+	duration := config.AppConfig.Auth.OIDC.TokenDuration
+	issuer := Issuer()
+	subject := strconv.Itoa(int(user.ID))
+	scope := strings.Join(scopes, " ")
+
+	jti, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := signJWT(models.JWTClaims{
+		UserID:   subject,
+		Type:     models.TokenTypeOIDCAccess,
+		Version:  user.TokenVersion,
+		ClientID: client.ClientID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	idClaims := models.IDTokenClaims{
+		Nonce:      nonce,
+		AccessHash: accessTokenHash(accessToken),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		},
+	}
+	if !authTime.IsZero() {
+		idClaims.AuthTime = authTime.Unix()
+	}
+	claims, err := s.userClaims(ctx, user, scopes)
+	if err != nil {
+		return nil, err
+	}
+	idClaims.Email, _ = claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok {
+		idClaims.EmailVerified = &verified
+	}
+	idClaims.Name, _ = claims["name"].(string)
+	idClaims.Roles, _ = claims["roles"].([]string)
+
+	idToken, err := signJWT(idClaims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign ID token: %w", err)
+	}
+
+	response := &OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(duration.Seconds()),
+		IDToken:     idToken,
+		Scope:       scope,
+	}
+
+	if containsScope(scopes, models.ScopeOfflineAccess) {
+		refreshToken, err := generateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.refreshTokenRepo.Create(ctx, &models.RefreshToken{
+			UserID:    user.ID,
+			FamilyID:  familyID,
+			TokenHash: hashToken(refreshToken),
+			ExpiresAt: now.Add(config.AppConfig.JWT.RefreshTokenDuration).UTC(),
+			ClientID:  client.ClientID,
+			Scope:     scope,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to store refresh token: %w", err)
+		}
+		response.RefreshToken = refreshToken
+	}
+
+	return response, nil
+}
+
+// UserInfo returns the claims the access token's scopes allow the client to see
+func (s *OIDCService) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, err := validateTokenOfType(accessToken, models.TokenTypeOIDCAccess)
+	if err != nil {
+		return nil, ErrOAuthInvalidToken
+	}
+
+	user, err := s.activeUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrOAuthInvalidToken
+	}
+
+	return s.userClaims(ctx, user, strings.Fields(claims.Scope))
+}
+
+// userClaims returns the standard claims released for the given scopes
+func (s *OIDCService) userClaims(ctx context.Context, user *models.User, scopes []string) (map[string]interface{}, error) {
+	claims := map[string]interface{}{
+		"sub": strconv.Itoa(int(user.ID)),
+	}
+	if containsScope(scopes, models.ScopeProfile) {
+		claims["name"] = user.Name
+	}
+	if containsScope(scopes, models.ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsEmailVerified()
+	}
+	if containsScope(scopes, models.ScopeRoles) {
+		roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load user roles: %w", err)
+		}
+		claims["roles"] = models.RoleNames(roles)
+	}
+	return claims, nil
+}
+
+// ListConsents returns the applications a user has approved
+func (s *OIDCService) ListConsents(ctx context.Context, userID uint) ([]models.OAuthConsent, error) {
+	return s.oauthRepo.ListConsents(ctx, userID)
+}
+
+// RevokeConsent withdraws a user's approval of a client and revokes the
+// refresh tokens it holds for them
+func (s *OIDCService) RevokeConsent(ctx context.Context, userID uint, clientID string) error {
+	deleted, err := s.oauthRepo.DeleteConsent(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrClientNotFound
+	}
+	if err := s.refreshTokenRepo.RevokeForClient(ctx, clientID, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	logging.Log.Info("OIDC consent revoked", zap.Uint("user_id", userID), zap.String("client_id", clientID))
+	return nil
+}
+
+// ClientName returns the display name of a client, or its ID if it no longer exists
+func (s *OIDCService) ClientName(ctx context.Context, clientID string) string {
+	client, err := s.oauthRepo.GetByClientID(ctx, clientID)
+	if err != nil || client == nil {
+		return clientID
+	}
+	return client.Name
+}
+
+// authenticateClient checks the client's credentials. Public clients have no
+// secret and are bound to the code by PKCE instead.
+func (s *OIDCService) authenticateClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, ErrOAuthInvalidClient
+	}
+
+	client, err := s.oauthRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, ErrOAuthInvalidClient
+	}
+
+	if client.Public {
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		logging.Log.Warn("OIDC client authentication failed", zap.String("client_id", clientID))
+		return nil, ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+// activeUser loads a user by ID string, returning nil if they are deleted or disabled
+func (s *OIDCService) activeUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	user, err := s.userRepo.GetByID(ctx, uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// accessTokenHash computes the at_hash ID token claim: the left half of the
+// access token's hash, using the hash function of the signing algorithm
+func accessTokenHash(accessToken string) string {
+	if signingAlgorithm() == jwks.EdDSA {
+		sum := sha512.Sum512([]byte(accessToken))
+		return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against an S256 challenge
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// grantableScopes returns the requested scopes the client is allowed, in a
+// stable order with openid first. Unknown or disallowed scopes are dropped.
+func grantableScopes(requested, allowed []string) []string {
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range models.SupportedScopes {
+		if containsScope(requested, scope) && (scope == models.ScopeOpenID || containsScope(allowed, scope)) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// mergeScopes returns the union of two scope lists in supported scope order
+func mergeScopes(a, b []string) []string {
+	merged := make([]string, 0, len(a)+len(b))
+	for _, scope := range models.SupportedScopes {
+		if containsScope(a, scope) || containsScope(b, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return merged
+}
+
+// containsScope reports whether scopes includes scope
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectWithParams appends params, the state and the issuer to a redirect URI
+func redirectWithParams(redirectURI string, params url.Values, state string) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	params.Set("iss", Issuer())
+
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// Example from RFC 7636, appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !verifyCodeChallenge(verifier, challenge) {
+		t.Error("expected the RFC 7636 verifier to match")
+	}
+	if verifyCodeChallenge(verifier+"x", challenge) {
+		t.Error("expected a different verifier not to match")
+	}
+	if verifyCodeChallenge("", challenge) {
+		t.Error("expected an empty verifier not to match")
+	}
+}
+
+func TestGrantableScopes(t *testing.T) {
+	allowed := []string{models.ScopeOpenID, models.ScopeEmail}
+	got := grantableScopes([]string{"email", "roles", "bogus", "openid"}, allowed)
+	want := []string{models.ScopeOpenID, models.ScopeEmail}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("grantableScopes() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateRedirectURIs(t *testing.T) {
+	valid, err := validateRedirectURIs([]string{"https://app.home/cb", "http://localhost:3000/cb", "https://app.home/cb"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(valid) != 2 {
+		t.Fatalf("expected duplicates to be removed, got %v", valid)
+	}
+
+	for _, uri := range []string{"/relative", "https://app.home/cb#frag", "javascript:alert(1)", "ftp://app.home/cb"} {
+		if _, err := validateRedirectURIs([]string{uri}); !errors.Is(err, ErrInvalidRedirectURIs) {
+			t.Errorf("%q: expected ErrInvalidRedirectURIs, got %v", uri, err)
+		}
+	}
+	if _, err := validateRedirectURIs(nil); !errors.Is(err, ErrRedirectURIsRequired) {
+		t.Errorf("expected ErrRedirectURIsRequired, got %v", err)
+	}
+}
+
+func TestConsentCovers(t *testing.T) {
+	consent := models.OAuthConsent{Scopes: "openid email"}
+	if !consent.Covers([]string{models.ScopeOpenID}) {
+		t.Error("expected consent to cover openid")
+	}
+	if consent.Covers([]string{models.ScopeOpenID, models.ScopeRoles}) {
+		t.Error("expected consent not to cover roles")
+	}
+}
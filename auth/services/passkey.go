@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned by the passkey flows
+var (
+	ErrPasskeyNotFound       = errors.New("passkey not found")
+	ErrInvalidPasskeySession = errors.New("invalid or expired passkey session")
+	ErrPasskeyRejected       = errors.New("passkey verification failed")
+)
+
+// PasskeyService runs WebAuthn registration and discoverable login ceremonies
+type PasskeyService struct {
+	passkeyRepo *db.PasskeyRepository
+	userRepo    *db.UserRepository
+	tokenRepo   *db.OneTimeTokenRepository
+	authService *AuthService
+	webAuthn    *webauthn.WebAuthn
+}
+
+// NewPasskeyService creates a new PasskeyService from the auth.webauthn configuration
+func NewPasskeyService(passkeyRepo *db.PasskeyRepository, userRepo *db.UserRepository, tokenRepo *db.OneTimeTokenRepository, authService *AuthService) (*PasskeyService, error) {
+	cfg := config.AppConfig.Auth.WebAuthn
+
+	origins := cfg.RPOrigins
+	if len(origins) == 0 {
+		origins = []string{config.AppConfig.Auth.PublicURL}
+	}
+	ceremony := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    cfg.CeremonyDuration,
+		TimeoutUVD: cfg.CeremonyDuration,
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        ceremony,
+			Registration: ceremony,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn configuration: %w", err)
+	}
+
+	return &PasskeyService{
+		passkeyRepo: passkeyRepo,
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		authService: authService,
+		webAuthn:    w,
+	}, nil
+}
+
+// BeginRegistration starts registering a new passkey for the user. It returns a
+// session ID to send back with the result and the options for navigator.credentials.create.
+func (s *PasskeyService) BeginRegistration(ctx context.Context, userID uint) (string, *protocol.CredentialCreation, error) {
+	user, err := s.loadPasskeyUser(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Stop the browser from registering the same authenticator twice
+	exclusions := webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()
+	creation, session, err := s.webAuthn.BeginRegistration(user, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin passkey registration: %w", err)
+	}
+
+	sessionID, err := s.saveSession(ctx, models.TokenPurposePasskeyRegister, userID, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return sessionID, creation, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new passkey
+func (s *PasskeyService) FinishRegistration(ctx context.Context, userID uint, sessionID, name string, response []byte) (*models.PasskeyCredential, error) {
+	session, err := s.consumeSession(ctx, models.TokenPurposePasskeyRegister, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadPasskeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		logging.Log.Warn("Invalid passkey registration response", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, ErrPasskeyRejected
+	}
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		logging.Log.Warn("Passkey registration rejected", zap.Uint("user_id", userID), zap.Error(err))
+		return nil, ErrPasskeyRejected
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	passkey := &models.PasskeyCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.passkeyRepo.Create(ctx, passkey); err != nil {
+		return nil, fmt.Errorf("failed to store passkey: %w", err)
+	}
+
+	logging.Log.Info("Passkey registered", zap.Uint("user_id", userID), zap.Uint("passkey_id", passkey.ID))
+	return passkey, nil
+}
+
+// List returns the user's registered passkeys
+func (s *PasskeyService) List(ctx context.Context, userID uint) ([]models.PasskeyCredential, error) {
+	return s.passkeyRepo.ListForUser(ctx, userID)
+}
+
+// Delete removes one of the user's passkeys
+func (s *PasskeyService) Delete(ctx context.Context, userID, passkeyID uint) error {
+	deleted, err := s.passkeyRepo.DeleteForUser(ctx, userID, passkeyID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPasskeyNotFound
+	}
+
+	logging.Log.Info("Passkey deleted", zap.Uint("user_id", userID), zap.Uint("passkey_id", passkeyID))
+	return nil
+}
+
+// BeginLogin starts a discoverable-credential login, so the user does not need to type an email
+func (s *PasskeyService) BeginLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to begin passkey login: %w", err)
+	}
+
+	sessionID, err := s.saveSession(ctx, models.TokenPurposePasskeyLogin, 0, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return sessionID, assertion, nil
+}
+
+// FinishLogin verifies the assertion and issues a token pair for the passkey's owner.
+// Every attempt is recorded in the audit log.
+func (s *PasskeyService) FinishLogin(ctx context.Context, sessionID string, response []byte) (*models.User, string, string, int64, error) {
+	// fail records a failed attempt, for the passkey's owner once it is known
+	fail := func(userID uint, err error) (*models.User, string, string, int64, error) {
+		s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventPasskeyLogin, userID, err))
+		return nil, "", "", 0, err
+	}
+
+	session, err := s.consumeSession(ctx, models.TokenPurposePasskeyLogin, sessionID, 0)
+	if err != nil {
+		return fail(0, err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		logging.Log.Warn("Invalid passkey login response", zap.Error(err))
+		return fail(0, ErrPasskeyRejected)
+	}
+
+	var owner *passkeyUser
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := strconv.ParseUint(string(userHandle), 10, 64)
+		if err != nil {
+			return nil, ErrPasskeyNotFound
+		}
+		owner, err = s.loadPasskeyUser(ctx, uint(userID))
+		return owner, err
+	}, *session, parsed)
+	if err != nil {
+		logging.Log.Warn("Passkey login rejected", zap.Error(err))
+		return fail(0, ErrPasskeyRejected)
+	}
+
+	stored, err := s.passkeyRepo.GetByCredentialID(ctx, base64.RawURLEncoding.EncodeToString(credential.ID))
+	if err != nil {
+		return fail(owner.user.ID, err)
+	}
+	if stored == nil || stored.UserID != owner.user.ID {
+		return fail(owner.user.ID, ErrPasskeyRejected)
+	}
+
+	// A counter that went backwards means the authenticator may have been cloned
+	if credential.Authenticator.CloneWarning {
+		logging.Log.Warn("Passkey signature counter regressed, rejecting login",
+			zap.Uint("user_id", stored.UserID), zap.Uint("passkey_id", stored.ID))
+		return fail(stored.UserID, ErrPasskeyRejected)
+	}
+
+	if err := s.passkeyRepo.RecordUse(ctx, stored.ID, credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		return fail(stored.UserID, err)
+	}
+
+	user := owner.user
+	if user.Disabled {
+		return fail(user.ID, ErrUserInactive)
+	}
+	if !user.IsEmailVerified() {
+		return fail(user.ID, ErrEmailNotVerified)
+	}
+
+	accessToken, refreshToken, expiresIn, err := s.authService.GenerateTokenPair(ctx, user)
+	if err != nil {
+		return fail(user.ID, err)
+	}
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventPasskeyLogin, user.ID, nil))
+
+	logging.Log.Info("User logged in with passkey", zap.Uint("user_id", user.ID), zap.Uint("passkey_id", stored.ID))
+	return user, accessToken, refreshToken, expiresIn, nil
+}
+
+// saveSession stores the WebAuthn session data behind a single-use session ID
+func (s *PasskeyService) saveSession(ctx context.Context, purpose string, userID uint, session *webauthn.SessionData) (string, error) {
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode passkey session: %w", err)
+	}
+
+	sessionID, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   purpose,
+		UserID:    userID,
+		TokenHash: hashToken(sessionID),
+		ExpiresAt: time.Now().Add(config.AppConfig.Auth.WebAuthn.CeremonyDuration).UTC(),
+		Payload:   string(payload),
+	}); err != nil {
+		return "", fmt.Errorf("failed to store passkey session: %w", err)
+	}
+	return sessionID, nil
+}
+
+// consumeSession loads and burns a WebAuthn session. Each ceremony gets one attempt.
+func (s *PasskeyService) consumeSession(ctx context.Context, purpose, sessionID string, userID uint) (*webauthn.SessionData, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, purpose, hashToken(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up passkey session: %w", err)
+	}
+	if record == nil || record.UserID != userID || !record.IsUsable(time.Now()) {
+		return nil, ErrInvalidPasskeySession
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume passkey session: %w", err)
+	}
+	if !consumed {
+		return nil, ErrInvalidPasskeySession
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(record.Payload), &session); err != nil {
+		return nil, fmt.Errorf("failed to decode passkey session: %w", err)
+	}
+	return &session, nil
+}
+
+// loadPasskeyUser loads a user together with their passkeys
+func (s *PasskeyService) loadPasskeyUser(ctx context.Context, userID uint) (*passkeyUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserInactive
+	}
+
+	credentials, err := s.passkeyRepo.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// passkeyUser adapts a user and their stored passkeys to webauthn.User
+type passkeyUser struct {
+	user        *models.User
+	credentials []models.PasskeyCredential
+}
+
+// WebAuthnID returns the user handle stored in discoverable credentials
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+// WebAuthnName returns the account name shown by the authenticator
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+// WebAuthnDisplayName returns the friendly name shown by the authenticator
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Email
+}
+
+// WebAuthnCredentials converts the stored passkeys to webauthn credentials
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, stored := range u.credentials {
+		id, err := base64.RawURLEncoding.DecodeString(stored.CredentialID)
+		if err != nil {
+			continue
+		}
+
+		var transports []protocol.AuthenticatorTransport
+		if stored.Transports != "" {
+			for _, transport := range strings.Split(stored.Transports, ",") {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   true,
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    stored.AAGUID,
+				SignCount: stored.SignCount,
+			},
+		})
+	}
+	return credentials
+}
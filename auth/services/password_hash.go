@@ -0,0 +1,221 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+)
+
+// Password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ErrUnknownHashFormat is returned for stored hashes no hasher recognizes
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher computes and checks one kind of password hash. Encoded hashes
+// name their algorithm and parameters, so hashers can tell their own apart.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches an encoded hash of this kind
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether the encoded hash was made by this kind of hasher
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether a recognized hash was made with other parameters
+	NeedsRehash(encoded string) bool
+}
+
+// passwordHashers holds the hasher used for new passwords and every hasher
+// whose hashes are still accepted
+type passwordHashers struct {
+	current PasswordHasher
+	all     []PasswordHasher
+}
+
+// hashers is configured by InitializePasswordHasher
+var hashers *passwordHashers
+
+// InitializePasswordHasher sets up password hashing from the configuration
+func InitializePasswordHasher() error {
+	cfg := config.AppConfig.Auth.PasswordHashing
+	configured, err := newPasswordHashers(cfg)
+	if err != nil {
+		return err
+	}
+	hashers = configured
+
+	logging.Log.Info("Password hashing initialized", zap.String("algorithm", cfg.Algorithm))
+	return nil
+}
+
+// newPasswordHashers builds the hashers for a configuration. Both algorithms are
+// always accepted so that switching between them never locks anyone out.
+func newPasswordHashers(cfg config.PasswordHashingConfig) (*passwordHashers, error) {
+	if cfg.Memory == 0 || cfg.Iterations == 0 || cfg.Parallelism == 0 {
+		return nil, errors.New("argon2id memory, iterations and parallelism must be positive")
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	argon := &argon2idHasher{params: argon2Params{
+		memory:      cfg.Memory,
+		iterations:  cfg.Iterations,
+		parallelism: cfg.Parallelism,
+	}}
+	legacy := &bcryptHasher{cost: cfg.BcryptCost}
+
+	result := &passwordHashers{all: []PasswordHasher{argon, legacy}}
+	switch cfg.Algorithm {
+	case HashArgon2id:
+		result.current = argon
+	case HashBcrypt:
+		result.current = legacy
+	default:
+		return nil, fmt.Errorf("unsupported password hashing algorithm %q", cfg.Algorithm)
+	}
+	return result, nil
+}
+
+// hash hashes a new password with the configured algorithm
+func (h *passwordHashers) hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+// verify checks a password against a hash made by any accepted hasher
+func (h *passwordHashers) verify(password, encoded string) (bool, error) {
+	for _, hasher := range h.all {
+		if hasher.Recognizes(encoded) {
+			return hasher.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownHashFormat
+}
+
+// needsRehash reports whether a hash should be replaced with one made by the
+// configured algorithm and parameters
+func (h *passwordHashers) needsRehash(encoded string) bool {
+	return !h.current.Recognizes(encoded) || h.current.NeedsRehash(encoded)
+}
+
+// argon2Params are the cost parameters of an argon2id hash
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// argon2idHasher produces hashes in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+type argon2idHasher struct {
+	params argon2Params
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		HashArgon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, salt, key, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(computed, key) == 1, nil
+}
+
+func (h *argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$"+HashArgon2id+"$")
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	p, _, _, err := parseArgon2id(encoded)
+	return err != nil || p != h.params
+}
+
+// parseArgon2id splits an encoded argon2id hash into its parameters, salt and key
+func parseArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+	if p.memory == 0 || p.iterations == 0 || p.parallelism == 0 {
+		return p, nil, nil, errors.New("invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errors.New("invalid argon2 key")
+	}
+	return p, salt, key, nil
+}
+
+// bcryptHasher produces and checks bcrypt hashes ($2a$, $2b$ or $2y$)
+type bcryptHasher struct {
+	cost int
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hashed), err
+}
+
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *bcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
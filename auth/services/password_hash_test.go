@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/shashank/home-server/common/config"
+)
+
+// testHashingConfig keeps argon2id cheap enough for tests
+func testHashingConfig(algorithm string) config.PasswordHashingConfig {
+	return config.PasswordHashingConfig{
+		Algorithm:   algorithm,
+		Memory:      64,
+		Iterations:  1,
+		Parallelism: 1,
+		BcryptCost:  bcrypt.MinCost,
+	}
+}
+
+func TestArgon2idHashAndVerify(t *testing.T) {
+	h, err := newPasswordHashers(testHashingConfig(HashArgon2id))
+	if err != nil {
+		t.Fatalf("newPasswordHashers() error: %v", err)
+	}
+
+	encoded, err := h.hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("hash() error: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("encoded hash = %q, want the PHC argon2id format", encoded)
+	}
+
+	if ok, err := h.verify("correct horse battery staple", encoded); !ok || err != nil {
+		t.Errorf("verify(correct) = %v, %v", ok, err)
+	}
+	if ok, _ := h.verify("wrong password", encoded); ok {
+		t.Error("verify(wrong) = true")
+	}
+	if h.needsRehash(encoded) {
+		t.Error("needsRehash() = true for a hash with the current parameters")
+	}
+
+	stronger := testHashingConfig(HashArgon2id)
+	stronger.Iterations = 2
+	upgraded, _ := newPasswordHashers(stronger)
+	if !upgraded.needsRehash(encoded) {
+		t.Error("needsRehash() = false after the iterations changed")
+	}
+	if ok, _ := upgraded.verify("correct horse battery staple", encoded); !ok {
+		t.Error("hash with old parameters no longer verifies")
+	}
+}
+
+func TestLegacyBcryptHashes(t *testing.T) {
+	h, err := newPasswordHashers(testHashingConfig(HashArgon2id))
+	if err != nil {
+		t.Fatalf("newPasswordHashers() error: %v", err)
+	}
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("hunter2hunter2"), bcrypt.MinCost)
+	if ok, err := h.verify("hunter2hunter2", string(legacy)); !ok || err != nil {
+		t.Errorf("verify(bcrypt) = %v, %v", ok, err)
+	}
+	if ok, _ := h.verify("hunter3hunter3", string(legacy)); ok {
+		t.Error("verify(bcrypt, wrong) = true")
+	}
+	if !h.needsRehash(string(legacy)) {
+		t.Error("needsRehash() = false for a bcrypt hash while argon2id is configured")
+	}
+
+	if _, err := h.verify("anything", "plaintext"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("verify(unknown format) error = %v, want ErrUnknownHashFormat", err)
+	}
+}
+
+func TestNewPasswordHashersRejectsBadConfig(t *testing.T) {
+	unknown := testHashingConfig("md5")
+	if _, err := newPasswordHashers(unknown); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+
+	noMemory := testHashingConfig(HashArgon2id)
+	noMemory.Memory = 0
+	if _, err := newPasswordHashers(noMemory); err == nil {
+		t.Error("expected zero argon2id memory to be rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shashank/home-server/common/config"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the lowercased set of passwords rejected by the policy
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+// PasswordPolicyError describes why a password was rejected
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + e.Reason
+}
+
+// ValidatePassword checks a new password against the configured policy
+func ValidatePassword(password, email string) error {
+	return validatePasswordWithPolicy(config.AppConfig.Auth.PasswordPolicy, password, email)
+}
+
+func validatePasswordWithPolicy(policy config.PasswordPolicyConfig, password, email string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("must be at least %d characters long", policy.MinLength)}
+	}
+
+	lowered := strings.ToLower(password)
+
+	if policy.BlockCommon {
+		if _, found := commonPasswords[lowered]; found {
+			return &PasswordPolicyError{Reason: "is too common"}
+		}
+	}
+
+	if policy.DisallowEmail && email != "" {
+		email = normalizeEmail(email)
+		localPart, _, _ := strings.Cut(email, "@")
+		if lowered == email || lowered == localPart {
+			return &PasswordPolicyError{Reason: "must not match your email address"}
+		}
+	}
+
+	return nil
+}
+
+// parseCommonPasswords reads one password per line, skipping blanks and comments
+func parseCommonPasswords(data string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shashank/home-server/common/config"
+)
+
+func TestValidatePasswordWithPolicy(t *testing.T) {
+	policy := config.PasswordPolicyConfig{
+		MinLength:     10,
+		BlockCommon:   true,
+		DisallowEmail: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		wantErr  bool
+	}{
+		{"valid", "correct horse battery", "user@example.com", false},
+		{"too short", "short1!", "user@example.com", true},
+		{"common", "Password123", "user@example.com", true},
+		{"equals email", "Someone@Example.com", "someone@example.com", true},
+		{"equals local part", "someone.longname", "someone.longname@example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePasswordWithPolicy(policy, tt.password, tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			var policyErr *PasswordPolicyError
+			if err != nil && !errors.As(err, &policyErr) {
+				t.Errorf("Expected PasswordPolicyError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordsLoaded(t *testing.T) {
+	if len(commonPasswords) < 100 {
+		t.Errorf("Expected bundled common password list to be loaded, got %d entries", len(commonPasswords))
+	}
+	if _, ok := commonPasswords["# common passwords rejected by the password policy (one per line, case-insensitive)."]; ok {
+		t.Error("Expected comment lines to be skipped")
+	}
+}
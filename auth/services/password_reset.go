@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
+	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/ratelimit"
+)
+
+// Errors returned by the password reset flow
+var (
+	ErrRateLimited       = errors.New("too many requests, please try again later")
+	ErrInvalidResetToken = errors.New("invalid or expired password reset link")
+)
+
+// PasswordResetService handles forgotten password recovery
+type PasswordResetService struct {
+	userRepo     *db.UserRepository
+	tokenRepo    *db.OneTimeTokenRepository
+	authService  *AuthService
+	mailer       mail.Mailer
+	emailLimiter *ratelimit.KeyedLimiter
+	ipLimiter    *ratelimit.KeyedLimiter
+}
+
+// NewPasswordResetService creates a new PasswordResetService
+func NewPasswordResetService(userRepo *db.UserRepository, tokenRepo *db.OneTimeTokenRepository, authService *AuthService, mailer mail.Mailer) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		authService:  authService,
+		mailer:       mailer,
+		emailLimiter: ratelimit.PerWindow(config.AppConfig.Auth.ResetRequestsPerEmail, time.Hour),
+		ipLimiter:    ratelimit.PerWindow(config.AppConfig.Auth.ResetRequestsPerIP, time.Hour),
+	}
+}
+
+// RequestReset emails a password reset link if the account exists.
+// Only rate limiting is reported to the caller so that accounts cannot be
+// enumerated. The account is looked up and emailed in the background, so the
+// response takes the same time either way.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email, clientIP string) error {
+	email = normalizeEmail(email)
+
+	if !s.ipLimiter.Allow(clientIP) || !s.emailLimiter.Allow(email) {
+		logging.Log.Warn("Password reset rate limit exceeded", zap.String("ip", clientIP))
+		return ErrRateLimited
+	}
+
+	go s.requestReset(context.WithoutCancel(ctx), email)
+	return nil
+}
+
+// requestReset does the work of RequestReset after the caller was answered,
+// so failures are only logged
+func (s *PasswordResetService) requestReset(ctx context.Context, email string) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		logging.Log.Error("Failed to look up account for password reset", zap.Error(err))
+		return
+	}
+	if user == nil || user.Disabled {
+		logging.Log.Info("Password reset requested for unknown or disabled account")
+		return
+	}
+
+	if err := s.sendResetLink(ctx, user,
+		"Someone asked to reset the password for your account.",
+		" If you did not ask for this, you can ignore this email."); err != nil {
+		logging.Log.Error("Failed to send password reset link", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+}
+
+// ResetPassword sets a new password using a reset token and revokes all of the user's sessions
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	userID, err := s.resetPassword(ctx, token, newPassword)
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventPasswordReset, userID, err))
+	return err
+}
+
+// resetPassword does the work of ResetPassword and returns the ID of the
+// user the token belongs to, when known
+func (s *PasswordResetService) resetPassword(ctx context.Context, token, newPassword string) (uint, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposePasswordReset, hashToken(token))
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up reset token: %w", err)
+	}
+	if record == nil || !record.IsUsable(time.Now()) {
+		return 0, ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return record.UserID, err
+	}
+	if user == nil || user.Disabled {
+		return record.UserID, ErrInvalidResetToken
+	}
+
+	// Check the policy before burning the token so the user can retry
+	if err := ValidatePassword(newPassword, user.Email); err != nil {
+		return user.ID, err
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return user.ID, fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	if !consumed {
+		return user.ID, ErrInvalidResetToken
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return user.ID, fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return user.ID, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := s.authService.RevokeAllSessions(ctx, user.ID); err != nil {
+		return user.ID, err
+	}
+
+	logging.Log.Info("Password reset completed", zap.Uint("user_id", user.ID))
+	return user.ID, nil
+}
+
+// ForceReset is used by admins: it replaces the user's password with an unusable
+// one, signs out every session and emails a reset link
+func (s *PasswordResetService) ForceReset(ctx context.Context, userID, adminID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	placeholder, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(placeholder)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := s.authService.RevokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := s.sendResetLink(ctx, user, "An administrator has reset the password for your account.", ""); err != nil {
+		return err
+	}
+
+	logging.Log.Warn("Password reset forced by admin", zap.Uint("user_id", user.ID), zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// sendResetLink invalidates earlier reset links and emails a new one. The intro
+// and outro sentences explain why the email was sent.
+func (s *PasswordResetService) sendResetLink(ctx context.Context, user *models.User, intro, outro string) error {
+	// Only the most recent link stays valid
+	if err := s.tokenRepo.InvalidateForUser(ctx, models.TokenPurposePasswordReset, user.ID); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := config.AppConfig.Auth.PasswordResetDuration
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposePasswordReset,
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	link := publicLink("/an/reset-password", url.Values{"token": {token}})
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"%s Open this link to choose a new one:\n%s\n\n"+
+			"The link expires in %s and can only be used once.%s\n",
+			user.Name, intro, link, ttl, outro),
+	}); err != nil {
+		return fmt.Errorf("failed to send reset email: %w", err)
+	}
+
+	logging.Log.Info("Password reset email sent", zap.Uint("user_id", user.ID))
+	return nil
+}
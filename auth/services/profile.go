@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned when users edit their own profile
+var (
+	ErrProfileConflict    = errors.New("profile was changed by another request")
+	ErrInvalidName        = errors.New("name must not be empty")
+	ErrInvalidEmailChange = errors.New("invalid or expired email change link")
+	ErrPasswordRequired   = errors.New("current password is required to change the email address")
+)
+
+// ProfileUpdate holds the fields users may change on their own profile. Nil
+// fields are left unchanged. UpdatedAt is the profile's updated_at as last read
+// by the client; the update is rejected if the profile has changed since.
+// Changing the email address also needs the current password, so an access
+// token alone cannot move the account to another mailbox.
+type ProfileUpdate struct {
+	Name            *string
+	Email           *string
+	CurrentPassword string
+	UpdatedAt       time.Time
+}
+
+// ProfileService lets users edit their own profile
+type ProfileService struct {
+	userRepo    *db.UserRepository
+	tokenRepo   *db.OneTimeTokenRepository
+	authService *AuthService
+	mailer      mail.Mailer
+}
+
+// NewProfileService creates a new ProfileService
+func NewProfileService(userRepo *db.UserRepository, tokenRepo *db.OneTimeTokenRepository, authService *AuthService, mailer mail.Mailer) *ProfileService {
+	return &ProfileService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		authService: authService,
+		mailer:      mailer,
+	}
+}
+
+// UpdateProfile applies a partial update to a user's own profile. A new name is
+// saved at once. A new email address only takes effect once it is confirmed with
+// the link sent to it, and is returned as pendingEmail until then. Every update
+// is recorded in the audit log.
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID uint, update ProfileUpdate) (user *models.User, pendingEmail string, err error) {
+	user, pendingEmail, err = s.updateProfile(ctx, userID, update)
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventProfileUpdate, userID, err))
+	return user, pendingEmail, err
+}
+
+func (s *ProfileService) updateProfile(ctx context.Context, userID uint, update ProfileUpdate) (*models.User, string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if user == nil {
+		return nil, "", ErrUserNotFound
+	}
+	if err := checkProfileVersion(user, update.UpdatedAt); err != nil {
+		return nil, "", err
+	}
+
+	newEmail := pendingEmailChange(user, update)
+	if newEmail != "" {
+		if update.CurrentPassword == "" {
+			return nil, "", ErrPasswordRequired
+		}
+		if err := s.authService.verifyCurrentPassword(ctx, user, update.CurrentPassword); err != nil {
+			return nil, "", err
+		}
+
+		inUse, err := s.userRepo.EmailInUse(ctx, newEmail)
+		if err != nil {
+			return nil, "", err
+		}
+		if inUse {
+			return nil, "", ErrEmailTaken
+		}
+	}
+
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, "", ErrInvalidName
+		}
+		if name != user.Name {
+			// Postgres keeps microseconds, so the value returned to the client must too
+			now := time.Now().UTC().Truncate(time.Microsecond)
+			updated, err := s.userRepo.UpdateFieldsIfUnmodified(ctx, user.ID, user.UpdatedAt, map[string]interface{}{
+				"name":       name,
+				"updated_at": now,
+			})
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to update profile: %w", err)
+			}
+			if !updated {
+				return nil, "", ErrProfileConflict
+			}
+			user.Name = name
+			user.UpdatedAt = now
+		}
+	}
+
+	if newEmail != "" {
+		if err := s.sendEmailChange(ctx, user, newEmail); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return user, newEmail, nil
+}
+
+// ConfirmEmailChange consumes an email change token and switches the user to the
+// confirmed address. The attempt is recorded in the audit log.
+func (s *ProfileService) ConfirmEmailChange(ctx context.Context, token string) (*models.User, error) {
+	user, userID, err := s.confirmEmailChange(ctx, token)
+	event := NewAuthEvent(models.AuthEventEmailChange, userID, err)
+	if user != nil {
+		event.Email = user.Email
+	}
+	s.authService.RecordEvent(ctx, event)
+	return user, err
+}
+
+// confirmEmailChange does the work of ConfirmEmailChange and returns the ID of
+// the user the token belongs to, when known
+func (s *ProfileService) confirmEmailChange(ctx context.Context, token string) (*models.User, uint, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeEmailChange, hashToken(token))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up email change token: %w", err)
+	}
+	if err := checkEmailChangeToken(record, time.Now()); err != nil {
+		return nil, 0, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, record.UserID, err
+	}
+	if user == nil || user.Disabled {
+		return nil, record.UserID, ErrInvalidEmailChange
+	}
+
+	// Someone may have taken the address since the link was sent
+	inUse, err := s.userRepo.EmailInUse(ctx, record.Email)
+	if err != nil {
+		return nil, user.ID, err
+	}
+	if inUse {
+		return nil, user.ID, ErrEmailTaken
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, user.ID, fmt.Errorf("failed to consume email change token: %w", err)
+	}
+	if !consumed {
+		return nil, user.ID, ErrInvalidEmailChange
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	oldEmail := user.Email
+	applyEmailChange(user, record.Email, now)
+	if err := s.userRepo.UpdateEmail(ctx, user.ID, user.Email, now); err != nil {
+		return nil, user.ID, fmt.Errorf("failed to update email: %w", err)
+	}
+
+	// Access tokens carry the old address; sessions get new ones at their next refresh
+	if err := s.authService.invalidateAccessTokens(ctx, user.ID); err != nil {
+		return nil, user.ID, err
+	}
+
+	// Let the old address know in case the change was not made by its owner
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"The email address of your Home Server account was changed to %s.\n"+
+			"If you did not make this change, contact your administrator.\n",
+			user.Name, user.Email),
+	}); err != nil {
+		logging.Log.Error("Failed to send email change notice", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+
+	logging.Log.Info("Email address changed", zap.Uint("user_id", user.ID))
+	return user, user.ID, nil
+}
+
+// checkProfileVersion rejects an update made against an older copy of the profile
+func checkProfileVersion(user *models.User, updatedAt time.Time) error {
+	if !user.UpdatedAt.Equal(updatedAt) {
+		return ErrProfileConflict
+	}
+	return nil
+}
+
+// pendingEmailChange returns the normalized address an update asks to switch
+// to, or "" if it keeps the current one. The user is not changed: the address
+// only takes effect once it is confirmed.
+func pendingEmailChange(user *models.User, update ProfileUpdate) string {
+	if update.Email == nil {
+		return ""
+	}
+	if email := normalizeEmail(*update.Email); email != normalizeEmail(user.Email) {
+		return email
+	}
+	return ""
+}
+
+// checkEmailChangeToken rejects unknown, used and expired email change links
+func checkEmailChangeToken(record *models.OneTimeToken, now time.Time) error {
+	if record == nil || !record.IsUsable(now) {
+		return ErrInvalidEmailChange
+	}
+	return nil
+}
+
+// applyEmailChange switches the user to a confirmed address, which counts as verifying it
+func applyEmailChange(user *models.User, email string, now time.Time) {
+	user.Email = email
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+}
+
+// sendEmailChange emails a confirmation link to the new address. Links sent for
+// earlier changes stop working.
+func (s *ProfileService) sendEmailChange(ctx context.Context, user *models.User, newEmail string) error {
+	if err := s.tokenRepo.InvalidateForUser(ctx, models.TokenPurposeEmailChange, user.ID); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := config.AppConfig.Auth.EmailChangeDuration
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeEmailChange,
+		UserID:    user.ID,
+		Email:     newEmail,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to store email change token: %w", err)
+	}
+
+	link := publicLink(config.AppConfig.API.BaseURL+"/auth/email/confirm", url.Values{"token": {token}})
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm that you want to use this address for your Home Server account by opening this link:\n%s\n\n"+
+			"The link expires in %s. Until then your account keeps its current address.\n",
+			user.Name, link, ttl),
+	}); err != nil {
+		return fmt.Errorf("failed to send email change confirmation: %w", err)
+	}
+
+	// Warn the current address while the change can still be stopped
+	if err := s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Email address change requested",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to change the email address of your Home Server account to %s.\n"+
+			"It only changes once the link sent to that address is opened. If you did not ask for this, change\n"+
+			"your password and contact your administrator.\n",
+			user.Name, newEmail),
+	}); err != nil {
+		logging.Log.Error("Failed to send email change notice", zap.Uint("user_id", user.ID), zap.Error(err))
+	}
+
+	logging.Log.Info("Email change requested", zap.Uint("user_id", user.ID))
+	return nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestCheckProfileVersion(t *testing.T) {
+	updatedAt := time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	user := &models.User{BaseModel: models.BaseModel{UpdatedAt: updatedAt}}
+
+	if err := checkProfileVersion(user, updatedAt); err != nil {
+		t.Errorf("expected the current version to be accepted, got %v", err)
+	}
+	if err := checkProfileVersion(user, updatedAt.In(time.FixedZone("CET", 3600))); err != nil {
+		t.Errorf("expected the same instant in another zone to be accepted, got %v", err)
+	}
+	if err := checkProfileVersion(user, updatedAt.Add(-time.Microsecond)); !errors.Is(err, ErrProfileConflict) {
+		t.Errorf("expected an older version to conflict, got %v", err)
+	}
+	if err := checkProfileVersion(user, time.Time{}); !errors.Is(err, ErrProfileConflict) {
+		t.Errorf("expected a missing version to conflict, got %v", err)
+	}
+}
+
+func TestEmailChangeAppliesOnlyAfterConfirmation(t *testing.T) {
+	user := &models.User{Email: "old@example.com"}
+	requested := "  New@Example.com "
+
+	pending := pendingEmailChange(user, ProfileUpdate{Email: &requested})
+	if pending != "new@example.com" {
+		t.Fatalf("pendingEmailChange() = %q, want the normalized new address", pending)
+	}
+	if user.Email != "old@example.com" || user.EmailVerifiedAt != nil {
+		t.Fatalf("expected the user to keep their address until confirmation, got %q", user.Email)
+	}
+
+	same := "OLD@example.com"
+	if got := pendingEmailChange(user, ProfileUpdate{Email: &same}); got != "" {
+		t.Errorf("pendingEmailChange(current address) = %q, want none", got)
+	}
+	if got := pendingEmailChange(user, ProfileUpdate{}); got != "" {
+		t.Errorf("pendingEmailChange(no email) = %q, want none", got)
+	}
+
+	now := time.Now()
+	used := now.Add(-time.Minute)
+	link := &models.OneTimeToken{Purpose: models.TokenPurposeEmailChange, Email: pending, ExpiresAt: now.Add(time.Hour)}
+	if err := checkEmailChangeToken(link, now); err != nil {
+		t.Fatalf("expected the confirmation link to be accepted, got %v", err)
+	}
+	for name, record := range map[string]*models.OneTimeToken{
+		"unknown": nil,
+		"used":    {Email: pending, ExpiresAt: now.Add(time.Hour), UsedAt: &used},
+		"expired": {Email: pending, ExpiresAt: now.Add(-time.Second)},
+	} {
+		if err := checkEmailChangeToken(record, now); !errors.Is(err, ErrInvalidEmailChange) {
+			t.Errorf("%s link: checkEmailChangeToken() = %v, want ErrInvalidEmailChange", name, err)
+		}
+	}
+
+	applyEmailChange(user, link.Email, now)
+	if user.Email != "new@example.com" {
+		t.Errorf("expected the confirmed address to be applied, got %q", user.Email)
+	}
+	if !user.IsEmailVerified() || !user.UpdatedAt.Equal(now) {
+		t.Errorf("expected the confirmed address to be verified and the profile version bumped")
+	}
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/mail"
+	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/ratelimit"
+)
+
+// Registration modes that admins can switch between
+const (
+	RegistrationModeOpen     = "open"
+	RegistrationModeInvite   = "invite"
+	RegistrationModeDisabled = "disabled"
+)
+
+// Errors returned by the registration flow
+var (
+	ErrRegistrationDisabled = errors.New("registration is disabled")
+	ErrInvalidInvite        = errors.New("invalid or expired invite code")
+	ErrEmailTaken           = errors.New("an account with this email already exists")
+	ErrInvalidVerification  = errors.New("invalid or expired verification link")
+	ErrEmailNotVerified     = errors.New("email address has not been verified")
+	ErrInvalidRegistration  = errors.New("invalid registration mode")
+)
+
+// RegisterInput holds the fields a new user submits
+type RegisterInput struct {
+	Email      string
+	Name       string
+	Password   string
+	InviteCode string
+	ClientIP   string // limits how fast one client can try invite codes
+}
+
+// RegistrationService handles self-service sign up, invitations and email verification
+type RegistrationService struct {
+	database       *db.DB
+	userRepo       *db.UserRepository
+	roleRepo       *db.RoleRepository
+	tokenRepo      *db.OneTimeTokenRepository
+	settingRepo    *db.SettingRepository
+	invitationRepo *db.InvitationRepository
+	authService    *AuthService
+	mailer         mail.Mailer
+	ipLimiter      *ratelimit.KeyedLimiter
+}
+
+// NewRegistrationService creates a new RegistrationService
+func NewRegistrationService(database *db.DB, userRepo *db.UserRepository, roleRepo *db.RoleRepository, tokenRepo *db.OneTimeTokenRepository, settingRepo *db.SettingRepository, invitationRepo *db.InvitationRepository, authService *AuthService, mailer mail.Mailer) *RegistrationService {
+	return &RegistrationService{
+		database:       database,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		tokenRepo:      tokenRepo,
+		settingRepo:    settingRepo,
+		invitationRepo: invitationRepo,
+		authService:    authService,
+		mailer:         mailer,
+		ipLimiter:      ratelimit.PerWindow(config.AppConfig.Auth.InviteAttemptsPerIP, time.Hour),
+	}
+}
+
+// IsValidRegistrationMode reports whether mode is a known registration mode
+func IsValidRegistrationMode(mode string) bool {
+	switch mode {
+	case RegistrationModeOpen, RegistrationModeInvite, RegistrationModeDisabled:
+		return true
+	}
+	return false
+}
+
+// Mode returns the current registration mode, falling back to the configured default
+func (s *RegistrationService) Mode(ctx context.Context) (string, error) {
+	return s.settingRepo.Get(ctx, models.SettingRegistrationMode, config.AppConfig.Auth.RegistrationMode)
+}
+
+// SetMode switches the registration mode at runtime
+func (s *RegistrationService) SetMode(ctx context.Context, mode string) error {
+	if !IsValidRegistrationMode(mode) {
+		return ErrInvalidRegistration
+	}
+	if err := s.settingRepo.Set(ctx, models.SettingRegistrationMode, mode); err != nil {
+		return fmt.Errorf("failed to update registration mode: %w", err)
+	}
+
+	logging.Log.Info("Registration mode changed", zap.String("mode", mode))
+	return nil
+}
+
+// Register creates a new user. Without an invitation the user gets the default
+// role and must verify their email. An invitation code is required in invite
+// mode and optional in open mode; it gives the user the invitation's role, and
+// redeeming an invitation bound to the user's address counts as verifying it.
+// Every attempt to redeem an invitation is recorded in the audit log.
+func (s *RegistrationService) Register(ctx context.Context, input RegisterInput) (*models.User, error) {
+	user, err := s.register(ctx, input)
+
+	if input.InviteCode != "" {
+		var userID uint
+		if user != nil {
+			userID = user.ID
+		}
+		event := NewAuthEvent(models.AuthEventInviteRedeemed, userID, err)
+		event.Email = normalizeEmail(input.Email)
+		s.authService.RecordEvent(ctx, event)
+	}
+	return user, err
+}
+
+func (s *RegistrationService) register(ctx context.Context, input RegisterInput) (*models.User, error) {
+	if !s.ipLimiter.Allow(input.ClientIP) {
+		logging.Log.Warn("Registration rate limit exceeded", zap.String("ip", input.ClientIP))
+		return nil, ErrRateLimited
+	}
+
+	mode, err := s.Mode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	email := normalizeEmail(input.Email)
+
+	var invitation *models.Invitation
+	switch {
+	case mode == RegistrationModeDisabled:
+		return nil, ErrRegistrationDisabled
+	case input.InviteCode != "":
+		invitation, err = s.lookupInvitation(ctx, input.InviteCode)
+		if err != nil {
+			return nil, err
+		}
+		if invitation.Email != "" && invitation.Email != email {
+			return nil, ErrInvalidInvite
+		}
+	case mode == RegistrationModeInvite:
+		return nil, ErrInvalidInvite
+	case mode != RegistrationModeOpen:
+		return nil, ErrRegistrationDisabled
+	}
+
+	if err := ValidatePassword(input.Password, email); err != nil {
+		return nil, err
+	}
+
+	// Hashed before the lookup so that taken addresses take as long to answer
+	hashedPassword, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	exists, err := s.userRepo.EmailExists(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		// The caller answers as for a new account; only the owner learns of the attempt
+		if err := s.notifyExistingAccount(ctx, email); err != nil {
+			logging.Log.Error("Failed to notify account owner of sign up attempt", zap.Error(err))
+		}
+		return nil, ErrEmailTaken
+	}
+
+	user := &models.User{
+		Email:    email,
+		Name:     strings.TrimSpace(input.Name),
+		Password: hashedPassword,
+	}
+
+	if invitation != nil {
+		user.Roles = []models.Role{invitation.Role}
+		if invitation.Email != "" {
+			now := time.Now().UTC()
+			user.EmailVerifiedAt = &now
+		}
+	} else {
+		// Self-registered users start with the configured default role
+		role, err := s.roleRepo.GetByName(ctx, config.AppConfig.Auth.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, fmt.Errorf("default role %q does not exist", config.AppConfig.Auth.DefaultRole)
+		}
+		user.Roles = []models.Role{*role}
+	}
+
+	// A use of the invitation only counts if the account is created with it
+	err = s.database.RunInTransaction(ctx, func(tx *db.DB) error {
+		if invitation != nil {
+			redeemed, err := db.NewInvitationRepository(tx).Redeem(ctx, invitation.ID)
+			if err != nil {
+				return fmt.Errorf("failed to redeem invitation: %w", err)
+			}
+			if !redeemed {
+				return ErrInvalidInvite
+			}
+		}
+		if err := db.NewUserRepository(tx).Create(ctx, user); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logFields := []zap.Field{zap.Uint("user_id", user.ID), zap.String("mode", mode)}
+	if invitation != nil {
+		logFields = append(logFields, zap.Uint("invitation_id", invitation.ID))
+	}
+	logging.Log.Info("User registered", logFields...)
+
+	if !user.IsEmailVerified() {
+		if err := s.sendVerification(ctx, user); err != nil {
+			// The account exists; the user can request another link
+			logging.Log.Error("Failed to send verification email",
+				zap.Uint("user_id", user.ID), zap.Error(err))
+		}
+	}
+
+	return user, nil
+}
+
+// VerifyEmail consumes a verification token and marks the user's email as verified
+func (s *RegistrationService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeEmailVerification, hashToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up verification token: %w", err)
+	}
+	if record == nil || !record.IsUsable(time.Now()) {
+		return nil, ErrInvalidVerification
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// The link is only valid for the address it was sent to
+	if user == nil || normalizeEmail(user.Email) != normalizeEmail(record.Email) {
+		return nil, ErrInvalidVerification
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume verification token: %w", err)
+	}
+	if !consumed {
+		return nil, ErrInvalidVerification
+	}
+
+	if !user.IsEmailVerified() {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to mark email as verified: %w", err)
+		}
+	}
+
+	logging.Log.Info("Email verified", zap.Uint("user_id", user.ID))
+	return user, nil
+}
+
+// ResendVerification sends a fresh verification link if the account exists and is unverified.
+// It does not reveal whether the account exists.
+func (s *RegistrationService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		return err
+	}
+	if user == nil || user.IsEmailVerified() {
+		return nil
+	}
+
+	// Older links stop working once a new one is issued
+	if err := s.tokenRepo.InvalidateForUser(ctx, models.TokenPurposeEmailVerification, user.ID); err != nil {
+		return err
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// sendVerification stores a new verification token and emails its link
+func (s *RegistrationService) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	ttl := config.AppConfig.Auth.VerificationTokenDuration
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeEmailVerification,
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	link := publicLink(config.AppConfig.API.BaseURL+"/auth/verify-email", url.Values{"token": {token}})
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm your email address by opening this link:\n%s\n\n"+
+			"The link expires in %s. If you did not sign up, you can ignore this email.\n",
+			user.Name, link, ttl),
+	})
+}
+
+// notifyExistingAccount tells the owner of an address that someone tried to
+// sign up with it, and how to get back into the account instead
+func (s *RegistrationService) notifyExistingAccount(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	// Deleted accounts keep their address but have no one to tell
+	if user == nil {
+		return nil
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Sign up attempt with your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone tried to create an account with this email address, but you already have one.\n"+
+			"If it was you, log in here instead, or use \"Forgot password\" if you cannot remember it:\n%s\n\n"+
+			"If it was not you, you can ignore this email; your account has not changed.\n",
+			user.Name, publicLink("/an/login", nil)),
+	})
+}
+
+// publicLink builds an absolute link on the externally reachable URL
+func publicLink(path string, query url.Values) string {
+	link := strings.TrimRight(config.AppConfig.Auth.PublicURL, "/") + path
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+	return link
+}
+
+// normalizeEmail lowercases and trims an email address for comparisons and storage
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
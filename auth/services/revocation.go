@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/revocation"
+)
+
+// tokenCleanupInterval is how often expired refresh tokens, revocations and old audit events are pruned
+const tokenCleanupInterval = time.Hour
+
+// LoadRevocations populates the in-memory revocation list from the database
+func (s *AuthService) LoadRevocations(ctx context.Context) error {
+	snapshot, err := s.storedRevocations(ctx)
+	if err != nil {
+		return err
+	}
+	revocations.Replace(snapshot)
+
+	logging.Log.Info("Revocation list loaded",
+		zap.Int("revoked_tokens", len(snapshot.Tokens)),
+		zap.Int("revoked_users", len(snapshot.UserVersions)),
+		zap.Int("revoked_sessions", len(snapshot.Sessions)))
+	return nil
+}
+
+// StartRevocationReload periodically merges revocations from the database into
+// the in-memory list until the context is cancelled. This picks up revocations
+// made outside this process, such as by homectl.
+func (s *AuthService) StartRevocationReload(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(config.AppConfig.JWT.RevocationPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				snapshot, err := s.storedRevocations(ctx)
+				if err != nil {
+					logging.Log.Error("Failed to reload revocation list", zap.Error(err))
+					continue
+				}
+				revocations.Merge(snapshot)
+			}
+		}
+	}()
+}
+
+// storedRevocations reads the revocations that are still relevant from the database
+func (s *AuthService) storedRevocations(ctx context.Context) (revocation.Snapshot, error) {
+	now := time.Now()
+
+	revoked, err := s.revokedTokenRepo.GetActive(ctx, now)
+	if err != nil {
+		return revocation.Snapshot{}, fmt.Errorf("failed to load revoked tokens: %w", err)
+	}
+
+	versions, err := s.userRepo.GetTokenVersions(ctx)
+	if err != nil {
+		return revocation.Snapshot{}, fmt.Errorf("failed to load token versions: %w", err)
+	}
+
+	// Access tokens of sessions revoked less than one token lifetime ago may still be in use
+	accessTokenDuration := config.AppConfig.JWT.AccessTokenDuration
+	sessions, err := s.sessionRepo.ListRevokedSince(ctx, now.Add(-accessTokenDuration))
+	if err != nil {
+		return revocation.Snapshot{}, fmt.Errorf("failed to load revoked sessions: %w", err)
+	}
+
+	snapshot := revocation.Snapshot{
+		Tokens:       make(map[string]int64, len(revoked)),
+		UserVersions: make(map[string]int, len(versions)),
+		Sessions:     make(map[string]int64, len(sessions)),
+		GeneratedAt:  now.UTC(),
+	}
+	for _, token := range revoked {
+		snapshot.Tokens[token.JTI] = token.ExpiresAt.Unix()
+	}
+	for userID, version := range versions {
+		snapshot.UserVersions[fmt.Sprint(userID)] = version
+	}
+	for _, session := range sessions {
+		snapshot.Sessions[session.FamilyID] = session.RevokedAt.Add(accessTokenDuration).Unix()
+	}
+	return snapshot, nil
+}
+
+// RevocationSnapshot returns the current revocation list for other services
+func (s *AuthService) RevocationSnapshot() revocation.Snapshot {
+	return revocations.Snapshot()
+}
+
+// RevokeAllSessions immediately invalidates every access and refresh token of a user.
+// Used after password changes, resets and when an admin disables an account.
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID uint) error {
+	if err := s.invalidateAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.refreshTokenRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventSessionsRevoked, userID, nil))
+	logging.Log.Info("All sessions revoked for user", zap.Uint("user_id", userID))
+	return nil
+}
+
+// invalidateAccessTokens bumps the user's token version, so every access token
+// issued so far is rejected. Refresh tokens keep working.
+func (s *AuthService) invalidateAccessTokens(ctx context.Context, userID uint) error {
+	version, err := s.userRepo.IncrementTokenVersion(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to bump token version: %w", err)
+	}
+	revocations.SetUserVersion(userID, version)
+
+	logging.Log.Info("Access tokens invalidated", zap.Uint("user_id", userID), zap.Int("token_version", version))
+	return nil
+}
+
+// revokeSession ends a login session: its refresh token family stops working and
+// access tokens already issued for it are rejected until they would have expired
+func (s *AuthService) revokeSession(ctx context.Context, familyID string) error {
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	if err := s.sessionRepo.Revoke(ctx, familyID); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	revocations.RevokeSession(familyID, time.Now().Add(config.AppConfig.JWT.AccessTokenDuration))
+	return nil
+}
+
+// revokeAccessToken adds a single access token to the denylist until it expires
+func (s *AuthService) revokeAccessToken(ctx context.Context, jti string, userID uint, expiresAt time.Time) error {
+	if err := s.revokedTokenRepo.Revoke(ctx, &models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt.UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	revocations.RevokeToken(jti, expiresAt)
+	return nil
+}
+
+// PruneExpiredTokens deletes expired refresh tokens, revocations that no longer matter
+// and audit events past their retention
+func (s *AuthService) PruneExpiredTokens(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	refreshed, err := s.refreshTokenRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	revoked, err := s.revokedTokenRepo.DeleteExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+	// Revoked sessions are kept while their access tokens could still be presented
+	sessions, err := s.sessionRepo.DeleteExpired(ctx, now, now.Add(-config.AppConfig.JWT.AccessTokenDuration))
+	if err != nil {
+		return err
+	}
+	events, err := s.pruneAuthEvents(ctx, now)
+	if err != nil {
+		return err
+	}
+	revocations.Prune(now)
+
+	logging.Log.Debug("Pruned expired tokens",
+		zap.Int64("refresh_tokens", refreshed),
+		zap.Int64("revoked_tokens", revoked),
+		zap.Int64("sessions", sessions),
+		zap.Int64("auth_events", events))
+	return nil
+}
+
+// StartTokenCleanup periodically prunes expired tokens until the context is cancelled
+func (s *AuthService) StartTokenCleanup(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(tokenCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.PruneExpiredTokens(ctx); err != nil {
+					logging.Log.Error("Failed to prune expired tokens", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// serviceAccountIDPrefix tells service account client IDs apart from OIDC clients
+const serviceAccountIDPrefix = "svc-"
+
+// serviceNamePattern matches audiences and scopes, e.g. "file-service" or "files:read"
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:-]{0,63}$`)
+
+// Errors returned by service account management
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrAudiencesRequired      = errors.New("at least one audience is required")
+	ErrInvalidServiceName     = errors.New("audiences and scopes must be lowercase names like \"file-service\" or \"files:read\"")
+)
+
+// ServiceAccountInput holds the fields an admin sets on a service account
+type ServiceAccountInput struct {
+	Name      string
+	Audiences []string // services the account may get tokens for
+	Scopes    []string // scopes it may request
+}
+
+// UpdateServiceAccountInput holds the fields an admin may change; nil fields are left as they are
+type UpdateServiceAccountInput struct {
+	Name      *string
+	Audiences *[]string
+	Scopes    *[]string
+	Disabled  *bool
+}
+
+// ServiceAccountService manages service accounts and issues their tokens
+type ServiceAccountService struct {
+	accountRepo *db.ServiceAccountRepository
+}
+
+// NewServiceAccountService creates a new ServiceAccountService
+func NewServiceAccountService(accountRepo *db.ServiceAccountRepository) *ServiceAccountService {
+	return &ServiceAccountService{
+		accountRepo: accountRepo,
+	}
+}
+
+// ListAccounts returns every service account
+func (s *ServiceAccountService) ListAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	return s.accountRepo.List(ctx)
+}
+
+// GetAccount returns a service account by its database ID
+func (s *ServiceAccountService) GetAccount(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	account, err := s.accountRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+// CreateAccount registers a service account. The secret is returned once and
+// only its hash is stored.
+func (s *ServiceAccountService) CreateAccount(ctx context.Context, input ServiceAccountInput, adminID uint) (*models.ServiceAccount, string, error) {
+	audiences, err := validateServiceNames(input.Audiences)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(audiences) == 0 {
+		return nil, "", ErrAudiencesRequired
+	}
+	scopes, err := validateServiceNames(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := &models.ServiceAccount{
+		ClientID:   serviceAccountIDPrefix + id,
+		SecretHash: hashToken(secret),
+		Name:       strings.TrimSpace(input.Name),
+		Audiences:  strings.Join(audiences, " "),
+		Scopes:     strings.Join(scopes, " "),
+		CreatedBy:  adminID,
+	}
+	if err := s.accountRepo.Create(ctx, account); err != nil {
+		return nil, "", fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	logging.Log.Info("Service account created",
+		zap.String("client_id", account.ClientID),
+		zap.String("name", account.Name),
+		zap.Strings("audiences", audiences),
+		zap.Uint("admin_id", adminID))
+	return account, secret, nil
+}
+
+// UpdateAccount changes a service account's name, audiences or scopes, or
+// disables it. Tokens already issued stay valid until they expire.
+func (s *ServiceAccountService) UpdateAccount(ctx context.Context, id uint, input UpdateServiceAccountInput, adminID uint) (*models.ServiceAccount, error) {
+	account, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		account.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Audiences != nil {
+		audiences, err := validateServiceNames(*input.Audiences)
+		if err != nil {
+			return nil, err
+		}
+		if len(audiences) == 0 {
+			return nil, ErrAudiencesRequired
+		}
+		account.Audiences = strings.Join(audiences, " ")
+	}
+	if input.Scopes != nil {
+		scopes, err := validateServiceNames(*input.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		account.Scopes = strings.Join(scopes, " ")
+	}
+	if input.Disabled != nil {
+		account.Disabled = *input.Disabled
+	}
+
+	if err := s.accountRepo.Update(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to update service account: %w", err)
+	}
+
+	logging.Log.Info("Service account updated",
+		zap.String("client_id", account.ClientID),
+		zap.Bool("disabled", account.Disabled),
+		zap.Uint("admin_id", adminID))
+	return account, nil
+}
+
+// RotateSecret replaces a service account's secret and returns the new one
+func (s *ServiceAccountService) RotateSecret(ctx context.Context, id uint, adminID uint) (*models.ServiceAccount, string, error) {
+	account, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	account.SecretHash = hashToken(secret)
+
+	if err := s.accountRepo.Update(ctx, account); err != nil {
+		return nil, "", fmt.Errorf("failed to rotate service account secret: %w", err)
+	}
+
+	logging.Log.Warn("Service account secret rotated", zap.String("client_id", account.ClientID), zap.Uint("admin_id", adminID))
+	return account, secret, nil
+}
+
+// DeleteAccount removes a service account
+func (s *ServiceAccountService) DeleteAccount(ctx context.Context, id uint, adminID uint) error {
+	account, err := s.GetAccount(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.accountRepo.Delete(ctx, account.ID); err != nil {
+		return fmt.Errorf("failed to delete service account: %w", err)
+	}
+
+	logging.Log.Warn("Service account deleted", zap.String("client_id", account.ClientID), zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// IssueToken handles a client_credentials token request. The token is for the
+// requested audience and scopes, or for every one the account is allowed when
+// none are requested. Service tokens cannot be refreshed; clients ask for a new one.
+func (s *ServiceAccountService) IssueToken(ctx context.Context, req TokenRequest) (*OIDCTokenResponse, error) {
+	account, err := s.authenticate(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	audiences := account.AudienceList()
+	if req.Audience != "" {
+		if !containsScope(audiences, req.Audience) {
+			return nil, ErrOAuthInvalidTarget
+		}
+		audiences = []string{req.Audience}
+	}
+
+	scopes := account.ScopeList()
+	if requested := strings.Fields(req.Scope); len(requested) > 0 {
+		for _, scope := range requested {
+			if !containsScope(scopes, scope) {
+				return nil, ErrOAuthInvalidScope
+			}
+		}
+		scopes = requested
+	}
+	scope := strings.Join(scopes, " ")
+
+	jti, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	duration := config.AppConfig.JWT.ServiceTokenDuration
+	accessToken, err := signJWT(models.JWTClaims{
+		Type:     models.TokenTypeService,
+		ClientID: account.ClientID,
+		Scope:    scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Issuer:    config.AppConfig.JWT.Issuer,
+			Subject:   account.ClientID,
+			Audience:  jwt.ClaimStrings(audiences),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign service token: %w", err)
+	}
+
+	logging.Log.Debug("Service token issued",
+		zap.String("client_id", account.ClientID),
+		zap.Strings("audiences", audiences),
+		zap.String("scope", scope))
+	return &OIDCTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(duration.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// authenticate checks a service account's credentials
+func (s *ServiceAccountService) authenticate(ctx context.Context, clientID, secret string) (*models.ServiceAccount, error) {
+	if clientID == "" || secret == "" {
+		return nil, ErrOAuthInvalidClient
+	}
+
+	account, err := s.accountRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.Disabled ||
+		subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(account.SecretHash)) != 1 {
+		logging.Log.Warn("Service account authentication failed", zap.String("client_id", clientID))
+		return nil, ErrOAuthInvalidClient
+	}
+	return account, nil
+}
+
+// activeAccount returns the service account with the client ID, or nil if it
+// was deleted or is disabled
+func (s *ServiceAccountService) activeAccount(ctx context.Context, clientID string) (*models.ServiceAccount, error) {
+	account, err := s.accountRepo.GetByClientID(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.Disabled {
+		return nil, nil
+	}
+	return account, nil
+}
+
+// validateServiceNames checks and de-duplicates audiences or scopes
+func validateServiceNames(names []string) ([]string, error) {
+	valid := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !serviceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidServiceName, name)
+		}
+		if !containsScope(valid, name) {
+			valid = append(valid, name)
+		}
+	}
+	return valid, nil
+}
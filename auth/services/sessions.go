@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions returns a user's active login sessions, most recently used first
+func (s *AuthService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	return s.sessionRepo.ListActiveForUser(ctx, userID, time.Now())
+}
+
+// recordSession creates or refreshes the session of a login on the requesting device
+func (s *AuthService) recordSession(ctx context.Context, userID uint, familyID string, now, expiresAt time.Time) error {
+	client := ClientInfoFrom(ctx)
+	if err := s.sessionRepo.Record(ctx, &models.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		UserAgent:  client.UserAgent,
+		IPAddress:  client.IPAddress,
+		LastSeenAt: now.UTC(),
+		ExpiresAt:  expiresAt.UTC(),
+	}); err != nil {
+		return fmt.Errorf("failed to record session: %w", err)
+	}
+	return nil
+}
+
+// sessionActive reports whether a session exists and was neither revoked nor has expired
+func (s *AuthService) sessionActive(ctx context.Context, familyID string) (bool, error) {
+	session, err := s.sessionRepo.GetByFamilyID(ctx, familyID)
+	if err != nil {
+		return false, err
+	}
+	return session != nil && session.IsActive(time.Now()), nil
+}
+
+// RevokeUserSession signs one of a user's sessions out
+func (s *AuthService) RevokeUserSession(ctx context.Context, userID, sessionID uint) error {
+	session, err := s.sessionRepo.GetForUser(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || !session.IsActive(time.Now()) {
+		return ErrSessionNotFound
+	}
+
+	if err := s.revokeSession(ctx, session.FamilyID); err != nil {
+		return err
+	}
+
+	s.RecordEvent(ctx, NewAuthEvent(models.AuthEventSessionRevoked, userID, nil))
+	logging.Log.Info("Session revoked",
+		zap.Uint("user_id", userID),
+		zap.Uint("session_id", session.ID))
+	return nil
+}
+
+// RevokeOtherSessions signs out every session of a user except the one with the
+// given family ID, and returns how many were revoked
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID uint, currentFamilyID string) (int, error) {
+	sessions, err := s.sessionRepo.ListActiveForUser(ctx, userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.FamilyID == currentFamilyID {
+			continue
+		}
+		if err := s.revokeSession(ctx, session.FamilyID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	if revoked > 0 {
+		event := NewAuthEvent(models.AuthEventSessionsRevoked, userID, nil)
+		event.Reason = "other_sessions"
+		s.RecordEvent(ctx, event)
+	}
+
+	logging.Log.Info("Other sessions revoked",
+		zap.Uint("user_id", userID),
+		zap.Int("count", revoked))
+	return revoked, nil
+}
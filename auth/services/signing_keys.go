@@ -0,0 +1,381 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/jwks"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// signingKey is a private key this service signs tokens with
+type signingKey struct {
+	id        string
+	algorithm string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+}
+
+// keyRing holds the key that signs new tokens and the public keys of every key
+// in the key file. Keys left over from a previous algorithm only verify tokens,
+// so changing the algorithm does not sign anyone out.
+type keyRing struct {
+	current  *signingKey
+	set      jwks.Set
+	verifier *jwks.Verifier
+}
+
+// ErrNoKeyFile is returned when managing keys without a configured jwt.key_file
+var ErrNoKeyFile = errors.New("no JWT key file configured")
+
+// keys is configured by InitializeJWTKeys
+var keys *keyRing
+
+// InitializeJWTKeys loads the signing keys from the configured key file, adding
+// a key for the configured algorithm when the file has none. Without a key file
+// the keys only live as long as the process.
+func InitializeJWTKeys() error {
+	cfg := config.AppConfig.JWT
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = jwks.RS256
+	}
+
+	var private []crypto.Signer
+	if cfg.KeyFile != "" {
+		loaded, err := readKeyFile(cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		private = loaded
+	}
+
+	ring, generated, err := newKeyRing(algorithm, cfg.KeySize, private)
+	if err != nil {
+		return err
+	}
+	if generated != nil {
+		private = append([]crypto.Signer{generated}, private...)
+		if cfg.KeyFile == "" {
+			logging.Log.Warn("No JWT key file configured, tokens will not survive a restart")
+		} else if err := writeKeyFile(cfg.KeyFile, private); err != nil {
+			logging.Log.Warn("Failed to save JWT signing key, tokens will not survive a restart",
+				zap.String("key_file", cfg.KeyFile),
+				zap.Error(err))
+		}
+	}
+	keys = ring
+
+	logging.Log.Info("JWT keys initialized successfully",
+		zap.String("algorithm", algorithm),
+		zap.String("key_id", ring.current.id),
+		zap.Int("keys", len(ring.set.Keys)))
+	return nil
+}
+
+// SigningKeyInfo describes a key in the JWT key file
+type SigningKeyInfo struct {
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Current   bool   `json:"current"` // signs new tokens
+}
+
+// ListSigningKeys returns the keys in the configured key file, newest first
+func ListSigningKeys() ([]SigningKeyInfo, error) {
+	cfg := config.AppConfig.JWT
+	if cfg.KeyFile == "" {
+		return nil, ErrNoKeyFile
+	}
+	private, err := readKeyFile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = jwks.RS256
+	}
+	infos := make([]SigningKeyInfo, 0, len(private))
+	foundCurrent := false
+	for _, key := range private {
+		public, err := jwks.NewKey(key.Public())
+		if err != nil {
+			return nil, err
+		}
+		current := !foundCurrent && public.Algorithm == algorithm
+		foundCurrent = foundCurrent || current
+		infos = append(infos, SigningKeyInfo{KeyID: public.KeyID, Algorithm: public.Algorithm, Current: current})
+	}
+	return infos, nil
+}
+
+// RotateSigningKeys adds a new key for the configured algorithm to the front of
+// the key file, so that it signs new tokens once the auth service restarts. Older
+// keys keep verifying the tokens they signed; with keep > 0 only the newest keep
+// keys are kept, which signs out anyone whose tokens used a dropped key.
+func RotateSigningKeys(keep int) (string, int, error) {
+	cfg := config.AppConfig.JWT
+	if cfg.KeyFile == "" {
+		return "", 0, ErrNoKeyFile
+	}
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = jwks.RS256
+	}
+
+	private, err := readKeyFile(cfg.KeyFile)
+	if err != nil {
+		return "", 0, err
+	}
+	generated, err := generateSigningKey(algorithm, cfg.KeySize)
+	if err != nil {
+		return "", 0, err
+	}
+	public, err := jwks.NewKey(generated.Public())
+	if err != nil {
+		return "", 0, err
+	}
+
+	private = append([]crypto.Signer{generated}, private...)
+	retired := 0
+	if keep > 0 && len(private) > keep {
+		retired = len(private) - keep
+		private = private[:keep]
+	}
+	if err := writeKeyFile(cfg.KeyFile, private); err != nil {
+		return "", 0, fmt.Errorf("failed to save JWT signing keys: %w", err)
+	}
+
+	logging.Log.Warn("JWT signing key rotated",
+		zap.String("key_id", public.KeyID),
+		zap.String("algorithm", algorithm),
+		zap.Int("retired", retired))
+	return public.KeyID, retired, nil
+}
+
+// newKeyRing builds a key ring from existing private keys. The first key of the
+// configured algorithm signs new tokens; if there is none a new key is generated
+// and returned so that the caller can store it.
+func newKeyRing(algorithm string, rsaKeySize int, private []crypto.Signer) (*keyRing, crypto.Signer, error) {
+	method, err := jwks.SigningMethod(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ed25519 keys are byte slices and cannot be compared, so the current key is tracked by index
+	current := -1
+	for i, key := range private {
+		if keyAlgorithm, _ := jwks.Algorithm(key.Public()); keyAlgorithm == algorithm {
+			current = i
+			break
+		}
+	}
+	var generated crypto.Signer
+	if current < 0 {
+		generated, err = generateSigningKey(algorithm, rsaKeySize)
+		if err != nil {
+			return nil, nil, err
+		}
+		current = 0
+		private = append([]crypto.Signer{generated}, private...)
+	}
+
+	ring := &keyRing{}
+	for i, key := range private {
+		public, err := jwks.NewKey(key.Public())
+		if err != nil {
+			return nil, nil, err
+		}
+		ring.set.Keys = append(ring.set.Keys, public)
+		if i == current {
+			ring.current = &signingKey{id: public.KeyID, algorithm: algorithm, method: method, private: key}
+		}
+	}
+	ring.verifier, err = jwks.NewVerifier(ring.set)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ring, generated, nil
+}
+
+// generateSigningKey creates a new private key for an algorithm
+func generateSigningKey(algorithm string, rsaKeySize int) (crypto.Signer, error) {
+	var (
+		key crypto.Signer
+		err error
+	)
+	switch algorithm {
+	case jwks.RS256:
+		if rsaKeySize == 0 {
+			rsaKeySize = 2048
+		}
+		key, err = rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case jwks.ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwks.EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", algorithm, err)
+	}
+	return key, nil
+}
+
+// readKeyFile reads every private key from a PEM file. A missing file holds no keys.
+func readKeyFile(path string) ([]crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key file: %w", err)
+	}
+
+	var private []crypto.Signer
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key in %s: %w", path, err)
+		}
+		private = append(private, key)
+	}
+	return private, nil
+}
+
+// parsePrivateKey decodes a PKCS #8, PKCS #1 or SEC 1 private key
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if _, err := jwks.Algorithm(signer.Public()); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// writeKeyFile stores private keys as PKCS #8 PEM blocks, readable only by the service
+func writeKeyFile(path string, private []crypto.Signer) error {
+	var data []byte
+	for _, key := range private {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("failed to marshal private key: %w", err)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// signJWT signs claims with the current key, naming the key in the header so
+// that verifiers can pick it from the JWKS
+func signJWT(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing key not initialized")
+	}
+	token := jwt.NewWithClaims(keys.current.method, claims)
+	token.Header["kid"] = keys.current.id
+	return token.SignedString(keys.current.private)
+}
+
+// verificationKey is the jwt.Keyfunc for tokens signed by this service
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, errors.New("signing key not initialized")
+	}
+	return keys.verifier.Keyfunc(token)
+}
+
+// signingAlgorithm returns the algorithm new tokens are signed with
+func signingAlgorithm() string {
+	if keys == nil {
+		return jwks.RS256
+	}
+	return keys.current.algorithm
+}
+
+// JWKS returns the public keys that verify tokens issued by this service
+func (s *AuthService) JWKS() (jwks.Set, error) {
+	if keys == nil {
+		return jwks.Set{}, errors.New("signing key not initialized")
+	}
+	return keys.set, nil
+}
+
+// GetPublicKey returns the current signing key in PEM format. Verifiers should
+// prefer the JWKS, which also lists keys that are no longer used for signing.
+func (s *AuthService) GetPublicKey() (*models.PublicKeyResponse, error) {
+	if keys == nil {
+		return nil, errors.New("public key not initialized")
+	}
+
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(keys.current.private.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	pubKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: pubKeyBytes,
+	})
+
+	var keyType string
+	for _, key := range keys.set.Keys {
+		if key.KeyID == keys.current.id {
+			keyType = key.KeyType
+		}
+	}
+	return &models.PublicKeyResponse{
+		PublicKey: string(pubKeyPEM),
+		Algorithm: keys.current.algorithm,
+		KeyType:   keyType,
+		KeyID:     keys.current.id,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"crypto"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shashank/home-server/common/jwks"
+)
+
+func TestKeyRingKeepsRetiredKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "jwt_keys.pem")
+
+	// Start with RS256 and persist the generated key
+	rsaRing, generated, err := newKeyRing(jwks.RS256, 2048, nil)
+	if err != nil {
+		t.Fatalf("newKeyRing(RS256) error: %v", err)
+	}
+	if generated == nil {
+		t.Fatal("expected a key to be generated for an empty key file")
+	}
+	if err := writeKeyFile(path, []crypto.Signer{generated}); err != nil {
+		t.Fatalf("writeKeyFile() error: %v", err)
+	}
+
+	keys = rsaRing
+	legacyToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{Subject: "1"})
+	legacy, err := legacyToken.SignedString(rsaRing.current.private)
+	if err != nil {
+		t.Fatalf("failed to sign legacy token: %v", err)
+	}
+	withKeyID, err := signJWT(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("signJWT() error: %v", err)
+	}
+
+	// Switch to EdDSA: the RSA key must be kept for verification
+	private, err := readKeyFile(path)
+	if err != nil {
+		t.Fatalf("readKeyFile() error: %v", err)
+	}
+	edRing, generated, err := newKeyRing(jwks.EdDSA, 2048, private)
+	if err != nil {
+		t.Fatalf("newKeyRing(EdDSA) error: %v", err)
+	}
+	if generated == nil || edRing.current.algorithm != jwks.EdDSA {
+		t.Fatalf("expected a new EdDSA signing key, got %+v", edRing.current)
+	}
+	if len(edRing.set.Keys) != 2 {
+		t.Fatalf("key set has %d keys, want 2", len(edRing.set.Keys))
+	}
+
+	keys = edRing
+	t.Cleanup(func() { keys = nil })
+
+	for name, token := range map[string]string{"legacy": legacy, "rsa": withKeyID} {
+		if _, err := jwt.Parse(token, verificationKey); err != nil {
+			t.Errorf("%s token rejected after switching algorithm: %v", name, err)
+		}
+	}
+
+	signed, err := signJWT(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatalf("signJWT() error: %v", err)
+	}
+	parsed, err := jwt.Parse(signed, verificationKey)
+	if err != nil {
+		t.Fatalf("EdDSA token rejected: %v", err)
+	}
+	if parsed.Header["alg"] != jwks.EdDSA || parsed.Header["kid"] != edRing.current.id {
+		t.Errorf("token header = %v", parsed.Header)
+	}
+
+	// Once a key for the algorithm exists it is reused
+	_, generated, err = newKeyRing(jwks.RS256, 2048, private)
+	if err != nil {
+		t.Fatalf("newKeyRing(RS256) error: %v", err)
+	}
+	if generated != nil {
+		t.Error("expected the stored RSA key to be reused")
+	}
+}
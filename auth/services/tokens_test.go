@@ -0,0 +1,33 @@
+package services
+
+import "testing"
+
+func TestGenerateOpaqueTokenIsUnique(t *testing.T) {
+	first, err := generateOpaqueToken()
+	if err != nil {
+		t.Fatalf("generateOpaqueToken failed: %v", err)
+	}
+	second, err := generateOpaqueToken()
+	if err != nil {
+		t.Fatalf("generateOpaqueToken failed: %v", err)
+	}
+
+	if first == second {
+		t.Error("Expected two generated tokens to differ")
+	}
+	if len(first) != 43 {
+		t.Errorf("Expected 43 character token, got %d", len(first))
+	}
+}
+
+func TestHashTokenIsStable(t *testing.T) {
+	if hashToken("abc") != hashToken("abc") {
+		t.Error("Expected hashToken to be deterministic")
+	}
+	if hashToken("abc") == hashToken("abd") {
+		t.Error("Expected different tokens to hash differently")
+	}
+	if len(hashToken("abc")) != 64 {
+		t.Errorf("Expected 64 character hex hash, got %d", len(hashToken("abc")))
+	}
+}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+	"github.com/shashank/home-server/common/ratelimit"
+)
+
+const (
+	// totpPeriod is the TOTP time step in seconds
+	totpPeriod = 30
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many codes may be tried per login challenge
+	maxChallengeAttempts = 5
+)
+
+// Errors returned by the two-factor flows
+var (
+	ErrTwoFactorUnavailable    = errors.New("two-factor authentication is not available")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication enrollment has not been started")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+	ErrTooManyAttempts         = errors.New("too many invalid codes, please log in again")
+)
+
+// TOTPEnrollment is returned when a user starts enrolling an authenticator app
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"` // PNG data URI of the provisioning URI
+}
+
+// TwoFactorService manages TOTP enrollment and the second login step
+type TwoFactorService struct {
+	twoFactorRepo   *db.TwoFactorRepository
+	userRepo        *db.UserRepository
+	tokenRepo       *db.OneTimeTokenRepository
+	authService     *AuthService
+	box             *secretBox
+	attemptsLimiter *ratelimit.KeyedLimiter
+}
+
+// NewTwoFactorService creates a new TwoFactorService. Enrollment is unavailable
+// unless AUTH_ENCRYPTION_KEY holds a valid key.
+func NewTwoFactorService(twoFactorRepo *db.TwoFactorRepository, userRepo *db.UserRepository, tokenRepo *db.OneTimeTokenRepository, authService *AuthService) (*TwoFactorService, error) {
+	box, err := newSecretBox(config.AppConfig.Auth.EncryptionKey)
+	if err != nil && !errors.Is(err, ErrEncryptionUnavailable) {
+		return nil, err
+	}
+	if box == nil {
+		logging.Log.Warn("AUTH_ENCRYPTION_KEY is not set, two-factor authentication is unavailable")
+	}
+
+	return &TwoFactorService{
+		twoFactorRepo:   twoFactorRepo,
+		userRepo:        userRepo,
+		tokenRepo:       tokenRepo,
+		authService:     authService,
+		box:             box,
+		attemptsLimiter: ratelimit.PerWindow(maxChallengeAttempts, config.AppConfig.Auth.MFAChallengeDuration),
+	}, nil
+}
+
+// IsEnabled reports whether the user must pass a second factor at login
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID uint) (bool, error) {
+	return s.twoFactorRepo.IsEnabled(ctx, userID)
+}
+
+// Status returns whether 2FA is enabled and how many recovery codes remain
+func (s *TwoFactorService) Status(ctx context.Context, userID uint) (bool, int64, error) {
+	enabled, err := s.twoFactorRepo.IsEnabled(ctx, userID)
+	if err != nil || !enabled {
+		return false, 0, err
+	}
+	remaining, err := s.twoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, remaining, nil
+}
+
+// BeginEnrollment creates a new unconfirmed TOTP secret for the user
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, userID uint) (*TOTPEnrollment, error) {
+	if s.box == nil {
+		return nil, ErrTwoFactorUnavailable
+	}
+
+	existing, err := s.twoFactorRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.IsConfirmed() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserInactive
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      config.AppConfig.Auth.TOTPIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	encrypted, err := s.box.Seal([]byte(key.Secret()), totpContext(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Restarting enrollment replaces any unconfirmed secret
+	if err := s.twoFactorRepo.DeleteForUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.twoFactorRepo.Create(ctx, &models.TOTPCredential{
+		UserID:          userID,
+		SecretEncrypted: encrypted,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	qrCode, err := qrCodeDataURI(key)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("TOTP enrollment started", zap.Uint("user_id", userID))
+	return &TOTPEnrollment{
+		Secret:          key.Secret(),
+		ProvisioningURI: key.URL(),
+		QRCode:          qrCode,
+	}, nil
+}
+
+// ConfirmEnrollment activates 2FA once the user proves their app produces valid
+// codes, and returns a fresh set of recovery codes to show once
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	credential, err := s.twoFactorRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if credential.IsConfirmed() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, credential, code); err != nil {
+		return nil, err
+	}
+
+	// The confirmation code must stay burned, so the credential is not saved whole
+	if err := s.twoFactorRepo.Confirm(ctx, credential.ID, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("failed to confirm TOTP enrollment: %w", err)
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("TOTP enrollment confirmed", zap.Uint("user_id", userID))
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current TOTP code
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	credential, err := s.confirmedCredential(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifyTOTP(ctx, credential, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("Recovery codes regenerated", zap.Uint("user_id", userID))
+	return codes, nil
+}
+
+// Disable turns off 2FA for the user after re-checking their password. Every
+// attempt is recorded in the audit log.
+func (s *TwoFactorService) Disable(ctx context.Context, userID uint, password string) error {
+	err := s.disable(ctx, userID, password)
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventTwoFactorDisabled, userID, err))
+	return err
+}
+
+// disable does the work of Disable
+func (s *TwoFactorService) disable(ctx context.Context, userID uint, password string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserInactive
+	}
+	if err := s.authService.verifyCurrentPassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	if err := s.twoFactorRepo.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+
+	logging.Log.Info("Two-factor authentication disabled", zap.Uint("user_id", userID))
+	return nil
+}
+
+// AdminReset removes a user's 2FA so they can log in with their password and enroll again
+func (s *TwoFactorService) AdminReset(ctx context.Context, userID, adminID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.twoFactorRepo.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to reset two-factor authentication: %w", err)
+	}
+
+	event := NewAuthEvent(models.AuthEventTwoFactorReset, userID, nil)
+	event.ActorID = &adminID
+	s.authService.RecordEvent(ctx, event)
+
+	logging.Log.Warn("Two-factor authentication reset by admin",
+		zap.Uint("user_id", userID),
+		zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// CreateChallenge issues a short-lived token that stands in for a password-verified
+// login until the second factor is provided
+func (s *TwoFactorService) CreateChallenge(ctx context.Context, user *models.User) (string, int64, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := config.AppConfig.Auth.MFAChallengeDuration
+	if err := s.tokenRepo.Create(ctx, &models.OneTimeToken{
+		Purpose:   models.TokenPurposeMFAChallenge,
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl).UTC(),
+	}); err != nil {
+		return "", 0, fmt.Errorf("failed to store login challenge: %w", err)
+	}
+
+	return token, int64(ttl.Seconds()), nil
+}
+
+// CompleteChallenge exchanges a login challenge and a TOTP or recovery code for a token pair
+func (s *TwoFactorService) CompleteChallenge(ctx context.Context, challengeToken, code string) (*models.User, string, string, int64, error) {
+	user, err := s.VerifyChallenge(ctx, challengeToken, code)
+	if err != nil {
+		return nil, "", "", 0, err
+	}
+
+	accessToken, refreshToken, expiresIn, err := s.authService.GenerateTokenPair(ctx, user)
+	if err != nil {
+		return nil, "", "", 0, err
+	}
+	return user, accessToken, refreshToken, expiresIn, nil
+}
+
+// VerifyChallenge consumes a login challenge once a valid TOTP or recovery code
+// is given and returns the user it was issued for. Every attempt is recorded in
+// the audit log.
+func (s *TwoFactorService) VerifyChallenge(ctx context.Context, challengeToken, code string) (*models.User, error) {
+	user, userID, err := s.verifyChallenge(ctx, challengeToken, code)
+	s.authService.RecordEvent(ctx, NewAuthEvent(models.AuthEventLogin2FA, userID, err))
+	return user, err
+}
+
+// verifyChallenge does the work of VerifyChallenge. The ID of the user the
+// challenge was issued for is returned even when verification fails.
+func (s *TwoFactorService) verifyChallenge(ctx context.Context, challengeToken, code string) (*models.User, uint, error) {
+	challengeHash := hashToken(challengeToken)
+
+	record, err := s.tokenRepo.GetByHash(ctx, models.TokenPurposeMFAChallenge, challengeHash)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up login challenge: %w", err)
+	}
+	if record == nil || !record.IsUsable(time.Now()) {
+		return nil, 0, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, record.UserID, err
+	}
+	if user == nil || user.Disabled {
+		return nil, record.UserID, ErrUserInactive
+	}
+
+	// Burn the challenge once too many codes have been tried against it
+	if !s.attemptsLimiter.Allow(challengeHash) {
+		// The limiter keeps rejecting the challenge even if burning it failed
+		if _, err := s.tokenRepo.Consume(ctx, record.ID); err != nil {
+			logging.Log.Error("Failed to burn login challenge", zap.Uint("user_id", record.UserID), zap.Error(err))
+		}
+		logging.Log.Warn("Too many 2FA attempts for login challenge", zap.Uint("user_id", record.UserID))
+		return nil, record.UserID, ErrTooManyAttempts
+	}
+
+	credential, err := s.confirmedCredential(ctx, record.UserID)
+	if err != nil {
+		return nil, record.UserID, err
+	}
+
+	// Codes count towards the account's lockout like passwords, so fetching new
+	// challenges does not buy more guesses. Login left the counter up for this.
+	claimed, err := s.authService.claimLoginAttempt(ctx, user)
+	if err != nil {
+		return nil, record.UserID, err
+	}
+
+	if err := s.verifyCode(ctx, credential, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			logLockout(user, claimed)
+		}
+		return nil, record.UserID, err
+	}
+
+	consumed, err := s.tokenRepo.Consume(ctx, record.ID)
+	if err != nil {
+		return nil, record.UserID, fmt.Errorf("failed to consume login challenge: %w", err)
+	}
+	if !consumed {
+		return nil, record.UserID, ErrInvalidChallenge
+	}
+	s.attemptsLimiter.Reset(challengeHash)
+
+	if err := s.userRepo.ClearFailedLogins(ctx, user.ID); err != nil {
+		return nil, user.ID, err
+	}
+
+	return user, user.ID, nil
+}
+
+// verifyCode checks a TOTP code or spends a recovery code
+func (s *TwoFactorService) verifyCode(ctx context.Context, credential *models.TOTPCredential, code string) error {
+	if !isRecoveryCode(code) {
+		return s.verifyTOTP(ctx, credential, code)
+	}
+
+	used, err := s.twoFactorRepo.UseRecoveryCode(ctx, credential.UserID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	logging.Log.Info("Recovery code used for login", zap.Uint("user_id", credential.UserID))
+	return nil
+}
+
+// confirmedCredential returns the user's active TOTP credential
+func (s *TwoFactorService) confirmedCredential(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	credential, err := s.twoFactorRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil || !credential.IsConfirmed() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	return credential, nil
+}
+
+// verifyTOTP checks a code against the current and adjacent time steps and
+// refuses to accept a step that was already used
+func (s *TwoFactorService) verifyTOTP(ctx context.Context, credential *models.TOTPCredential, code string) error {
+	if s.box == nil {
+		return ErrTwoFactorUnavailable
+	}
+
+	secret, err := s.box.Open(credential.SecretEncrypted, totpContext(credential.UserID))
+	if err != nil {
+		return err
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	now := time.Now()
+
+	for _, skew := range []int{0, -1, 1} {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(string(secret), at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to generate TOTP code: %w", err)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			advanced, err := s.twoFactorRepo.AdvanceStep(ctx, credential.ID, at.Unix()/totpPeriod)
+			if err != nil {
+				return err
+			}
+			if !advanced {
+				return ErrInvalidTwoFactorCode
+			}
+			return nil
+		}
+	}
+
+	return ErrInvalidTwoFactorCode
+}
+
+// replaceRecoveryCodes generates new recovery codes and stores their hashes
+func (s *TwoFactorService) replaceRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code formatted as "xxxxx-xxxxx"
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:10]
+	return encoded[:5] + "-" + encoded[5:], nil
+}
+
+// isRecoveryCode distinguishes recovery codes from six digit TOTP codes
+func isRecoveryCode(code string) bool {
+	return len(normalizeRecoveryCode(code)) == 10
+}
+
+// normalizeRecoveryCode strips formatting so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// totpContext binds an encrypted TOTP secret to its owner
+func totpContext(userID uint) string {
+	return fmt.Sprintf("totp:%d", userID)
+}
+
+// qrCodeDataURI renders the provisioning URI as a PNG data URI
+func qrCodeDataURI(key *otp.Key) (string, error) {
+	img, err := key.Image(240, 240)
+	if err != nil {
+		return "", fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/db"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// Errors returned by admin user management
+var (
+	ErrLastAdmin        = errors.New("cannot remove the last active admin")
+	ErrCannotModifySelf = errors.New("admins cannot disable or delete their own account")
+	ErrUserNotDeleted   = errors.New("user is not deleted")
+	ErrUnknownRole      = errors.New("unknown role")
+)
+
+// CreateUserInput holds the fields an admin sets when creating a user
+type CreateUserInput struct {
+	Email    string
+	Name     string
+	Password string
+	Roles    []string // role names; the configured default role when empty
+}
+
+// UpdateUserInput holds the fields an admin may change; nil fields are left as they are
+type UpdateUserInput struct {
+	Email     *string
+	Name      *string
+	Roles     *[]string // replaces all of the user's roles
+	Disabled  *bool
+	MagicLink *bool // sign in with emailed links, in addition to the user's roles
+}
+
+// UserAdminService implements the admin user management endpoints
+type UserAdminService struct {
+	database    *db.DB
+	userRepo    *db.UserRepository
+	roleRepo    *db.RoleRepository
+	authService *AuthService
+}
+
+// NewUserAdminService creates a new UserAdminService
+func NewUserAdminService(database *db.DB, userRepo *db.UserRepository, roleRepo *db.RoleRepository, authService *AuthService) *UserAdminService {
+	return &UserAdminService{
+		database:    database,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		authService: authService,
+	}
+}
+
+// ListUsers returns a page of users, optionally filtered by a name or email search term
+func (s *UserAdminService) ListUsers(ctx context.Context, search string, page, pageSize int) ([]models.User, int64, error) {
+	var users []models.User
+	var total int64
+	var err error
+
+	search = strings.TrimSpace(search)
+	if search != "" {
+		users, total, err = s.userRepo.SearchUsers(ctx, search, page, pageSize)
+	} else {
+		users, total, err = s.userRepo.Paginate(ctx, page, pageSize, nil)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range users {
+		if err := s.loadRoles(ctx, &users[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return users, total, nil
+}
+
+// GetUser returns a user by ID, including soft deleted users
+func (s *UserAdminService) GetUser(ctx context.Context, userID uint) (*models.User, error) {
+	user, err := s.userRepo.GetByIDUnscoped(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByEmail returns a user by email, including soft deleted users
+func (s *UserAdminService) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.userRepo.GetByEmailUnscoped(ctx, normalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ListRoles returns every role with its permissions
+func (s *UserAdminService) ListRoles(ctx context.Context) ([]models.Role, error) {
+	return s.roleRepo.ListWithPermissions(ctx)
+}
+
+// CreateUser creates a verified account with the given password
+func (s *UserAdminService) CreateUser(ctx context.Context, input CreateUserInput, adminID uint) (*models.User, error) {
+	email := normalizeEmail(input.Email)
+
+	exists, err := s.userRepo.EmailInUse(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrEmailTaken
+	}
+
+	if err := ValidatePassword(input.Password, email); err != nil {
+		return nil, err
+	}
+
+	roleNames := input.Roles
+	if len(roleNames) == 0 {
+		roleNames = []string{config.AppConfig.Auth.DefaultRole}
+	}
+	roles, err := s.resolveRoles(ctx, roleNames)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashPassword(input.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	// Admins vouch for the address, so the account can log in straight away
+	now := time.Now().UTC()
+	user := &models.User{
+		Email:           email,
+		Name:            strings.TrimSpace(input.Name),
+		Password:        hashedPassword,
+		Roles:           roles,
+		EmailVerifiedAt: &now,
+	}
+
+	created, err := s.userRepo.CreateUserIfNotExists(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	if created != user {
+		return nil, ErrEmailTaken
+	}
+
+	logging.Log.Info("User created by admin",
+		zap.Uint("user_id", user.ID),
+		zap.Uint("admin_id", adminID),
+		zap.Strings("roles", models.RoleNames(user.Roles)))
+	return user, nil
+}
+
+// UpdateUser changes a user's profile, roles, disabled state or magic link sign
+// in. Changing roles or disabling an account signs out the user's sessions.
+func (s *UserAdminService) UpdateUser(ctx context.Context, userID uint, input UpdateUserInput, adminID uint) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
+
+	var roles []models.Role
+	rolesChanged := false
+	if input.Roles != nil {
+		roles, err = s.resolveRoles(ctx, *input.Roles)
+		if err != nil {
+			return nil, err
+		}
+		rolesChanged = !sameRoles(user.Roles, roles)
+	}
+
+	disabling := input.Disabled != nil && *input.Disabled && !user.Disabled
+
+	if disabling && userID == adminID {
+		return nil, ErrCannotModifySelf
+	}
+	keepsAdminRole := !rolesChanged || containsRole(roles, models.RoleAdmin)
+	removingAdmin := removesActiveAdmin(user, keepsAdminRole, !disabling)
+
+	if input.Email != nil {
+		email := normalizeEmail(*input.Email)
+		if email != user.Email {
+			exists, err := s.userRepo.EmailInUse(ctx, email)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, ErrEmailTaken
+			}
+			user.Email = email
+		}
+	}
+	if input.Name != nil {
+		user.Name = strings.TrimSpace(*input.Name)
+	}
+
+	err = s.database.RunInTransaction(ctx, func(tx *db.DB) error {
+		userRepo, roleRepo := db.NewUserRepository(tx), db.NewRoleRepository(tx)
+		if removingAdmin {
+			if err := ensureAnotherAdmin(ctx, roleRepo); err != nil {
+				return err
+			}
+		}
+
+		if err := userRepo.UpdateProfile(ctx, user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		if rolesChanged {
+			if err := roleRepo.SetUserRoles(ctx, userID, models.RoleNames(roles)); err != nil {
+				return fmt.Errorf("failed to update user roles: %w", err)
+			}
+		}
+		if input.Disabled != nil && *input.Disabled != user.Disabled {
+			if err := userRepo.SetDisabled(ctx, userID, *input.Disabled); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+		if input.MagicLink != nil && *input.MagicLink != user.MagicLink {
+			if err := userRepo.SetMagicLink(ctx, userID, *input.MagicLink); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rolesChanged {
+		user.Roles = roles
+	}
+	if input.Disabled != nil {
+		user.Disabled = *input.Disabled
+	}
+	if input.MagicLink != nil {
+		user.MagicLink = *input.MagicLink
+	}
+
+	// Tokens carry the user's permissions, so they must not outlive a role change
+	if rolesChanged || disabling {
+		if err := s.authService.RevokeAllSessions(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.Log.Info("User updated by admin",
+		zap.Uint("user_id", userID),
+		zap.Uint("admin_id", adminID),
+		zap.Strings("roles", models.RoleNames(user.Roles)),
+		zap.Bool("disabled", user.Disabled))
+	return user, nil
+}
+
+// DeleteUser soft deletes a user and signs out their sessions
+func (s *UserAdminService) DeleteUser(ctx context.Context, userID, adminID uint) error {
+	if userID == adminID {
+		return ErrCannotModifySelf
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if err := s.loadRoles(ctx, user); err != nil {
+		return err
+	}
+
+	err = s.database.RunInTransaction(ctx, func(tx *db.DB) error {
+		if removesActiveAdmin(user, true, false) {
+			if err := ensureAnotherAdmin(ctx, db.NewRoleRepository(tx)); err != nil {
+				return err
+			}
+		}
+		if err := db.NewUserRepository(tx).SoftDeleteUser(ctx, userID); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.authService.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	logging.Log.Warn("User deleted by admin", zap.Uint("user_id", userID), zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// RestoreUser brings back a soft deleted user
+func (s *UserAdminService) RestoreUser(ctx context.Context, userID, adminID uint) (*models.User, error) {
+	user, err := s.userRepo.GetByIDUnscoped(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.DeletedAt.Valid {
+		return nil, ErrUserNotDeleted
+	}
+
+	if err := s.userRepo.RestoreUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+	user.DeletedAt.Valid = false
+	if err := s.loadRoles(ctx, user); err != nil {
+		return nil, err
+	}
+
+	logging.Log.Info("User restored by admin", zap.Uint("user_id", userID), zap.Uint("admin_id", adminID))
+	return user, nil
+}
+
+// SetPassword replaces a user's password, for admins helping a user who cannot
+// use the reset email. Every session of the user is signed out.
+func (s *UserAdminService) SetPassword(ctx context.Context, userID uint, password string, adminID uint) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if err := ValidatePassword(password, user.Email); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := s.authService.RevokeAllSessions(ctx, user.ID); err != nil {
+		return err
+	}
+
+	event := NewAuthEvent(models.AuthEventPasswordReset, user.ID, nil)
+	event.Reason = "set by admin"
+	s.authService.RecordEvent(ctx, event)
+	logging.Log.Warn("Password set by admin", zap.Uint("user_id", user.ID), zap.Uint("admin_id", adminID))
+	return nil
+}
+
+// removesActiveAdmin reports whether a change takes the user out of the active
+// admins, by taking away the admin role or by disabling or deleting the account
+func removesActiveAdmin(user *models.User, keepsAdminRole, staysActive bool) bool {
+	if !user.HasRole(models.RoleAdmin) || user.Disabled {
+		return false
+	}
+	return !keepsAdminRole || !staysActive
+}
+
+// ensureAnotherAdmin fails if removing one active admin would leave none. It must
+// run in the transaction that removes the admin, which then holds the admins locked.
+func ensureAnotherAdmin(ctx context.Context, roleRepo *db.RoleRepository) error {
+	admins, err := roleRepo.LockActiveUsersWithRole(ctx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	return checkAnotherAdmin(admins)
+}
+
+// checkAnotherAdmin fails if an admin is about to be removed from the given
+// number of active admins, that admin included
+func checkAnotherAdmin(admins int64) error {
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// loadRoles fills in the user's roles
+func (s *UserAdminService) loadRoles(ctx context.Context, user *models.User) error {
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	user.Roles = roles
+	return nil
+}
+
+// resolveRoles looks up the named roles, failing if any of them does not exist
+func (s *UserAdminService) resolveRoles(ctx context.Context, names []string) ([]models.Role, error) {
+	roles := make([]models.Role, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if containsRole(roles, name) {
+			continue
+		}
+		role, err := s.roleRepo.GetByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownRole, name)
+		}
+		roles = append(roles, *role)
+	}
+	return roles, nil
+}
+
+// containsRole reports whether roles includes the named role
+func containsRole(roles []models.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRoles reports whether both lists hold the same set of roles
+func sameRoles(a, b []models.Role) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, role := range a {
+		if !containsRole(b, role.Name) {
+			return false
+		}
+	}
+	return true
+}
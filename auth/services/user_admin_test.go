@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestRemovesActiveAdmin(t *testing.T) {
+	admin := models.User{Roles: []models.Role{{Name: models.RoleAdmin}}}
+	disabledAdmin := models.User{Roles: []models.Role{{Name: models.RoleAdmin}}, Disabled: true}
+	family := models.User{Roles: []models.Role{{Name: models.RoleFamily}}}
+
+	cases := []struct {
+		name           string
+		user           models.User
+		keepsAdminRole bool
+		staysActive    bool
+		want           bool
+	}{
+		{"admin unchanged", admin, true, true, false},
+		{"admin demoted", admin, false, true, true},
+		{"admin disabled or deleted", admin, true, false, true},
+		{"admin demoted and disabled", admin, false, false, true},
+		{"disabled admin demoted", disabledAdmin, false, true, false},
+		{"disabled admin deleted", disabledAdmin, true, false, false},
+		{"non-admin disabled", family, true, false, false},
+	}
+
+	for _, tc := range cases {
+		if got := removesActiveAdmin(&tc.user, tc.keepsAdminRole, tc.staysActive); got != tc.want {
+			t.Errorf("%s: removesActiveAdmin() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCheckAnotherAdmin(t *testing.T) {
+	if err := checkAnotherAdmin(0); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("checkAnotherAdmin(0) = %v, want ErrLastAdmin", err)
+	}
+	if err := checkAnotherAdmin(1); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("checkAnotherAdmin(1) = %v, want ErrLastAdmin", err)
+	}
+	if err := checkAnotherAdmin(2); err != nil {
+		t.Errorf("checkAnotherAdmin(2) = %v, want nil", err)
+	}
+}
@@ -43,19 +43,175 @@ type APIConfig struct {
 
 // SecurityConfig defines security-related settings such as TLS and CORS.
 type SecurityConfig struct {
-	EnableTLS bool   `mapstructure:"enable_tls"` // If true, TLS is enabled; requires cert and key files.
-	CertFile  string `mapstructure:"cert_file"`  // Path to the TLS certificate file.
-	KeyFile   string `mapstructure:"key_file"`   // Path to the TLS private key file.
+	EnableTLS      bool     `mapstructure:"enable_tls"`      // If true, TLS is enabled; requires cert and key files.
+	CertFile       string   `mapstructure:"cert_file"`       // Path to the TLS certificate file.
+	KeyFile        string   `mapstructure:"key_file"`        // Path to the TLS private key file.
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // IPs or CIDRs of proxies whose X-Forwarded-For is trusted for the client IP; empty trusts none.
 }
 
 // JWTConfig defines JWT token configuration for authentication services.
 type JWTConfig struct {
-	AccessTokenDuration  time.Duration `mapstructure:"access_token_duration"`  // Duration for access tokens (e.g., "30m", "1h").
-	RefreshTokenDuration time.Duration `mapstructure:"refresh_token_duration"` // Duration for refresh tokens (e.g., "168h", "7d").
-	Issuer               string        `mapstructure:"issuer"`                 // JWT issuer identifier.
-	KeySize              int           `mapstructure:"key_size"`               // RSA key size for JWT signing (e.g., 2048, 4096).
-	KeyFile              string        `mapstructure:"key_file"`               // Path to the JWT private key file.
-	AllowedOrigins       []string      `mapstructure:"allowed_origins"`        // List of allowed origins for CORS (e.g., ["https://example.com"]).
+	AccessTokenDuration    time.Duration `mapstructure:"access_token_duration"`    // Duration for access tokens (e.g., "30m", "1h").
+	RefreshTokenDuration   time.Duration `mapstructure:"refresh_token_duration"`   // Duration for refresh tokens (e.g., "168h", "7d").
+	ServiceTokenDuration   time.Duration `mapstructure:"service_token_duration"`   // Duration for tokens issued to service accounts (e.g., "10m").
+	Issuer                 string        `mapstructure:"issuer"`                   // JWT issuer identifier.
+	Algorithm              string        `mapstructure:"algorithm"`                // Signing algorithm for new tokens: "RS256", "ES256" or "EdDSA".
+	KeySize                int           `mapstructure:"key_size"`                 // RSA key size for JWT signing (e.g., 2048, 4096).
+	KeyFile                string        `mapstructure:"key_file"`                 // Path to the PEM file holding the JWT signing keys; created if missing.
+	AllowedOrigins         []string      `mapstructure:"allowed_origins"`          // List of allowed origins for CORS (e.g., ["https://example.com"]).
+	RevocationPollInterval time.Duration `mapstructure:"revocation_poll_interval"` // How often services refresh the token revocation list (e.g., "15s").
+}
+
+// AuthConfig holds account lifecycle settings for the auth service.
+type AuthConfig struct {
+	PublicURL                 string                `mapstructure:"public_url"`                  // Externally reachable base URL used to build links in emails (e.g., "https://home.example.com").
+	RegistrationMode          string                `mapstructure:"registration_mode"`           // Initial self-registration mode: "open", "invite" or "disabled". Admins can change it at runtime.
+	VerificationTokenDuration time.Duration         `mapstructure:"verification_token_duration"` // Lifetime of email verification links (e.g., "24h").
+	InviteTokenDuration       time.Duration         `mapstructure:"invite_token_duration"`       // Default lifetime of invitations (e.g., "168h").
+	PasswordResetDuration     time.Duration         `mapstructure:"password_reset_duration"`     // Lifetime of password reset links (e.g., "1h").
+	EmailChangeDuration       time.Duration         `mapstructure:"email_change_duration"`       // Lifetime of links confirming a new email address (e.g., "24h").
+	ResetRequestsPerEmail     int                   `mapstructure:"reset_requests_per_email"`    // Password reset emails allowed per address per hour.
+	ResetRequestsPerIP        int                   `mapstructure:"reset_requests_per_ip"`       // Password reset requests allowed per client IP per hour.
+	InviteAttemptsPerIP       int                   `mapstructure:"invite_attempts_per_ip"`      // Registrations and invite code lookups allowed per client IP per hour.
+	PasswordPolicy            PasswordPolicyConfig  `mapstructure:"password_policy"`             // Rules new passwords must satisfy.
+	PasswordHashing           PasswordHashingConfig `mapstructure:"password_hashing"`            // Algorithm and cost used to hash new passwords.
+	TOTPIssuer                string                `mapstructure:"totp_issuer"`                 // Issuer name shown in authenticator apps (e.g., "Home Server").
+	MFAChallengeDuration      time.Duration         `mapstructure:"mfa_challenge_duration"`      // Time allowed to enter a 2FA code after the password step (e.g., "5m").
+	DefaultRole               string                `mapstructure:"default_role"`                // Role given to self-registered users (e.g., "guest").
+	AuditRetention            time.Duration         `mapstructure:"audit_retention"`             // How long authentication audit events are kept (e.g., "2160h"); 0 keeps them forever.
+	ImpersonationDuration     time.Duration         `mapstructure:"impersonation_duration"`      // Longest an admin may act as another user (e.g., "30m").
+	EncryptionKey             string                // Base64 encoded 32-byte key for secrets at rest, loaded securely via environment variable.
+	Bootstrap                 BootstrapConfig       // First admin account for fresh installs, loaded from environment variables.
+	WebAuthn                  WebAuthnConfig        `mapstructure:"webauthn"`     // Passkey (WebAuthn) relying party settings.
+	Lockout                   LockoutConfig         `mapstructure:"lockout"`      // Failed login throttling and account lockout.
+	OIDC                      OIDCConfig            `mapstructure:"oidc"`         // OpenID Connect provider for single sign-on into other apps.
+	External                  ExternalLoginConfig   `mapstructure:"external"`     // Upstream OpenID Connect providers users can sign in with.
+	ForwardAuth               ForwardAuthConfig     `mapstructure:"forward_auth"` // Login for apps without their own, checked by a reverse proxy.
+	MagicLink                 MagicLinkConfig       `mapstructure:"magic_link"`   // Passwordless sign in with emailed links.
+}
+
+// MagicLinkConfig controls passwordless sign in with emailed links. Admins choose
+// at runtime which users and roles may use it.
+type MagicLinkConfig struct {
+	TokenDuration    time.Duration `mapstructure:"token_duration"`     // Lifetime of sign-in links (e.g., "15m").
+	RequestsPerEmail int           `mapstructure:"requests_per_email"` // Sign-in emails allowed per address per hour.
+	RequestsPerIP    int           `mapstructure:"requests_per_ip"`    // Sign-in link requests allowed per client IP per hour.
+	UIRedirect       string        `mapstructure:"ui_redirect"`        // UI page that receives the result of a sign in (e.g., "/an/login/magic").
+}
+
+// BootstrapConfig creates the first admin when the auth service starts without one.
+// Without it a one-time setup token is written to the log instead.
+type BootstrapConfig struct {
+	AdminEmail        string // Email of the admin to create (BOOTSTRAP_ADMIN_EMAIL).
+	AdminName         string // Display name of the admin (BOOTSTRAP_ADMIN_NAME); defaults to "Admin".
+	AdminPasswordFile string // File holding the admin's password, e.g. a Docker secret (BOOTSTRAP_ADMIN_PASSWORD_FILE).
+}
+
+// ForwardAuthConfig controls the forward-auth endpoint that reverse proxies
+// (Traefik, nginx auth_request or the gateway) call before serving an app.
+type ForwardAuthConfig struct {
+	CookieName      string                 `mapstructure:"cookie_name"`      // Name of the sign-in cookie (e.g., "home_session").
+	CookieDomain    string                 `mapstructure:"cookie_domain"`    // Domain the cookie is shared with, so apps on subdomains see it (e.g., "home.example.com"); empty for the public_url host only.
+	SessionDuration time.Duration          `mapstructure:"session_duration"` // How long the sign-in cookie lasts (e.g., "24h").
+	Apps            []ForwardAuthAppConfig `mapstructure:"apps"`             // Protected apps and who may use them.
+}
+
+// ForwardAuthAppConfig sets the roles allowed to use one protected app.
+type ForwardAuthAppConfig struct {
+	Name  string   `mapstructure:"name"`  // Identifier proxies pass as the "app" query parameter (e.g., "wiki").
+	Roles []string `mapstructure:"roles"` // Roles allowed to use the app (e.g., ["admin", "family"]); empty allows every signed-in user.
+}
+
+// GatewayConfig controls what the gateway proxies besides the built-in services.
+type GatewayConfig struct {
+	Apps          []ProxiedAppConfig `mapstructure:"apps"`           // Apps served under /apps/<name>/ behind forward auth.
+	SessionCookie string             `mapstructure:"session_cookie"` // Forward-auth sign-in cookie withheld from apps; must match auth.forward_auth.cookie_name.
+}
+
+// ProxiedAppConfig describes an app the gateway proxies after checking forward auth.
+type ProxiedAppConfig struct {
+	Name     string `mapstructure:"name"`     // Path segment and forward-auth app name (e.g., "wiki").
+	Upstream string `mapstructure:"upstream"` // Base URL requests are sent to (e.g., "http://wiki:3000").
+}
+
+// ExternalLoginConfig controls signing in with upstream OpenID Connect providers.
+type ExternalLoginConfig struct {
+	StateDuration time.Duration            `mapstructure:"state_duration"` // Time allowed to finish signing in at the provider (e.g., "10m").
+	UIRedirect    string                   `mapstructure:"ui_redirect"`    // UI page that receives the result of an external login (e.g., "/an/login/external").
+	Providers     []ExternalProviderConfig `mapstructure:"providers"`      // Configured upstream providers.
+}
+
+// ExternalProviderConfig describes one upstream OpenID Connect provider.
+type ExternalProviderConfig struct {
+	Name          string   `mapstructure:"name"`         // Identifier used in URLs and settings (e.g., "google").
+	DisplayName   string   `mapstructure:"display_name"` // Label shown on the login button (e.g., "Google").
+	Issuer        string   `mapstructure:"issuer"`       // Issuer URL used for discovery (e.g., "https://accounts.google.com").
+	ClientID      string   `mapstructure:"client_id"`    // Client ID registered with the provider.
+	ClientSecret  string   // Client secret, loaded securely via the AUTH_EXTERNAL_<NAME>_CLIENT_SECRET environment variable.
+	Scopes        []string `mapstructure:"scopes"`         // Scopes to request; defaults to ["openid", "email", "profile"].
+	AutoProvision bool     `mapstructure:"auto_provision"` // Initial setting for creating accounts on first sign in. Admins can change it at runtime.
+}
+
+// OIDCConfig controls the OpenID Connect provider.
+type OIDCConfig struct {
+	Issuer          string        `mapstructure:"issuer"`           // Issuer URL; defaults to auth.public_url followed by the API base URL and "/auth/oidc".
+	CodeDuration    time.Duration `mapstructure:"code_duration"`    // Lifetime of authorization codes (e.g., "1m").
+	TokenDuration   time.Duration `mapstructure:"token_duration"`   // Lifetime of ID and access tokens issued to clients (e.g., "1h").
+	SessionDuration time.Duration `mapstructure:"session_duration"` // How long the provider's sign-in cookie lasts before users must log in again (e.g., "24h").
+}
+
+// LockoutConfig controls how repeated failed logins slow down and lock an account.
+type LockoutConfig struct {
+	ThrottleAfter int           `mapstructure:"throttle_after"` // Failed attempts allowed before delays start (e.g., 3).
+	BaseDelay     time.Duration `mapstructure:"base_delay"`     // First delay between attempts, doubled per further failure (e.g., "1s").
+	MaxDelay      time.Duration `mapstructure:"max_delay"`      // Upper bound for the delay between attempts (e.g., "30s").
+	Threshold     int           `mapstructure:"threshold"`      // Consecutive failures that lock the account (e.g., 10).
+	Duration      time.Duration `mapstructure:"duration"`       // How long a locked account stays locked (e.g., "15m").
+}
+
+// WebAuthnConfig identifies the relying party for passkey ceremonies.
+type WebAuthnConfig struct {
+	RPID             string        `mapstructure:"rp_id"`             // Relying party ID, the site's domain without scheme or port (e.g., "home.example.com").
+	RPDisplayName    string        `mapstructure:"rp_display_name"`   // Name shown by the browser during passkey prompts (e.g., "Home Server").
+	RPOrigins        []string      `mapstructure:"rp_origins"`        // Allowed origins (e.g., ["https://home.example.com"]); defaults to auth.public_url.
+	CeremonyDuration time.Duration `mapstructure:"ceremony_duration"` // Time allowed to finish a passkey registration or login (e.g., "5m").
+}
+
+// PasswordPolicyConfig defines the rules applied whenever a password is set.
+type PasswordPolicyConfig struct {
+	MinLength     int  `mapstructure:"min_length"`     // Minimum number of characters (e.g., 10).
+	BlockCommon   bool `mapstructure:"block_common"`   // If true, reject passwords from the bundled common password list.
+	DisallowEmail bool `mapstructure:"disallow_email"` // If true, reject passwords equal to the user's email or its local part.
+}
+
+// PasswordHashingConfig selects how new password hashes are computed. Hashes made
+// with another algorithm or cost keep working and are upgraded at the next login.
+type PasswordHashingConfig struct {
+	Algorithm   string `mapstructure:"algorithm"`   // "argon2id" or "bcrypt".
+	Memory      uint32 `mapstructure:"memory"`      // Argon2id memory in KiB (e.g., 65536 for 64 MiB).
+	Iterations  uint32 `mapstructure:"iterations"`  // Argon2id passes over the memory (e.g., 3).
+	Parallelism uint8  `mapstructure:"parallelism"` // Argon2id lanes (e.g., 2).
+	BcryptCost  int    `mapstructure:"bcrypt_cost"` // bcrypt cost factor when the algorithm is "bcrypt" (e.g., 12).
+}
+
+// MailConfig defines how outgoing email is delivered.
+type MailConfig struct {
+	Transport string `mapstructure:"transport"` // Delivery transport: "smtp" or "log" (writes messages to the service log).
+	Host      string `mapstructure:"host"`      // SMTP server hostname (e.g., "mailpit" for a local catcher).
+	Port      int    `mapstructure:"port"`      // SMTP server port (e.g., 587, or 1025 for mailpit).
+	Username  string `mapstructure:"username"`  // SMTP username; leave empty for servers without authentication.
+	Password  string // SMTP password, loaded securely via environment variable.
+	From      string `mapstructure:"from"`     // Sender address (e.g., "Home Server <noreply@example.com>").
+	StartTLS  bool   `mapstructure:"starttls"` // If true, upgrade the connection with STARTTLS before authenticating.
+}
+
+// ServiceAuthConfig holds the credentials a service uses to authenticate to other
+// services, and where it finds the keys to verify tokens sent to it.
+type ServiceAuthConfig struct {
+	TokenURL     string `mapstructure:"token_url"` // Token endpoint of the auth service (e.g., "http://auth-service:8080/api/v1/auth/oidc/token").
+	JWKSURL      string `mapstructure:"jwks_url"`  // Key set of the auth service (e.g., "http://auth-service:8080/api/v1/auth/jwks").
+	ClientID     string `mapstructure:"client_id"` // Client ID of this service's service account.
+	ClientSecret string // Service account secret, loaded securely via the SERVICE_AUTH_CLIENT_SECRET environment variable.
 }
 
 // Config aggregates all other configurations into a single structure.
@@ -66,6 +222,11 @@ type Config struct {
 	API      APIConfig      `mapstructure:"api"`      // API-related configuration.
 	Security SecurityConfig `mapstructure:"security"` // Security/TLS/CORS configuration.
 	JWT      JWTConfig      `mapstructure:"jwt"`      // JWT authentication configuration.
+	Auth     AuthConfig     `mapstructure:"auth"`     // Account lifecycle configuration (auth service).
+	Mail     MailConfig     `mapstructure:"mail"`     // Outgoing email configuration.
+
+	ServiceAuth ServiceAuthConfig `mapstructure:"service_auth"` // Service-to-service authentication.
+	Gateway     GatewayConfig     `mapstructure:"gateway"`      // Extra routes proxied by the gateway.
 }
 
 // AppConfig is the globally accessible parsed configuration for the running service.
@@ -94,11 +255,35 @@ func LoadConfig(configPath string) error {
 
 	// Load secrets from environment variable
 	cfg.Database.Password = os.Getenv("DB_PASSWORD")
+	cfg.Mail.Password = os.Getenv("SMTP_PASSWORD")
+	cfg.Auth.EncryptionKey = os.Getenv("AUTH_ENCRYPTION_KEY")
+	cfg.Auth.Bootstrap = BootstrapConfig{
+		AdminEmail:        os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		AdminName:         os.Getenv("BOOTSTRAP_ADMIN_NAME"),
+		AdminPasswordFile: os.Getenv("BOOTSTRAP_ADMIN_PASSWORD_FILE"),
+	}
+	cfg.ServiceAuth.ClientSecret = os.Getenv("SERVICE_AUTH_CLIENT_SECRET")
+	for i := range cfg.Auth.External.Providers {
+		provider := &cfg.Auth.External.Providers[i]
+		provider.ClientSecret = os.Getenv(ExternalClientSecretEnv(provider.Name))
+	}
 
 	AppConfig = &cfg
 	return nil
 }
 
+// ExternalClientSecretEnv returns the environment variable holding an upstream provider's
+// client secret, e.g. AUTH_EXTERNAL_GOOGLE_CLIENT_SECRET for the provider "google".
+func ExternalClientSecretEnv(provider string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, provider)
+	return "AUTH_EXTERNAL_" + strings.ToUpper(name) + "_CLIENT_SECRET"
+}
+
 // setDefaults initializes default values for the configuration.
 func setDefaults() {
 	viper.SetDefault("service.port", 8080)
@@ -115,6 +300,7 @@ func setDefaults() {
 	viper.SetDefault("security.enable_tls", true)
 	viper.SetDefault("security.cert_file", "cert.pem")
 	viper.SetDefault("security.key_file", "key.pem")
+	viper.SetDefault("security.trusted_proxies", []string{})
 
 	// Database defaults
 	viper.SetDefault("database.ssl_mode", "disable")
@@ -122,9 +308,69 @@ func setDefaults() {
 	// JWT defaults
 	viper.SetDefault("jwt.access_token_duration", "30m")
 	viper.SetDefault("jwt.refresh_token_duration", "168h") // 7 days
+	viper.SetDefault("jwt.service_token_duration", "10m")
 	viper.SetDefault("jwt.issuer", "home-server-auth")
+	viper.SetDefault("jwt.algorithm", "RS256")
 	viper.SetDefault("jwt.key_size", 2048)
 	viper.SetDefault("jwt.key_file", "jwt_key.pem")
+	viper.SetDefault("jwt.revocation_poll_interval", "15s")
 	// Default allowed origins for CORS, can be overridden in config.yaml
 	viper.SetDefault("jwt.allowed_origins", []string{})
+
+	// Auth defaults
+	viper.SetDefault("auth.public_url", "http://localhost:8080")
+	viper.SetDefault("auth.registration_mode", "disabled")
+	viper.SetDefault("auth.verification_token_duration", "24h")
+	viper.SetDefault("auth.invite_token_duration", "168h") // 7 days
+	viper.SetDefault("auth.password_reset_duration", "1h")
+	viper.SetDefault("auth.email_change_duration", "24h")
+	viper.SetDefault("auth.reset_requests_per_email", 3)
+	viper.SetDefault("auth.reset_requests_per_ip", 10)
+	viper.SetDefault("auth.invite_attempts_per_ip", 20)
+	viper.SetDefault("auth.password_policy.min_length", 10)
+	viper.SetDefault("auth.password_policy.block_common", true)
+	viper.SetDefault("auth.password_policy.disallow_email", true)
+	viper.SetDefault("auth.password_hashing.algorithm", "argon2id")
+	viper.SetDefault("auth.password_hashing.memory", 65536) // 64 MiB
+	viper.SetDefault("auth.password_hashing.iterations", 3)
+	viper.SetDefault("auth.password_hashing.parallelism", 2)
+	viper.SetDefault("auth.password_hashing.bcrypt_cost", 10)
+	viper.SetDefault("auth.totp_issuer", "Home Server")
+	viper.SetDefault("auth.default_role", "guest")
+	viper.SetDefault("auth.mfa_challenge_duration", "5m")
+	viper.SetDefault("auth.audit_retention", "2160h") // 90 days
+	viper.SetDefault("auth.webauthn.rp_id", "localhost")
+	viper.SetDefault("auth.webauthn.rp_display_name", "Home Server")
+	viper.SetDefault("auth.webauthn.rp_origins", []string{})
+	viper.SetDefault("auth.webauthn.ceremony_duration", "5m")
+	viper.SetDefault("auth.oidc.issuer", "")
+	viper.SetDefault("auth.oidc.code_duration", "1m")
+	viper.SetDefault("auth.oidc.token_duration", "1h")
+	viper.SetDefault("auth.oidc.session_duration", "24h")
+	viper.SetDefault("auth.external.state_duration", "10m")
+	viper.SetDefault("auth.external.ui_redirect", "/an/login/external")
+	viper.SetDefault("auth.impersonation_duration", "30m")
+	viper.SetDefault("auth.forward_auth.cookie_name", "home_session")
+	viper.SetDefault("gateway.session_cookie", "home_session")
+	viper.SetDefault("auth.forward_auth.cookie_domain", "")
+	viper.SetDefault("auth.forward_auth.session_duration", "24h")
+	viper.SetDefault("auth.magic_link.token_duration", "15m")
+	viper.SetDefault("auth.magic_link.requests_per_email", 3)
+	viper.SetDefault("auth.magic_link.requests_per_ip", 10)
+	viper.SetDefault("auth.magic_link.ui_redirect", "/an/login/magic")
+	viper.SetDefault("auth.lockout.throttle_after", 3)
+	viper.SetDefault("auth.lockout.base_delay", "1s")
+	viper.SetDefault("auth.lockout.max_delay", "30s")
+	viper.SetDefault("auth.lockout.threshold", 10)
+	viper.SetDefault("auth.lockout.duration", "15m")
+
+	// Mail defaults
+	viper.SetDefault("mail.transport", "log")
+	viper.SetDefault("mail.port", 587)
+	viper.SetDefault("mail.from", "Home Server <noreply@localhost>")
+	viper.SetDefault("mail.starttls", true)
+
+	// Service-to-service defaults, using Docker Compose DNS
+	viper.SetDefault("service_auth.token_url", "http://auth-service:8080/api/v1/auth/oidc/token")
+	viper.SetDefault("service_auth.jwks_url", "http://auth-service:8080/api/v1/auth/jwks")
 }
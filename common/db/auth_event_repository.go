@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// AuthEventFilter narrows down an audit log query. Zero values match everything.
+type AuthEventFilter struct {
+	UserID  uint
+	ActorID uint // admin who impersonated the user
+	Type    string
+	Since   time.Time
+	Until   time.Time
+}
+
+// AuthEventRepository provides authentication audit log database operations
+type AuthEventRepository struct {
+	*GormRepository[models.AuthEvent]
+	logger *zap.Logger
+}
+
+// NewAuthEventRepository creates a new auth event repository
+func NewAuthEventRepository(db *DB) *AuthEventRepository {
+	return &AuthEventRepository{
+		GormRepository: NewGormRepository[models.AuthEvent](db),
+		logger:         db.logger,
+	}
+}
+
+// Search returns a page of events matching the filter, newest first, and the total number of matches
+func (r *AuthEventRepository) Search(ctx context.Context, filter AuthEventFilter, page, pageSize int) ([]models.AuthEvent, int64, error) {
+	var events []models.AuthEvent
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.AuthEvent{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.Error("Failed to count auth events", zap.Error(err))
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(pageSize).Find(&events).Error; err != nil {
+		r.logger.Error("Failed to search auth events", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+// DeleteBefore permanently removes events recorded before the given time
+func (r *AuthEventRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AuthEvent{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete old auth events", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
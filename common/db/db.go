@@ -226,6 +226,14 @@ func (db *DB) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
 	return db.DB.WithContext(ctx).Transaction(fn)
 }
 
+// RunInTransaction executes a function within a database transaction. Repositories
+// created from tx take part in it, so services can combine their operations.
+func (db *DB) RunInTransaction(ctx context.Context, fn func(tx *DB) error) error {
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&DB{DB: tx, logger: db.logger})
+	})
+}
+
 // AutoMigrate runs auto migration for given models
 func (db *DB) AutoMigrate(models ...interface{}) error {
 	db.logger.Info("Running auto migration")
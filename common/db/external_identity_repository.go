@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// ExternalIdentityRepository provides database operations for identities linked from upstream providers
+type ExternalIdentityRepository struct {
+	*GormRepository[models.ExternalIdentity]
+	logger *zap.Logger
+}
+
+// NewExternalIdentityRepository creates a new external identity repository
+func NewExternalIdentityRepository(db *DB) *ExternalIdentityRepository {
+	return &ExternalIdentityRepository{
+		GormRepository: NewGormRepository[models.ExternalIdentity](db),
+		logger:         db.logger,
+	}
+}
+
+// GetBySubject retrieves the identity linked to a provider's subject
+func (r *ExternalIdentityRepository) GetBySubject(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	if err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get external identity", zap.Error(err), zap.String("provider", provider))
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// GetForUser retrieves the identity a user has linked at a provider
+func (r *ExternalIdentityRepository) GetForUser(ctx context.Context, userID uint, provider string) (*models.ExternalIdentity, error) {
+	var identity models.ExternalIdentity
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND provider = ?", userID, provider).First(&identity).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get external identity for user", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// ListForUser returns every identity linked to a user, oldest first
+func (r *ExternalIdentityRepository) ListForUser(ctx context.Context, userID uint) ([]models.ExternalIdentity, error) {
+	var identities []models.ExternalIdentity
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&identities).Error; err != nil {
+		r.logger.Error("Failed to list external identities", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return identities, nil
+}
+
+// RecordLogin stores the email reported by the provider and the time of the sign in
+func (r *ExternalIdentityRepository) RecordLogin(ctx context.Context, id uint, email string) error {
+	result := r.db.WithContext(ctx).Model(&models.ExternalIdentity{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"email":         email,
+			"last_login_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		r.logger.Error("Failed to record external login", zap.Error(result.Error), zap.Uint("id", id))
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteForUser permanently removes the identity a user linked at a provider.
+// It returns false if no such identity exists.
+func (r *ExternalIdentityRepository) DeleteForUser(ctx context.Context, userID uint, provider string) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.ExternalIdentity{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete external identity", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// InvitationRepository provides invitation database operations
+type InvitationRepository struct {
+	*GormRepository[models.Invitation]
+	logger *zap.Logger
+}
+
+// NewInvitationRepository creates a new invitation repository
+func NewInvitationRepository(db *DB) *InvitationRepository {
+	return &InvitationRepository{
+		GormRepository: NewGormRepository[models.Invitation](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByCodeHash retrieves an invitation and its role by the hash of its code
+func (r *InvitationRepository) GetByCodeHash(ctx context.Context, codeHash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := r.db.WithContext(ctx).Preload("Role").Where("code_hash = ?", codeHash).First(&invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get invitation by code", zap.Error(err))
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// List returns invitations with their roles, newest first. Unless includeInactive
+// is set, only invitations that can still be redeemed are returned.
+func (r *InvitationRepository) List(ctx context.Context, includeInactive bool) ([]models.Invitation, error) {
+	query := r.db.WithContext(ctx).Preload("Role").Order("created_at DESC, id DESC")
+	if !includeInactive {
+		query = query.Where("revoked_at IS NULL AND uses < max_uses AND expires_at > ?", time.Now().UTC())
+	}
+
+	var invitations []models.Invitation
+	if err := query.Find(&invitations).Error; err != nil {
+		r.logger.Error("Failed to list invitations", zap.Error(err))
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// Redeem atomically counts one use of an invitation. It returns false if the
+// invitation was revoked, has expired or has no uses left.
+func (r *InvitationRepository) Redeem(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL AND uses < max_uses AND expires_at > ?", id, time.Now().UTC()).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		r.logger.Error("Failed to redeem invitation", zap.Error(result.Error), zap.Uint("id", id))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revoke stops an invitation from being redeemed. It returns false if the
+// invitation does not exist or was already revoked.
+func (r *InvitationRepository) Revoke(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to revoke invitation", zap.Error(result.Error), zap.Uint("id", id))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
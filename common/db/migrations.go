@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// AuthModels lists every model owned by the auth service schema
+var AuthModels = []interface{}{
+	&models.User{},
+	&models.Role{},
+	&models.Permission{},
+	&models.RefreshToken{},
+	&models.RevokedToken{},
+	&models.OneTimeToken{},
+	&models.Setting{},
+	&models.TOTPCredential{},
+	&models.RecoveryCode{},
+	&models.PasskeyCredential{},
+	&models.OAuthClient{},
+	&models.OAuthConsent{},
+	&models.ExternalIdentity{},
+	&models.Session{},
+	&models.AuthEvent{},
+	&models.Invitation{},
+	&models.ServiceAccount{},
+}
+
+// MigrateAuthSchema migrates the auth service schema and backfills data for
+// columns introduced after users already existed.
+func MigrateAuthSchema(db *DB) error {
+	// Users created before email verification existed are treated as verified.
+	// The check must happen before AutoMigrate adds the column.
+	backfillVerified := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	if err := db.AutoMigrate(AuthModels...); err != nil {
+		return err
+	}
+
+	if backfillVerified {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			return fmt.Errorf("failed to backfill email verification: %w", err)
+		}
+		db.logger.Info("Marked existing users as email verified")
+	}
+
+	if err := seedRoles(db.DB); err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+
+	if err := migrateIsAdmin(db); err != nil {
+		return fmt.Errorf("failed to migrate admin flags to roles: %w", err)
+	}
+
+	return nil
+}
+
+// seedRoles makes sure the built-in roles exist and hold at least their default
+// permissions. Permissions added to a role by hand are left alone.
+func seedRoles(tx *gorm.DB) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range models.DefaultRolePermissions {
+			role := models.Role{Name: roleName}
+			if err := tx.Where(models.Role{Name: roleName}).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			permissions := make([]models.Permission, 0, len(permissionNames))
+			for _, name := range permissionNames {
+				permission := models.Permission{Name: name}
+				if err := tx.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+					return err
+				}
+				permissions = append(permissions, permission)
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateIsAdmin converts the legacy users.is_admin column into role
+// assignments: admins get the admin role, everyone else the family role.
+func migrateIsAdmin(db *DB) error {
+	if !db.Migrator().HasColumn("users", "is_admin") {
+		return nil
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var admin, family models.Role
+		if err := tx.Where("name = ?", models.RoleAdmin).First(&admin).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("name = ?", models.RoleFamily).First(&family).Error; err != nil {
+			return err
+		}
+
+		var rows []struct {
+			ID      uint
+			IsAdmin bool
+		}
+		if err := tx.Table("users").Select("id", "is_admin").Scan(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			roleID := family.ID
+			if row.IsAdmin {
+				roleID = admin.ID
+			}
+			if err := tx.Table("user_roles").
+				Clauses(clause.OnConflict{DoNothing: true}).
+				Create(map[string]interface{}{"user_id": row.ID, "role_id": roleID}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn("users", "is_admin")
+	})
+	if err != nil {
+		return err
+	}
+
+	db.logger.Info("Migrated users.is_admin to roles")
+	return nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// OAuthRepository provides OIDC client and consent database operations
+type OAuthRepository struct {
+	*GormRepository[models.OAuthClient]
+	logger *zap.Logger
+}
+
+// NewOAuthRepository creates a new OAuth repository
+func NewOAuthRepository(db *DB) *OAuthRepository {
+	return &OAuthRepository{
+		GormRepository: NewGormRepository[models.OAuthClient](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByClientID retrieves a client by its public client ID
+func (r *OAuthRepository) GetByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	if err := r.db.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get OAuth client", zap.Error(err), zap.String("client_id", clientID))
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients returns every registered client, oldest first
+func (r *OAuthRepository) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	var clients []models.OAuthClient
+	if err := r.db.WithContext(ctx).Order("id").Find(&clients).Error; err != nil {
+		r.logger.Error("Failed to list OAuth clients", zap.Error(err))
+		return nil, err
+	}
+	return clients, nil
+}
+
+// GetConsent retrieves the consent a user gave a client
+func (r *OAuthRepository) GetConsent(ctx context.Context, userID uint, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get OAuth consent", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// SaveConsent creates or replaces the scopes a user granted a client
+func (r *OAuthRepository) SaveConsent(ctx context.Context, consent *models.OAuthConsent) error {
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(consent).Error
+	if err != nil {
+		r.logger.Error("Failed to save OAuth consent", zap.Error(err), zap.Uint("user_id", consent.UserID))
+	}
+	return err
+}
+
+// ListConsents returns the consents a user has given
+func (r *OAuthRepository) ListConsents(ctx context.Context, userID uint) ([]models.OAuthConsent, error) {
+	var consents []models.OAuthConsent
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&consents).Error; err != nil {
+		r.logger.Error("Failed to list OAuth consents", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return consents, nil
+}
+
+// DeleteConsent permanently removes a user's consent for a client. It returns
+// false if there was none.
+func (r *OAuthRepository) DeleteConsent(ctx context.Context, userID uint, clientID string) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("user_id = ? AND client_id = ?", userID, clientID).
+		Delete(&models.OAuthConsent{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete OAuth consent", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteClient soft deletes a client and permanently removes its consents
+func (r *OAuthRepository) DeleteClient(ctx context.Context, client *models.OAuthClient) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("client_id = ?", client.ClientID).Delete(&models.OAuthConsent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(client).Error; err != nil {
+			r.logger.Error("Failed to delete OAuth client", zap.Error(err), zap.String("client_id", client.ClientID))
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// OneTimeTokenRepository provides one-time token database operations
+type OneTimeTokenRepository struct {
+	*GormRepository[models.OneTimeToken]
+	logger *zap.Logger
+}
+
+// NewOneTimeTokenRepository creates a new one-time token repository
+func NewOneTimeTokenRepository(db *DB) *OneTimeTokenRepository {
+	return &OneTimeTokenRepository{
+		GormRepository: NewGormRepository[models.OneTimeToken](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByHash retrieves a token of the given purpose by the hash of its value
+func (r *OneTimeTokenRepository) GetByHash(ctx context.Context, purpose, tokenHash string) (*models.OneTimeToken, error) {
+	var token models.OneTimeToken
+	if err := r.db.WithContext(ctx).Where("purpose = ? AND token_hash = ?", purpose, tokenHash).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get one-time token by hash", zap.Error(err), zap.String("purpose", purpose))
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume atomically marks a token as used. It returns false if the token was
+// already used or has expired.
+func (r *OneTimeTokenRepository) Consume(ctx context.Context, id uint) (bool, error) {
+	now := time.Now().UTC()
+	result := r.db.WithContext(ctx).Model(&models.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		r.logger.Error("Failed to consume one-time token", zap.Error(result.Error), zap.Uint("id", id))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateForUser marks all outstanding tokens of a purpose for a user as used
+func (r *OneTimeTokenRepository) InvalidateForUser(ctx context.Context, purpose string, userID uint) error {
+	result := r.db.WithContext(ctx).Model(&models.OneTimeToken{}).
+		Where("purpose = ? AND user_id = ? AND used_at IS NULL", purpose, userID).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to invalidate one-time tokens", zap.Error(result.Error),
+			zap.String("purpose", purpose), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteExpired permanently removes tokens that expired before the given time
+func (r *OneTimeTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("expires_at < ?", before).Delete(&models.OneTimeToken{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete expired one-time tokens", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
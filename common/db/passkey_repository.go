@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// PasskeyRepository provides WebAuthn credential database operations
+type PasskeyRepository struct {
+	*GormRepository[models.PasskeyCredential]
+	logger *zap.Logger
+}
+
+// NewPasskeyRepository creates a new passkey repository
+func NewPasskeyRepository(db *DB) *PasskeyRepository {
+	return &PasskeyRepository{
+		GormRepository: NewGormRepository[models.PasskeyCredential](db),
+		logger:         db.logger,
+	}
+}
+
+// ListForUser returns all passkeys registered by a user, oldest first
+func (r *PasskeyRepository) ListForUser(ctx context.Context, userID uint) ([]models.PasskeyCredential, error) {
+	var credentials []models.PasskeyCredential
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&credentials).Error; err != nil {
+		r.logger.Error("Failed to list passkeys", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// GetByCredentialID retrieves a passkey by its base64url encoded credential ID
+func (r *PasskeyRepository) GetByCredentialID(ctx context.Context, credentialID string) (*models.PasskeyCredential, error) {
+	var credential models.PasskeyCredential
+	if err := r.db.WithContext(ctx).Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get passkey by credential ID", zap.Error(err))
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// RecordUse stores the authenticator state after a successful login
+func (r *PasskeyRepository) RecordUse(ctx context.Context, id uint, signCount uint32, backupState bool) error {
+	result := r.db.WithContext(ctx).Model(&models.PasskeyCredential{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		r.logger.Error("Failed to record passkey use", zap.Error(result.Error), zap.Uint("id", id))
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteForUser permanently removes one of a user's passkeys. It returns false
+// if the passkey does not exist or belongs to someone else.
+func (r *PasskeyRepository) DeleteForUser(ctx context.Context, userID, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("id = ? AND user_id = ?", id, userID).Delete(&models.PasskeyCredential{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete passkey", zap.Error(result.Error), zap.Uint("id", id))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
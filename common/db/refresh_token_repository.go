@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// RefreshTokenRepository provides refresh token specific database operations
+type RefreshTokenRepository struct {
+	*GormRepository[models.RefreshToken]
+	logger *zap.Logger
+}
+
+// NewRefreshTokenRepository creates a new refresh token repository
+func NewRefreshTokenRepository(db *DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		GormRepository: NewGormRepository[models.RefreshToken](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByHash retrieves a refresh token by the hash of its value
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get refresh token by hash", zap.Error(err))
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed atomically marks a refresh token as used. It returns false if the
+// token had already been used or revoked, which signals a replay.
+func (r *RefreshTokenRepository) MarkUsed(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to mark refresh token as used", zap.Error(result.Error), zap.Uint("id", id))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeFamily revokes every token that belongs to the given family
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to revoke refresh token family", zap.Error(result.Error), zap.String("family_id", familyID))
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every outstanding refresh token of a user
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID uint) error {
+	result := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to revoke refresh tokens for user", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeForClient revokes every outstanding refresh token issued to an OIDC
+// client, optionally limited to one user when userID is non-zero
+func (r *RefreshTokenRepository) RevokeForClient(ctx context.Context, clientID string, userID uint) error {
+	query := r.db.WithContext(ctx).Model(&models.RefreshToken{}).
+		Where("client_id = ? AND revoked_at IS NULL", clientID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Update("revoked_at", time.Now().UTC()).Error; err != nil {
+		r.logger.Error("Failed to revoke refresh tokens for client", zap.Error(err), zap.String("client_id", clientID))
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired permanently removes tokens that expired before the given time
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("expires_at < ?", before).Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete expired refresh tokens", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
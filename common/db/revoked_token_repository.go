@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// RevokedTokenRepository provides access token denylist database operations
+type RevokedTokenRepository struct {
+	*GormRepository[models.RevokedToken]
+	logger *zap.Logger
+}
+
+// NewRevokedTokenRepository creates a new revoked token repository
+func NewRevokedTokenRepository(db *DB) *RevokedTokenRepository {
+	return &RevokedTokenRepository{
+		GormRepository: NewGormRepository[models.RevokedToken](db),
+		logger:         db.logger,
+	}
+}
+
+// Revoke stores a revoked token, ignoring tokens that are already revoked
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, token *models.RevokedToken) error {
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error; err != nil {
+		r.logger.Error("Failed to revoke token", zap.Error(err), zap.String("jti", token.JTI))
+		return err
+	}
+	return nil
+}
+
+// GetActive returns revoked tokens that have not expired yet
+func (r *RevokedTokenRepository) GetActive(ctx context.Context, now time.Time) ([]models.RevokedToken, error) {
+	var tokens []models.RevokedToken
+	if err := r.db.WithContext(ctx).Where("expires_at >= ?", now).Find(&tokens).Error; err != nil {
+		r.logger.Error("Failed to get active revoked tokens", zap.Error(err))
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteExpired permanently removes revocations for tokens that expired before the given time
+func (r *RevokedTokenRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().Where("expires_at < ?", before).Delete(&models.RevokedToken{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete expired revoked tokens", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// RoleRepository provides role and permission database operations
+type RoleRepository struct {
+	*GormRepository[models.Role]
+	logger *zap.Logger
+}
+
+// NewRoleRepository creates a new role repository
+func NewRoleRepository(db *DB) *RoleRepository {
+	return &RoleRepository{
+		GormRepository: NewGormRepository[models.Role](db),
+		logger:         db.logger,
+	}
+}
+
+// ListWithPermissions returns all roles with their permissions
+func (r *RoleRepository) ListWithPermissions(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.WithContext(ctx).Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+		r.logger.Error("Failed to list roles", zap.Error(err))
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetByName retrieves a role by name
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&role).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get role by name", zap.Error(err), zap.String("role", name))
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetUserRoles returns a user's roles with their permissions
+func (r *RoleRepository) GetUserRoles(ctx context.Context, userID uint) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.WithContext(ctx).
+		Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.id").
+		Find(&roles).Error; err != nil {
+		r.logger.Error("Failed to get user roles", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return roles, nil
+}
+
+// SetUserRoles replaces a user's roles with the named roles
+func (r *RoleRepository) SetUserRoles(ctx context.Context, userID uint, roleNames []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if len(roleNames) > 0 {
+			if err := tx.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+
+		user := models.User{BaseModel: models.BaseModel{ID: userID}}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			r.logger.Error("Failed to set user roles", zap.Error(err), zap.Uint("user_id", userID))
+			return err
+		}
+		return nil
+	})
+}
+
+// CountActiveUsersWithRole counts users with a role that are neither disabled nor deleted
+func (r *RoleRepository) CountActiveUsersWithRole(ctx context.Context, roleName string) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND users.disabled = ?", roleName, false).
+		Count(&count).Error; err != nil {
+		r.logger.Error("Failed to count users with role", zap.Error(err), zap.String("role", roleName))
+		return 0, err
+	}
+	return count, nil
+}
+
+// LockActiveUsersWithRole locks the active users with a role until the surrounding
+// transaction ends and returns how many there are, so that concurrent changes
+// cannot together remove every holder of the role
+func (r *RoleRepository) LockActiveUsersWithRole(ctx context.Context, roleName string) (int64, error) {
+	var ids []uint
+	if err := r.db.WithContext(ctx).Model(&models.User{}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND users.disabled = ?", roleName, false).
+		Order("users.id").
+		Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "users"}}).
+		Pluck("users.id", &ids).Error; err != nil {
+		r.logger.Error("Failed to lock users with role", zap.Error(err), zap.String("role", roleName))
+		return 0, err
+	}
+
+	// Counted again: after waiting for a lock, the query above still sees the
+	// role assignments from before the other transaction committed
+	return r.CountActiveUsersWithRole(ctx, roleName)
+}
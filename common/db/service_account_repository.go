@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// ServiceAccountRepository provides service account database operations
+type ServiceAccountRepository struct {
+	*GormRepository[models.ServiceAccount]
+	logger *zap.Logger
+}
+
+// NewServiceAccountRepository creates a new service account repository
+func NewServiceAccountRepository(db *DB) *ServiceAccountRepository {
+	return &ServiceAccountRepository{
+		GormRepository: NewGormRepository[models.ServiceAccount](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByClientID retrieves a service account by its client ID
+func (r *ServiceAccountRepository) GetByClientID(ctx context.Context, clientID string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := r.db.WithContext(ctx).Where("client_id = ?", clientID).First(&account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get service account", zap.Error(err), zap.String("client_id", clientID))
+		return nil, err
+	}
+	return &account, nil
+}
+
+// List returns every service account, oldest first
+func (r *ServiceAccountRepository) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	if err := r.db.WithContext(ctx).Order("id").Find(&accounts).Error; err != nil {
+		r.logger.Error("Failed to list service accounts", zap.Error(err))
+		return nil, err
+	}
+	return accounts, nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// SessionRepository provides login session database operations
+type SessionRepository struct {
+	*GormRepository[models.Session]
+	logger *zap.Logger
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(db *DB) *SessionRepository {
+	return &SessionRepository{
+		GormRepository: NewGormRepository[models.Session](db),
+		logger:         db.logger,
+	}
+}
+
+// Record creates the session for a token family, or updates the device details,
+// last-seen time and expiry of an existing one. Recording a session that was
+// revoked reactivates it; callers only do so after issuing it new tokens.
+func (r *SessionRepository) Record(ctx context.Context, session *models.Session) error {
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "family_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"user_agent":   session.UserAgent,
+			"ip_address":   session.IPAddress,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"revoked_at":   nil,
+			"updated_at":   time.Now().UTC(),
+		}),
+	}).Create(session).Error; err != nil {
+		r.logger.Error("Failed to record session", zap.Error(err), zap.Uint("user_id", session.UserID))
+		return err
+	}
+	return nil
+}
+
+// ListActiveForUser returns a user's unrevoked, unexpired sessions, most recently used first
+func (r *SessionRepository) ListActiveForUser(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		r.logger.Error("Failed to list sessions", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetForUser retrieves one of a user's sessions by its ID
+func (r *SessionRepository) GetForUser(ctx context.Context, userID, id uint) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get session", zap.Error(err), zap.Uint("id", id))
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetByFamilyID retrieves the session with the given family ID
+func (r *SessionRepository) GetByFamilyID(ctx context.Context, familyID string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).Where("family_id = ?", familyID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get session", zap.Error(err), zap.String("family_id", familyID))
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Revoke marks the session of a token family as revoked
+func (r *SessionRepository) Revoke(ctx context.Context, familyID string) error {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to revoke session", zap.Error(result.Error), zap.String("family_id", familyID))
+		return result.Error
+	}
+	return nil
+}
+
+// RevokeAllForUser marks every session of a user as revoked
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID uint) error {
+	result := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to revoke sessions for user", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	return nil
+}
+
+// ListRevokedSince returns sessions revoked after the given time, whose access
+// tokens may not have expired yet
+func (r *SessionRepository) ListRevokedSince(ctx context.Context, since time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := r.db.WithContext(ctx).Where("revoked_at > ?", since).Find(&sessions).Error; err != nil {
+		r.logger.Error("Failed to list revoked sessions", zap.Error(err))
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteExpired permanently removes sessions that expired before the given
+// time or were revoked before revokedBefore
+func (r *SessionRepository) DeleteExpired(ctx context.Context, before, revokedBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("expires_at < ? OR revoked_at < ?", before, revokedBefore).
+		Delete(&models.Session{})
+	if result.Error != nil {
+		r.logger.Error("Failed to delete expired sessions", zap.Error(result.Error))
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// SettingRepository provides runtime setting database operations
+type SettingRepository struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewSettingRepository creates a new setting repository
+func NewSettingRepository(db *DB) *SettingRepository {
+	return &SettingRepository{
+		db:     db.DB,
+		logger: db.logger,
+	}
+}
+
+// Get returns the value of a setting, or the fallback if it has never been set
+func (r *SettingRepository) Get(ctx context.Context, key, fallback string) (string, error) {
+	var setting models.Setting
+	if err := r.db.WithContext(ctx).Where("key = ?", key).First(&setting).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fallback, nil
+		}
+		r.logger.Error("Failed to get setting", zap.Error(err), zap.String("key", key))
+		return "", err
+	}
+	return setting.Value, nil
+}
+
+// Set creates or updates a setting
+func (r *SettingRepository) Set(ctx context.Context, key, value string) error {
+	setting := models.Setting{Key: key, Value: value}
+	if err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting).Error; err != nil {
+		r.logger.Error("Failed to set setting", zap.Error(err), zap.String("key", key))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// TwoFactorRepository provides TOTP credential and recovery code database operations
+type TwoFactorRepository struct {
+	*GormRepository[models.TOTPCredential]
+	logger *zap.Logger
+}
+
+// NewTwoFactorRepository creates a new two-factor repository
+func NewTwoFactorRepository(db *DB) *TwoFactorRepository {
+	return &TwoFactorRepository{
+		GormRepository: NewGormRepository[models.TOTPCredential](db),
+		logger:         db.logger,
+	}
+}
+
+// GetByUserID retrieves the TOTP credential of a user
+func (r *TwoFactorRepository) GetByUserID(ctx context.Context, userID uint) (*models.TOTPCredential, error) {
+	var credential models.TOTPCredential
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get TOTP credential", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// IsEnabled reports whether the user has a confirmed TOTP credential
+func (r *TwoFactorRepository) IsEnabled(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error; err != nil {
+		r.logger.Error("Failed to check TOTP status", zap.Error(err), zap.Uint("user_id", userID))
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// AdvanceStep atomically records an accepted time step. It returns false if a
+// code for the same or a later step was already accepted.
+func (r *TwoFactorRepository) AdvanceStep(ctx context.Context, credentialID uint, step int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("id = ? AND last_used_step < ?", credentialID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		r.logger.Error("Failed to record TOTP step", zap.Error(result.Error), zap.Uint("id", credentialID))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Confirm marks a credential as confirmed. Only confirmed_at is written so that
+// the step recorded by AdvanceStep for the confirmation code is kept.
+func (r *TwoFactorRepository) Confirm(ctx context.Context, credentialID uint, confirmedAt time.Time) error {
+	if err := r.db.WithContext(ctx).Model(&models.TOTPCredential{}).
+		Where("id = ?", credentialID).
+		Update("confirmed_at", confirmedAt).Error; err != nil {
+		r.logger.Error("Failed to confirm TOTP credential", zap.Error(err), zap.Uint("id", credentialID))
+		return err
+	}
+	return nil
+}
+
+// DeleteForUser permanently removes the TOTP credential and recovery codes of a user
+func (r *TwoFactorRepository) DeleteForUser(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TOTPCredential{}).Error; err != nil {
+			r.logger.Error("Failed to delete TOTP credential", zap.Error(err), zap.Uint("user_id", userID))
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			r.logger.Error("Failed to delete recovery codes", zap.Error(err), zap.Uint("user_id", userID))
+			return err
+		}
+		return nil
+	})
+}
+
+// ReplaceRecoveryCodes swaps all recovery codes of a user for the given hashes
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			r.logger.Error("Failed to delete recovery codes", zap.Error(err), zap.Uint("user_id", userID))
+			return err
+		}
+
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			r.logger.Error("Failed to create recovery codes", zap.Error(err), zap.Uint("user_id", userID))
+			return err
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode atomically consumes an unused recovery code. It returns
+// false if no matching unused code exists.
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		r.logger.Error("Failed to use recovery code", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes a user has left
+func (r *TwoFactorRepository) CountUnusedRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error; err != nil {
+		r.logger.Error("Failed to count recovery codes", zap.Error(err), zap.Uint("user_id", userID))
+		return 0, err
+	}
+	return count, nil
+}
@@ -3,10 +3,12 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/shashank/home-server/common/models"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository provides user-specific database operations
@@ -46,12 +48,28 @@ func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, e
 	return count > 0, nil
 }
 
-// GetUsersByRole retrieves users by role with pagination
+// GetUsersByRole retrieves users that have the named role with pagination
 func (r *UserRepository) GetUsersByRole(ctx context.Context, role string, page, pageSize int) ([]models.User, int64, error) {
-	conditions := map[string]interface{}{
-		"role": role,
+	var users []models.User
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.User{}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", role)
+
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.Error("Failed to count users by role", zap.Error(err), zap.String("role", role))
+		return nil, 0, err
 	}
-	return r.Paginate(ctx, page, pageSize, conditions)
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
+		r.logger.Error("Failed to get users by role", zap.Error(err), zap.String("role", role))
+		return nil, 0, err
+	}
+
+	return users, total, nil
 }
 
 // UpdatePassword updates a user's password
@@ -67,6 +85,19 @@ func (r *UserRepository) UpdatePassword(ctx context.Context, userID uint, hashed
 	return nil
 }
 
+// ReplacePasswordHash swaps a user's password hash only if it is still oldHash.
+// It returns false if the password was changed in the meantime.
+func (r *UserRepository) ReplacePasswordHash(ctx context.Context, userID uint, oldHash, newHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND password = ?", userID, oldHash).
+		Update("password", newHash)
+	if result.Error != nil {
+		r.logger.Error("Failed to replace password hash", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 // SearchUsers searches users by name or email
 func (r *UserRepository) SearchUsers(ctx context.Context, searchTerm string, page, pageSize int) ([]models.User, int64, error) {
 	var users []models.User
@@ -147,3 +178,209 @@ func (r *UserRepository) CreateUserIfNotExists(ctx context.Context, user *models
 
 	return user, nil
 }
+
+// IncrementTokenVersion bumps a user's token version and returns the new value
+func (r *UserRepository) IncrementTokenVersion(ctx context.Context, userID uint) (int, error) {
+	var user models.User
+	result := r.db.WithContext(ctx).Unscoped().Model(&user).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "token_version"}}}).
+		Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1"))
+	if result.Error != nil {
+		r.logger.Error("Failed to increment token version", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, fmt.Errorf("user with ID %d not found", userID)
+	}
+	return user.TokenVersion, nil
+}
+
+// GetTokenVersions returns the token version of every user that has revoked tokens
+func (r *UserRepository) GetTokenVersions(ctx context.Context) (map[uint]int, error) {
+	var rows []struct {
+		ID           uint
+		TokenVersion int
+	}
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Select("id", "token_version").
+		Where("token_version > 0").
+		Scan(&rows).Error; err != nil {
+		r.logger.Error("Failed to get token versions", zap.Error(err))
+		return nil, err
+	}
+
+	versions := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		versions[row.ID] = row.TokenVersion
+	}
+	return versions, nil
+}
+
+// UpdateProfile writes only the profile columns of a user, leaving security
+// fields such as the password, roles, verification state and token version untouched
+func (r *UserRepository) UpdateProfile(ctx context.Context, user *models.User) error {
+	result := r.db.WithContext(ctx).Model(user).Select("name", "email").Updates(user)
+	if result.Error != nil {
+		r.logger.Error("Failed to update user profile", zap.Error(result.Error), zap.Uint("user_id", user.ID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with ID %d not found", user.ID)
+	}
+	return nil
+}
+
+// UpdateFieldsIfUnmodified writes the given columns only if the user's updated_at
+// still equals updatedAt, so that concurrent edits cannot overwrite each other.
+// It returns false when the user was changed or deleted in the meantime.
+func (r *UserRepository) UpdateFieldsIfUnmodified(ctx context.Context, userID uint, updatedAt time.Time, fields map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND updated_at = ?", userID, updatedAt).
+		Updates(fields)
+	if result.Error != nil {
+		r.logger.Error("Failed to update user", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UpdateEmail sets a user's email address and when it was verified
+func (r *UserRepository) UpdateEmail(ctx context.Context, userID uint, email string, verifiedAt time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"email":             email,
+		"email_verified_at": verifiedAt,
+		"updated_at":        verifiedAt,
+	})
+	if result.Error != nil {
+		r.logger.Error("Failed to update user email", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with ID %d not found", userID)
+	}
+	return nil
+}
+
+// ClaimLoginAttempt counts a login attempt as failed before its password is
+// checked, locking the account for lockDuration once threshold consecutive
+// failures are reached. The counter is only incremented if it still equals
+// seenAttempts, so that the throttle checked against it holds under concurrent
+// attempts; false is returned if another attempt changed it first. The
+// updated counters are returned. Columns are updated without touching
+// updated_at, which guards profile edits.
+func (r *UserRepository) ClaimLoginAttempt(ctx context.Context, userID uint, seenAttempts, threshold int, lockDuration time.Duration) (*models.User, bool, error) {
+	now := time.Now().UTC()
+	var user models.User
+	result := r.db.WithContext(ctx).Model(&user).
+		Clauses(clause.Returning{Columns: []clause.Column{
+			{Name: "failed_login_attempts"}, {Name: "last_failed_login_at"}, {Name: "locked_until"},
+		}}).
+		Where("id = ? AND failed_login_attempts = ?", userID, seenAttempts).
+		UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+			"last_failed_login_at":  now,
+			"locked_until": gorm.Expr("CASE WHEN failed_login_attempts + 1 >= ? THEN ?::timestamptz ELSE locked_until END",
+				threshold, now.Add(lockDuration)),
+		})
+	if result.Error != nil {
+		r.logger.Error("Failed to claim login attempt", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, nil
+	}
+	return &user, true, nil
+}
+
+// ClearFailedLogins resets a user's failed login counter and removes any lockout
+func (r *UserRepository) ClearFailedLogins(ctx context.Context, userID uint) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumns(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"last_failed_login_at":  nil,
+			"locked_until":          nil,
+		})
+	if result.Error != nil {
+		r.logger.Error("Failed to clear failed logins", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with ID %d not found", userID)
+	}
+	return nil
+}
+
+// GetLockedUsers returns users whose accounts are locked at the given time
+func (r *UserRepository) GetLockedUsers(ctx context.Context, now time.Time) ([]models.User, error) {
+	var users []models.User
+	if err := r.db.WithContext(ctx).Where("locked_until > ?", now).Order("locked_until DESC").Find(&users).Error; err != nil {
+		r.logger.Error("Failed to get locked users", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetByIDUnscoped retrieves a user by ID, including soft deleted users
+func (r *UserRepository) GetByIDUnscoped(ctx context.Context, userID uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Unscoped().First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get user by ID", zap.Error(err), zap.Uint("user_id", userID))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmailUnscoped retrieves a user by email, including soft deleted users
+func (r *UserRepository) GetByEmailUnscoped(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Unscoped().Where("email = ?", email).Order("deleted_at IS NOT NULL, id DESC").First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.logger.Error("Failed to get user by email", zap.Error(err), zap.String("email", email))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetDisabled enables or disables a user's account
+func (r *UserRepository) SetDisabled(ctx context.Context, userID uint, disabled bool) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("disabled", disabled)
+	if result.Error != nil {
+		r.logger.Error("Failed to update disabled flag", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with ID %d not found", userID)
+	}
+	return nil
+}
+
+// SetMagicLink allows or stops a user signing in with emailed links
+func (r *UserRepository) SetMagicLink(ctx context.Context, userID uint, enabled bool) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("magic_link", enabled)
+	if result.Error != nil {
+		r.logger.Error("Failed to update magic link flag", zap.Error(result.Error), zap.Uint("user_id", userID))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with ID %d not found", userID)
+	}
+	return nil
+}
+
+// EmailInUse checks if any user, including soft deleted ones, holds the email.
+// Soft deleted users keep their row and therefore the unique index entry.
+func (r *UserRepository) EmailInUse(ctx context.Context, email string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		r.logger.Error("Failed to check if email is in use", zap.Error(err), zap.String("email", email))
+		return false, err
+	}
+	return count > 0, nil
+}
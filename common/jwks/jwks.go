@@ -0,0 +1,239 @@
+// Package jwks describes token signing keys as JSON Web Keys and verifies
+// tokens against a key set, pinning every key ID to a single algorithm.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+// Errors returned while verifying tokens
+var (
+	ErrUnknownKey        = errors.New("token signed with an unknown key")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match its key")
+)
+
+// Key is a public signing key in JWK format (RFC 7517)
+type Key struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// Set is a JSON Web Key Set as served at a JWKS endpoint
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// Algorithm returns the signing algorithm used with a public key
+func Algorithm(public crypto.PublicKey) (string, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return RS256, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return "", errors.New("only P-256 ECDSA keys are supported")
+		}
+		return ES256, nil
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// SigningMethod returns the JWT signing method for an algorithm
+func SigningMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case RS256:
+		return jwt.SigningMethodRS256, nil
+	case ES256:
+		return jwt.SigningMethodES256, nil
+	case EdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+// NewKey describes a public key as a JWK. The key ID is its RFC 7638 thumbprint.
+func NewKey(public crypto.PublicKey) (Key, error) {
+	algorithm, err := Algorithm(public)
+	if err != nil {
+		return Key{}, err
+	}
+
+	key := Key{Use: "sig", Algorithm: algorithm}
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		key.KeyType = "RSA"
+		key.Modulus = encode(public.N.Bytes())
+		key.Exponent = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		key.KeyType = "EC"
+		key.Curve = "P-256"
+		key.X = encode(public.X.FillBytes(make([]byte, 32)))
+		key.Y = encode(public.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		key.KeyType = "OKP"
+		key.Curve = "Ed25519"
+		key.X = encode(public)
+	}
+	key.KeyID = key.Thumbprint()
+	return key, nil
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of the key: the SHA-256 of its
+// required members in lexicographic order
+func (k Key) Thumbprint() string {
+	var input string
+	switch k.KeyType {
+	case "RSA":
+		input = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, k.Exponent, k.Modulus)
+	case "EC":
+		input = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, k.Curve, k.X, k.Y)
+	default:
+		input = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, k.Curve, k.KeyType, k.X)
+	}
+	sum := sha256.Sum256([]byte(input))
+	return encode(sum[:])
+}
+
+// PublicKey decodes the key, checking that it matches its declared algorithm
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	var public crypto.PublicKey
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.Modulus)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeInt(k.Exponent)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		public = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		public = ed25519.PublicKey(x)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+
+	if algorithm, _ := Algorithm(public); algorithm != k.Algorithm {
+		return nil, fmt.Errorf("key type %s cannot be used with %s", k.KeyType, k.Algorithm)
+	}
+	return public, nil
+}
+
+// verificationKey is a public key and the only algorithm accepted with it
+type verificationKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// Verifier picks the key for a token by its key ID
+type Verifier struct {
+	keys map[string]verificationKey
+	// legacy verifies RS256 tokens issued before tokens carried a key ID
+	legacy *verificationKey
+}
+
+// NewVerifier creates a Verifier for every key in the set
+func NewVerifier(set Set) (*Verifier, error) {
+	v := &Verifier{keys: make(map[string]verificationKey, len(set.Keys))}
+	for _, key := range set.Keys {
+		public, err := key.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.KeyID, err)
+		}
+		entry := verificationKey{algorithm: key.Algorithm, public: public}
+		v.keys[key.KeyID] = entry
+		if v.legacy == nil && key.Algorithm == RS256 {
+			v.legacy = &entry
+		}
+	}
+	return v, nil
+}
+
+// Keyfunc returns the key named by a token's "kid" header for jwt.Parse. The
+// token's "alg" must be the algorithm the key is pinned to, so a key can never
+// be used with another algorithm.
+func (v *Verifier) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var key verificationKey
+	switch entry, ok := v.keys[kid]; {
+	case ok:
+		key = entry
+	case kid == "" && v.legacy != nil:
+		key = *v.legacy
+	default:
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.algorithm {
+		return nil, fmt.Errorf("%w: got %v, want %s", ErrAlgorithmMismatch, token.Header["alg"], key.algorithm)
+	}
+	return key.public, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,112 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testKeys returns one private key per supported algorithm
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return map[string]crypto.Signer{RS256: rsaKey, ES256: ecKey, EdDSA: edKey}
+}
+
+func sign(t *testing.T, algorithm string, private crypto.Signer, kid string) string {
+	t.Helper()
+	method, err := SigningMethod(algorithm)
+	if err != nil {
+		t.Fatalf("SigningMethod(%s) error: %v", algorithm, err)
+	}
+	token := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "42"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(private)
+	if err != nil {
+		t.Fatalf("failed to sign %s token: %v", algorithm, err)
+	}
+	return signed
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	for algorithm, private := range testKeys(t) {
+		key, err := NewKey(private.Public())
+		if err != nil {
+			t.Fatalf("NewKey(%s) error: %v", algorithm, err)
+		}
+		if key.Algorithm != algorithm || key.KeyID == "" {
+			t.Errorf("NewKey(%s) = %+v", algorithm, key)
+		}
+
+		public, err := key.PublicKey()
+		if err != nil {
+			t.Fatalf("PublicKey(%s) error: %v", algorithm, err)
+		}
+		if !public.(interface{ Equal(crypto.PublicKey) bool }).Equal(private.Public()) {
+			t.Errorf("%s key did not survive the round trip", algorithm)
+		}
+	}
+}
+
+func TestVerifierPinsAlgorithmPerKey(t *testing.T) {
+	keys := testKeys(t)
+	var set Set
+	ids := map[string]string{}
+	for algorithm, private := range keys {
+		key, err := NewKey(private.Public())
+		if err != nil {
+			t.Fatalf("NewKey(%s) error: %v", algorithm, err)
+		}
+		set.Keys = append(set.Keys, key)
+		ids[algorithm] = key.KeyID
+	}
+	verifier, err := NewVerifier(set)
+	if err != nil {
+		t.Fatalf("NewVerifier() error: %v", err)
+	}
+
+	for algorithm, private := range keys {
+		signed := sign(t, algorithm, private, ids[algorithm])
+		if _, err := jwt.Parse(signed, verifier.Keyfunc); err != nil {
+			t.Errorf("%s token rejected: %v", algorithm, err)
+		}
+	}
+
+	// A token without a key ID predates key IDs and may only be RS256
+	if _, err := jwt.Parse(sign(t, RS256, keys[RS256], ""), verifier.Keyfunc); err != nil {
+		t.Errorf("legacy RS256 token rejected: %v", err)
+	}
+	if _, err := jwt.Parse(sign(t, EdDSA, keys[EdDSA], ""), verifier.Keyfunc); err == nil {
+		t.Error("EdDSA token without a key ID was accepted")
+	}
+
+	// The Ed25519 key must not verify a token that claims to be ES256
+	forged := sign(t, ES256, keys[ES256], ids[EdDSA])
+	if _, err := jwt.Parse(forged, verifier.Keyfunc); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Errorf("algorithm mismatch error = %v, want ErrAlgorithmMismatch", err)
+	}
+
+	if _, err := jwt.Parse(sign(t, EdDSA, keys[EdDSA], "unknown"), verifier.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key error = %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,173 @@
+package jwks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// remoteCacheDuration is how long a fetched key set is used before it is fetched again
+	remoteCacheDuration = time.Hour
+	// remoteMinRefresh limits how often a token with an unknown key ID can cause
+	// another fetch, so forged key IDs cannot flood the key server
+	remoteMinRefresh = 30 * time.Second
+	// remoteMinBackoff and remoteMaxBackoff bound the wait after a failed fetch.
+	// The wait doubles with each failure in a row.
+	remoteMinBackoff = 2 * time.Second
+	remoteMaxBackoff = 2 * time.Minute
+)
+
+// Remote is a key set fetched from a JWKS URL and cached. When a token names a
+// key that is not in the cached set, the set is fetched again in case the
+// issuer has started signing with a new key.
+//
+// Fetches happen outside the lock and concurrent callers share one fetch. When
+// a fetch fails the previous key set keeps being used, even past its expiry, so
+// tokens still verify while the issuer is unreachable; further fetches wait for
+// a growing backoff.
+type Remote struct {
+	url    string
+	client *http.Client
+	group  singleflight.Group
+
+	mu        sync.RWMutex
+	verifier  *Verifier
+	expiry    time.Time
+	lastFetch time.Time
+	failures  int
+	retryAt   time.Time
+	lastErr   error
+}
+
+// NewRemote creates a Remote for a JWKS URL. Nothing is fetched until the first token is verified.
+func NewRemote(url string) *Remote {
+	return &Remote{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Keyfunc returns the key for a token for jwt.Parse, like Verifier.Keyfunc
+func (r *Remote) Keyfunc(token *jwt.Token) (interface{}, error) {
+	verifier, err := r.get(false)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := verifier.Keyfunc(token)
+	if errors.Is(err, ErrUnknownKey) {
+		if verifier, err = r.get(true); err != nil {
+			return nil, err
+		}
+		return verifier.Keyfunc(token)
+	}
+	return key, err
+}
+
+// get returns the cached verifier, fetching the key set when it is missing or
+// expired. A forced refresh is skipped if the keys were fetched very recently.
+// If the fetch fails, or the last one failed and the backoff has not passed,
+// the cached verifier is returned as long as there is one.
+func (r *Remote) get(forceRefresh bool) (*Verifier, error) {
+	now := time.Now()
+
+	r.mu.RLock()
+	verifier := r.verifier
+	fresh := verifier != nil && now.Before(r.expiry) &&
+		(!forceRefresh || now.Sub(r.lastFetch) < remoteMinRefresh)
+	backingOff := now.Before(r.retryAt)
+	lastErr := r.lastErr
+	r.mu.RUnlock()
+
+	if fresh {
+		return verifier, nil
+	}
+	if backingOff {
+		if verifier != nil {
+			return verifier, nil
+		}
+		return nil, lastErr
+	}
+
+	result, err, _ := r.group.Do("", func() (interface{}, error) {
+		return r.refresh()
+	})
+	if err != nil {
+		if verifier != nil {
+			return verifier, nil
+		}
+		return nil, err
+	}
+	return result.(*Verifier), nil
+}
+
+// refresh fetches the key set and replaces the cached verifier. On failure the
+// cached verifier is kept and the next fetch is delayed.
+func (r *Remote) refresh() (*Verifier, error) {
+	r.mu.Lock()
+	r.lastFetch = time.Now()
+	r.mu.Unlock()
+
+	verifier, err := r.load()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		backoff := remoteMaxBackoff
+		if r.failures < 8 {
+			backoff = min(remoteMinBackoff<<r.failures, remoteMaxBackoff)
+		}
+		r.failures++
+		r.retryAt = time.Now().Add(backoff)
+		r.lastErr = err
+		return nil, err
+	}
+
+	r.verifier = verifier
+	r.expiry = time.Now().Add(remoteCacheDuration)
+	r.failures = 0
+	r.retryAt = time.Time{}
+	r.lastErr = nil
+	return verifier, nil
+}
+
+// load fetches the key set and builds a verifier from it
+func (r *Remote) load() (*Verifier, error) {
+	set, err := r.fetch()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := NewVerifier(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing keys: %w", err)
+	}
+	return verifier, nil
+}
+
+// fetch downloads the key set
+func (r *Remote) fetch() (Set, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return Set{}, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return Set{}, fmt.Errorf("failed to fetch signing keys: %s: %s", resp.Status, string(body))
+	}
+
+	var set Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return Set{}, fmt.Errorf("failed to parse signing keys: %w", err)
+	}
+	return set, nil
+}
@@ -0,0 +1,207 @@
+package jwks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRemoteRefetchesForUnknownKey(t *testing.T) {
+	keys := testKeys(t)
+	oldKey, err := NewKey(keys[RS256].Public())
+	if err != nil {
+		t.Fatalf("NewKey() error: %v", err)
+	}
+	newKey, err := NewKey(keys[EdDSA].Public())
+	if err != nil {
+		t.Fatalf("NewKey() error: %v", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		served  = Set{Keys: []Key{oldKey}}
+		fetches int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		_ = json.NewEncoder(w).Encode(served)
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL)
+	if _, err := jwt.Parse(sign(t, RS256, keys[RS256], oldKey.KeyID), remote.Keyfunc); err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+
+	// The issuer starts signing with a new key; it is only picked up once the
+	// minimum refresh interval has passed
+	mu.Lock()
+	served.Keys = append(served.Keys, newKey)
+	mu.Unlock()
+	rotated := sign(t, EdDSA, keys[EdDSA], newKey.KeyID)
+	if _, err := jwt.Parse(rotated, remote.Keyfunc); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey right after a fetch, got %v", err)
+	}
+
+	remote.mu.Lock()
+	remote.lastFetch = time.Now().Add(-remoteMinRefresh)
+	remote.mu.Unlock()
+	if _, err := jwt.Parse(rotated, remote.Keyfunc); err != nil {
+		t.Fatalf("token with new key rejected: %v", err)
+	}
+
+	// Known keys are served from the cache
+	if _, err := jwt.Parse(rotated, remote.Keyfunc); err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("key set fetched %d times, want 2", fetches)
+	}
+}
+
+func TestRemoteKeepsKeysWhileIssuerIsDown(t *testing.T) {
+	keys := testKeys(t)
+	key, err := NewKey(keys[RS256].Public())
+	if err != nil {
+		t.Fatalf("NewKey() error: %v", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		down    bool
+		fetches int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Set{Keys: []Key{key}})
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL)
+	token := sign(t, RS256, keys[RS256], key.KeyID)
+	if _, err := jwt.Parse(token, remote.Keyfunc); err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+
+	// The cached keys expire while the issuer is unreachable
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	remote.mu.Lock()
+	remote.expiry = time.Now().Add(-time.Second)
+	remote.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		if _, err := jwt.Parse(token, remote.Keyfunc); err != nil {
+			t.Fatalf("token rejected while the issuer is down: %v", err)
+		}
+	}
+	mu.Lock()
+	if fetches != 2 {
+		t.Errorf("key set fetched %d times, want 2 (no retries during the backoff)", fetches)
+	}
+	mu.Unlock()
+
+	// Once the backoff has passed and the issuer is back, the keys are refreshed
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	remote.mu.Lock()
+	remote.retryAt = time.Now().Add(-time.Second)
+	remote.mu.Unlock()
+	if _, err := jwt.Parse(token, remote.Keyfunc); err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	remote.mu.RLock()
+	defer remote.mu.RUnlock()
+	if !remote.expiry.After(time.Now()) || remote.failures != 0 {
+		t.Errorf("key set not refreshed after the issuer came back")
+	}
+}
+
+func TestRemoteWithoutKeysBacksOff(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetches int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL)
+	for i := 0; i < 3; i++ {
+		if _, err := remote.get(false); err == nil {
+			t.Fatal("expected an error without any keys")
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("key set fetched %d times, want 1", fetches)
+	}
+}
+
+func TestRemoteSharesConcurrentFetches(t *testing.T) {
+	keys := testKeys(t)
+	key, err := NewKey(keys[RS256].Public())
+	if err != nil {
+		t.Fatalf("NewKey() error: %v", err)
+	}
+
+	var (
+		mu      sync.Mutex
+		fetches int
+	)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		<-release
+		_ = json.NewEncoder(w).Encode(Set{Keys: []Key{key}})
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL)
+	token := sign(t, RS256, keys[RS256], key.KeyID)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jwt.Parse(token, remote.Keyfunc)
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("token rejected: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("key set fetched %d times, want 1", fetches)
+	}
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg := Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "Hello\nClick the link",
+	}
+
+	raw := string(buildMessage("Home Server <noreply@example.com>", msg, time.Now()))
+
+	for _, header := range []string{
+		"From: Home Server <noreply@example.com>\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Verify your email\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n",
+	} {
+		if !strings.Contains(raw, header) {
+			t.Errorf("Expected message to contain %q", header)
+		}
+	}
+
+	if !strings.Contains(raw, "@example.com>\r\n") {
+		t.Error("Expected Message-ID to use the sender domain")
+	}
+	if !strings.HasSuffix(raw, "\r\n\r\nHello\r\nClick the link") {
+		t.Errorf("Expected CRLF normalised body, got %q", raw)
+	}
+}
@@ -119,6 +119,7 @@ func RequestLoggingMiddleware() gin.HandlerFunc {
 				zap.Duration("latency", param.Latency),
 				zap.String("ip", param.ClientIP),
 				zap.String("user_agent", param.Request.UserAgent()),
+				zap.String("request_id", param.Request.Header.Get("X-Request-ID")),
 				zap.String("service", config.AppConfig.Service.Name),
 			)
 			return ""
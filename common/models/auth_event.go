@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Authentication event types recorded in the audit log
+const (
+	AuthEventLogin              = "login"               // email and password checked
+	AuthEventLogin2FA           = "login_2fa"           // second factor checked after the password
+	AuthEventPasskeyLogin       = "passkey_login"       // signed in with a passkey
+	AuthEventExternalLogin      = "external_login"      // signed in through an upstream provider
+	AuthEventTokenRefresh       = "token_refresh"       // refresh token rotated
+	AuthEventLogout             = "logout"              // session ended by its user
+	AuthEventPasswordChange     = "password_change"     // password changed by its user
+	AuthEventPasswordReset      = "password_reset"      // password set with a reset link
+	AuthEventProfileUpdate      = "profile_update"      // name changed or email change requested by its user
+	AuthEventEmailChange        = "email_change"        // new email address confirmed
+	AuthEventSessionRevoked     = "session_revoked"     // one session signed out from another device or by an admin
+	AuthEventSessionsRevoked    = "sessions_revoked"    // every session of a user signed out
+	AuthEventInviteRedeemed     = "invite_redeemed"     // account created with an invitation code
+	AuthEventImpersonationStart = "impersonation_start" // admin started acting as the user
+	AuthEventImpersonationEnd   = "impersonation_end"   // admin stopped acting as the user
+	AuthEventAdminBootstrap     = "admin_bootstrap"     // first admin created on a fresh install
+	AuthEventMagicLinkLogin     = "magic_link_login"    // signed in with an emailed link
+	AuthEventTwoFactorDisabled  = "two_factor_disabled" // 2FA turned off by its user
+	AuthEventTwoFactorReset     = "two_factor_reset"    // 2FA removed by an admin
+)
+
+// Outcomes of an authentication event
+const (
+	AuthOutcomeSuccess = "success"
+	AuthOutcomeFailure = "failure"
+)
+
+// AuthEvent is an entry in the authentication audit log. Entries are never
+// updated and are pruned once older than the configured retention.
+type AuthEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index;not null"`
+	Type      string    `json:"type" gorm:"size:50;index;not null"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"index"`  // nil when the user is unknown, e.g. a login with an unknown email
+	ActorID   *uint     `json:"actor_id,omitempty" gorm:"index"` // admin who caused the event, e.g. while impersonating the user
+	Email     string    `json:"email,omitempty" gorm:"size:255"` // email given in a login attempt
+	IPAddress string    `json:"ip_address" gorm:"size:64"`
+	UserAgent string    `json:"user_agent" gorm:"size:512"`
+	Outcome   string    `json:"outcome" gorm:"size:20;not null"`
+	Reason    string    `json:"reason,omitempty" gorm:"size:255"` // why a failure happened, or extra detail
+	RequestID string    `json:"request_id,omitempty" gorm:"size:64;index"`
+}
+
+// TableName returns the table name for AuthEvent model
+func (AuthEvent) TableName() string {
+	return "auth_events"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExternalIdentity links an account at an upstream OpenID Connect provider to
+// a local user. Subject is the provider's stable "sub" claim for the account.
+type ExternalIdentity struct {
+	BaseModel
+	UserID      uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_external_identities_user_provider"`
+	Provider    string     `json:"provider" gorm:"size:64;not null;uniqueIndex:idx_external_identities_user_provider;uniqueIndex:idx_external_identities_subject"`
+	Subject     string     `json:"-" gorm:"size:255;not null;uniqueIndex:idx_external_identities_subject"`
+	Email       string     `json:"email" gorm:"size:255"` // email reported by the provider at the last sign in
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// TableName returns the table name for ExternalIdentity model
+func (ExternalIdentity) TableName() string {
+	return "external_identities"
+}
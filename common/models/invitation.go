@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// Invitation statuses reported to admins
+const (
+	InvitationStatusActive  = "active"
+	InvitationStatusUsed    = "used"
+	InvitationStatusExpired = "expired"
+	InvitationStatusRevoked = "revoked"
+)
+
+// Invitation lets people create an account with a preassigned role. It is
+// delivered as a link or a short code; only the SHA-256 hash of the code is stored.
+type Invitation struct {
+	BaseModel
+	Email     string     `json:"email,omitempty" gorm:"size:255"` // only this address may redeem it; empty allows any
+	RoleID    uint       `json:"-" gorm:"not null"`
+	Role      Role       `json:"-"`
+	CodeHash  string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	MaxUses   int        `json:"max_uses" gorm:"not null"`
+	Uses      int        `json:"uses" gorm:"not null;default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index;not null"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy uint       `json:"created_by"` // admin that created the invitation
+}
+
+// TableName returns the table name for Invitation model
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// Status reports whether the invitation can still be redeemed, and if not, why
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case i.Uses >= i.MaxUses:
+		return InvitationStatusUsed
+	case !now.Before(i.ExpiresAt):
+		return InvitationStatusExpired
+	default:
+		return InvitationStatusActive
+	}
+}
+
+// IsUsable reports whether the invitation can be redeemed
+func (i *Invitation) IsUsable(now time.Time) bool {
+	return i.Status(now) == InvitationStatusActive
+}
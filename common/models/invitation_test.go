@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvitationStatus(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name       string
+		invitation Invitation
+		want       string
+	}{
+		{"active", Invitation{MaxUses: 3, Uses: 2, ExpiresAt: now.Add(time.Hour)}, InvitationStatusActive},
+		{"used up", Invitation{MaxUses: 3, Uses: 3, ExpiresAt: now.Add(time.Hour)}, InvitationStatusUsed},
+		{"expired", Invitation{MaxUses: 1, ExpiresAt: now.Add(-time.Hour)}, InvitationStatusExpired},
+		{"revoked", Invitation{MaxUses: 1, ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, InvitationStatusRevoked},
+	}
+
+	for _, tt := range tests {
+		if got := tt.invitation.Status(now); got != tt.want {
+			t.Errorf("%s: Status() = %q, want %q", tt.name, got, tt.want)
+		}
+		if usable := tt.invitation.IsUsable(now); usable != (tt.want == InvitationStatusActive) {
+			t.Errorf("%s: IsUsable() = %v", tt.name, usable)
+		}
+	}
+}
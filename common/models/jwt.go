@@ -1,25 +1,100 @@
 package models
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 // JWTClaims represents the custom claims for JWT tokens
 type JWTClaims struct {
-	UserID  string `json:"user_id"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
-	Type    string `json:"type"` // "access" or "refresh"
+	UserID      string   `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles,omitempty"`       // names of the user's roles
+	Permissions []string `json:"permissions,omitempty"` // permissions granted by those roles
+	Type        string   `json:"type"`                  // "access" or "refresh"
+	Session     string   `json:"sid,omitempty"`         // refresh token family the token was issued for
+	Version     int      `json:"ver"`                   // user's token version at issue time
+	ClientID    string   `json:"client_id,omitempty"`   // OIDC client or service account a token was issued to
+	Scope       string   `json:"scope,omitempty"`       // space separated scopes granted to that client
+	Actor       *Actor   `json:"act,omitempty"`         // admin acting as the user, set on impersonation tokens
 	jwt.RegisteredClaims
 }
 
+// Actor identifies who is really using a token issued for another user (RFC 8693 "act" claim)
+type Actor struct {
+	Subject string `json:"sub"`             // ID of the admin impersonating the user
+	Email   string `json:"email,omitempty"` // the admin's email, for logs
+	Session string `json:"sid,omitempty"`   // the admin's session the impersonation was started from
+	Version int    `json:"ver"`             // the admin's token version at issue time
+}
+
+// IsImpersonation reports whether the token was issued to an admin acting as the user
+func (c *JWTClaims) IsImpersonation() bool {
+	return c.Actor != nil
+}
+
+// HasRole reports whether the token carries the named role
+func (c *JWTClaims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the token grants the named permission
+func (c *JWTClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was granted the named scope
+func (c *JWTClaims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the token carries the admin role
+func (c *JWTClaims) IsAdmin() bool {
+	return c.HasRole(RoleAdmin)
+}
+
 // TokenType constants
 const (
-	TokenTypeAccess  = "access"
-	TokenTypeRefresh = "refresh"
+	TokenTypeAccess      = "access"
+	TokenTypeRefresh     = "refresh"
+	TokenTypeOIDCAccess  = "oidc_access"  // access token issued to an OIDC client
+	TokenTypeOIDCSession = "oidc_session" // the provider's browser login cookie
+	TokenTypeService     = "service"      // access token issued to a service account
+	TokenTypeForward     = "forward"      // forward-auth login cookie for apps behind the proxy
 )
 
+// IDTokenClaims are the claims of an OpenID Connect ID token
+type IDTokenClaims struct {
+	Nonce         string   `json:"nonce,omitempty"`
+	AuthTime      int64    `json:"auth_time,omitempty"`
+	AccessHash    string   `json:"at_hash,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified *bool    `json:"email_verified,omitempty"`
+	Name          string   `json:"name,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
 // PublicKeyResponse represents the response structure for public key endpoint
 type PublicKeyResponse struct {
 	PublicKey string `json:"public_key"`
 	Algorithm string `json:"algorithm"`
 	KeyType   string `json:"key_type"`
+	KeyID     string `json:"key_id"`
 }
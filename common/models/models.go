@@ -19,8 +19,25 @@ type User struct {
 	BaseModel
 	Email    string `json:"email" gorm:"uniqueIndex;not null"`
 	Name     string `json:"name" gorm:"not null"`
-	Password string `json:"-" gorm:"not null"` // omit in JSON
-	IsAdmin  bool   `json:"is_admin" gorm:"default:false"`
+	Password string `json:"-" gorm:"not null"`             // omit in JSON
+	Disabled bool   `json:"disabled" gorm:"default:false"` // disabled users cannot log in or refresh tokens
+
+	// MagicLink lets the user sign in with an emailed link, whatever their roles allow
+	MagicLink bool `json:"magic_link" gorm:"not null;default:false"`
+
+	// EmailVerifiedAt is nil until the user confirms their address; unverified users cannot log in
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// Roles grant the user's permissions; loaded explicitly where needed
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles"`
+
+	// TokenVersion is embedded in access tokens; bumping it revokes all of them
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+
+	// Failed password logins since the last success, used for throttling and lockout
+	FailedLoginAttempts int        `json:"-" gorm:"not null;default:0"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"-" gorm:"index"`
 }
 
 // TableName returns the table name for User model
@@ -28,6 +45,26 @@ func (User) TableName() string {
 	return "users"
 }
 
+// IsEmailVerified reports whether the user has confirmed their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsLocked reports whether the account is temporarily locked after failed logins
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// HasRole reports whether the user's loaded roles include the named role
+func (u *User) HasRole(name string) bool {
+	for _, role := range u.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // BeforeCreate hook for User model
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	// Add any pre-creation logic here
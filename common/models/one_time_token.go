@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// One-time token purposes
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+	TokenPurposePasskeyRegister   = "passkey_registration"
+	TokenPurposePasskeyLogin      = "passkey_login"
+	TokenPurposeOIDCCode          = "oidc_code"
+	TokenPurposeExternalLogin     = "external_login"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+// OneTimeToken is a single-use, time-limited token delivered out of band,
+// for example in an email link. Only the SHA-256 hash of the value is stored.
+type OneTimeToken struct {
+	BaseModel
+	Purpose   string     `json:"purpose" gorm:"size:32;index;not null"`
+	UserID    uint       `json:"user_id" gorm:"index"`  // user the token acts on, if any
+	Email     string     `json:"email" gorm:"size:255"` // address the token was sent to
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index;not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	Payload   string     `json:"-" gorm:"type:text"` // server-side state bound to the token, e.g. a WebAuthn session
+}
+
+// TableName returns the table name for OneTimeToken model
+func (OneTimeToken) TableName() string {
+	return "one_time_tokens"
+}
+
+// IsUsable reports whether the token is unused and unexpired
+func (t *OneTimeToken) IsUsable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// PasskeyCredential is a WebAuthn public key credential registered by a user.
+// CredentialID is the base64url encoded credential ID chosen by the authenticator.
+type PasskeyCredential struct {
+	BaseModel
+	UserID          uint       `json:"user_id" gorm:"index;not null"`
+	Name            string     `json:"name" gorm:"size:100"`
+	CredentialID    string     `json:"-" gorm:"size:1024;uniqueIndex;not null"`
+	PublicKey       []byte     `json:"-" gorm:"not null"`
+	AttestationType string     `json:"-" gorm:"size:32"`
+	Transports      string     `json:"transports" gorm:"size:255"` // comma separated authenticator transports
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-" gorm:"not null;default:0"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backup_state"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+// TableName returns the table name for PasskeyCredential model
+func (PasskeyCredential) TableName() string {
+	return "passkey_credentials"
+}
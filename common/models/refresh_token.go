@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// RefreshToken is a server-side record of an issued refresh token.
+// Only the SHA-256 hash of the opaque token value is stored. Tokens that are
+// rotated from one another share a FamilyID so that reuse of an already
+// rotated token can revoke the whole chain.
+type RefreshToken struct {
+	BaseModel
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID  string     `json:"family_id" gorm:"size:64;index;not null"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ClientID  string     `json:"client_id,omitempty" gorm:"size:64;index"` // OIDC client the token was issued to; empty for first-party logins
+	Scope     string     `json:"scope,omitempty" gorm:"size:255"`          // scopes granted to the client
+}
+
+// TableName returns the table name for RefreshToken model
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// IsExpired reports whether the token is past its expiry time
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
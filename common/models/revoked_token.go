@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RevokedToken records an access token that was revoked before its expiry,
+// identified by its JWT ID. Rows can be pruned once ExpiresAt has passed.
+type RevokedToken struct {
+	BaseModel
+	JTI       string    `json:"jti" gorm:"size:64;uniqueIndex;not null"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+}
+
+// TableName returns the table name for RevokedToken model
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
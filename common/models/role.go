@@ -0,0 +1,91 @@
+package models
+
+// Built-in role names
+const (
+	RoleAdmin  = "admin"
+	RoleFamily = "family"
+	RoleGuest  = "guest"
+)
+
+// Permission names. Services check permissions rather than role names so that
+// roles can be reshaped without touching code.
+const (
+	PermissionUsersManage    = "users:manage"
+	PermissionSettingsManage = "settings:manage"
+	PermissionClientsManage  = "clients:manage"
+	PermissionStatsRead      = "stats:read"
+	PermissionFilesRead      = "files:read"
+	PermissionFilesWrite     = "files:write"
+	PermissionCameraView     = "camera:view"
+)
+
+// DefaultRolePermissions are the permissions seeded for each built-in role
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionUsersManage,
+		PermissionSettingsManage,
+		PermissionClientsManage,
+		PermissionStatsRead,
+		PermissionFilesRead,
+		PermissionFilesWrite,
+		PermissionCameraView,
+	},
+	RoleFamily: {
+		PermissionStatsRead,
+		PermissionFilesRead,
+		PermissionFilesWrite,
+		PermissionCameraView,
+	},
+	RoleGuest: {
+		PermissionFilesRead,
+	},
+}
+
+// Role groups permissions that are granted to users together
+type Role struct {
+	BaseModel
+	Name        string       `json:"name" gorm:"size:50;uniqueIndex;not null"`
+	Description string       `json:"description" gorm:"size:255"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+}
+
+// TableName returns the table name for Role model
+func (Role) TableName() string {
+	return "roles"
+}
+
+// Permission is a single capability that can be granted through roles
+type Permission struct {
+	BaseModel
+	Name        string `json:"name" gorm:"size:100;uniqueIndex;not null"`
+	Description string `json:"description" gorm:"size:255"`
+}
+
+// TableName returns the table name for Permission model
+func (Permission) TableName() string {
+	return "permissions"
+}
+
+// RoleNames returns the names of the given roles
+func RoleNames(roles []Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// PermissionNames returns the distinct permission names granted by the given roles
+func PermissionNames(roles []Role) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				names = append(names, permission.Name)
+			}
+		}
+	}
+	return names
+}
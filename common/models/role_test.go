@@ -0,0 +1,39 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPermissionNamesDeduplicates(t *testing.T) {
+	roles := []Role{
+		{Name: RoleFamily, Permissions: []Permission{{Name: PermissionFilesRead}, {Name: PermissionCameraView}}},
+		{Name: RoleGuest, Permissions: []Permission{{Name: PermissionFilesRead}}},
+	}
+
+	got := PermissionNames(roles)
+	want := []string{PermissionFilesRead, PermissionCameraView}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PermissionNames() = %v, want %v", got, want)
+	}
+	if names := RoleNames(roles); !reflect.DeepEqual(names, []string{RoleFamily, RoleGuest}) {
+		t.Fatalf("RoleNames() = %v", names)
+	}
+}
+
+func TestClaimsPermissions(t *testing.T) {
+	claims := JWTClaims{
+		Roles:       []string{RoleFamily},
+		Permissions: DefaultRolePermissions[RoleFamily],
+	}
+
+	if !claims.HasPermission(PermissionCameraView) {
+		t.Error("family should be able to view cameras")
+	}
+	if claims.HasPermission(PermissionUsersManage) {
+		t.Error("family should not manage users")
+	}
+	if claims.IsAdmin() {
+		t.Error("family is not admin")
+	}
+}
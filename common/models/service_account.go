@@ -0,0 +1,32 @@
+package models
+
+import "strings"
+
+// ServiceAccount is a non-human client, such as another home-server service,
+// that obtains short-lived access tokens with the OAuth 2.0 client_credentials
+// grant. Only the SHA-256 hash of its secret is stored.
+type ServiceAccount struct {
+	BaseModel
+	ClientID   string `json:"client_id" gorm:"size:64;uniqueIndex;not null"`
+	SecretHash string `json:"-" gorm:"size:64;not null"`
+	Name       string `json:"name" gorm:"size:100;not null"`
+	Audiences  string `json:"-" gorm:"size:255;not null"` // space separated services it may get tokens for
+	Scopes     string `json:"-" gorm:"size:255;not null"` // space separated scopes it may request
+	Disabled   bool   `json:"disabled" gorm:"default:false"`
+	CreatedBy  uint   `json:"created_by"`
+}
+
+// TableName returns the table name for ServiceAccount model
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
+
+// AudienceList returns the services the account may get tokens for
+func (a *ServiceAccount) AudienceList() []string {
+	return strings.Fields(a.Audiences)
+}
+
+// ScopeList returns the scopes the account may request
+func (a *ServiceAccount) ScopeList() []string {
+	return strings.Fields(a.Scopes)
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Session is a first-party login on one device. It lives as long as its refresh
+// token family and is updated every time the family is rotated. Forward-auth
+// sign-ins are sessions without refresh tokens that live as long as their cookie.
+type Session struct {
+	BaseModel
+	UserID     uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID   string     `json:"-" gorm:"size:64;uniqueIndex;not null"` // refresh token family, also the "sid" claim of its access tokens and forward-auth cookie
+	UserAgent  string     `json:"user_agent" gorm:"size:512"`
+	IPAddress  string     `json:"ip_address" gorm:"size:64"`
+	LastSeenAt time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index;not null"` // expiry of the family's newest refresh token or forward-auth cookie
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" gorm:"index"`
+}
+
+// TableName returns the table name for Session model
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// IsActive reports whether the session can still be refreshed
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Setting keys
+const (
+	SettingRegistrationMode = "registration_mode"
+)
+
+// ExternalAutoProvisionSetting returns the key of the setting that controls whether
+// signing in with an upstream provider may create new accounts
+func ExternalAutoProvisionSetting(provider string) string {
+	return "external_auto_provision:" + provider
+}
+
+// MagicLinkRoleSetting returns the key of the setting that controls whether
+// users with a role may sign in with an emailed link
+func MagicLinkRoleSetting(role string) string {
+	return "magic_link_role:" + role
+}
+
+// Setting is a runtime-adjustable key/value setting managed by admins
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:64"`
+	Value     string    `json:"value" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table name for Setting model
+func (Setting) TableName() string {
+	return "settings"
+}
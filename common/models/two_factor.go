@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// TOTPCredential holds a user's TOTP authenticator secret. The secret is
+// encrypted at rest; enrollment is complete once ConfirmedAt is set.
+type TOTPCredential struct {
+	BaseModel
+	UserID          uint       `json:"user_id" gorm:"uniqueIndex;not null"`
+	SecretEncrypted string     `json:"-" gorm:"not null"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep    int64      `json:"-" gorm:"not null;default:0"` // last accepted time step, prevents code replay
+}
+
+// TableName returns the table name for TOTPCredential model
+func (TOTPCredential) TableName() string {
+	return "totp_credentials"
+}
+
+// IsConfirmed reports whether enrollment has been confirmed with a valid code
+func (c *TOTPCredential) IsConfirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// RecoveryCode is a hashed single-use code that can replace a TOTP code
+type RecoveryCode struct {
+	BaseModel
+	UserID   uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash string     `json:"-" gorm:"size:64;not null"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TableName returns the table name for RecoveryCode model
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
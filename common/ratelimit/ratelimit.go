@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// sweepInterval is how often idle keys are evicted
+const sweepInterval = time.Minute
+
+// KeyedLimiter applies an independent token bucket to each key, such as an
+// email address or client IP. Idle keys are evicted once their bucket has
+// refilled, so memory stays bounded by the number of recently active keys.
+type KeyedLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	idleAfter time.Duration
+	limiters  map[string]*keyedEntry
+	lastSweep time.Time
+}
+
+type keyedEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewKeyedLimiter creates a limiter allowing limit events per second per key with the given burst
+func NewKeyedLimiter(limit rate.Limit, burst int) *KeyedLimiter {
+	idleAfter := time.Hour
+	if limit > 0 {
+		idleAfter = time.Duration(float64(burst) / float64(limit) * float64(time.Second))
+	}
+
+	return &KeyedLimiter{
+		limit:     limit,
+		burst:     burst,
+		idleAfter: idleAfter,
+		limiters:  make(map[string]*keyedEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// PerWindow creates a limiter allowing n events per key within each window.
+// A non-positive n denies every event.
+func PerWindow(n int, window time.Duration) *KeyedLimiter {
+	if n <= 0 {
+		return NewKeyedLimiter(0, 0)
+	}
+	return NewKeyedLimiter(rate.Every(window/time.Duration(n)), n)
+}
+
+// Allow reports whether an event for key may happen now and consumes a token if so
+func (l *KeyedLimiter) Allow(key string) bool {
+	return l.allowAt(key, time.Now())
+}
+
+func (l *KeyedLimiter) allowAt(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &keyedEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter.AllowN(now, 1)
+}
+
+// Reset forgets the state of a key, for example after a successful login
+func (l *KeyedLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.limiters, key)
+}
+
+// sweep drops keys whose buckets have been idle long enough to be full again
+func (l *KeyedLimiter) sweep(now time.Time) {
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > l.idleAfter {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
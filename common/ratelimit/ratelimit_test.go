@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiterPerKey(t *testing.T) {
+	limiter := PerWindow(2, time.Hour)
+	now := time.Now()
+
+	if !limiter.allowAt("a", now) || !limiter.allowAt("a", now) {
+		t.Fatal("Expected first two events to be allowed")
+	}
+	if limiter.allowAt("a", now) {
+		t.Error("Expected third event within the window to be denied")
+	}
+	if !limiter.allowAt("b", now) {
+		t.Error("Expected a different key to have its own budget")
+	}
+	if !limiter.allowAt("a", now.Add(31*time.Minute)) {
+		t.Error("Expected a token to be refilled after half the window")
+	}
+}
+
+func TestKeyedLimiterSweep(t *testing.T) {
+	limiter := PerWindow(1, time.Minute)
+	now := time.Now()
+
+	limiter.allowAt("a", now)
+	limiter.allowAt("b", now.Add(2*time.Minute))
+
+	if _, ok := limiter.limiters["a"]; ok {
+		t.Error("Expected idle key to be swept")
+	}
+	if _, ok := limiter.limiters["b"]; !ok {
+		t.Error("Expected active key to be kept")
+	}
+}
+
+func TestKeyedLimiterReset(t *testing.T) {
+	limiter := PerWindow(1, time.Hour)
+
+	limiter.Allow("a")
+	if limiter.Allow("a") {
+		t.Fatal("Expected second event to be denied")
+	}
+	limiter.Reset("a")
+	if !limiter.Allow("a") {
+		t.Error("Expected event to be allowed after reset")
+	}
+}
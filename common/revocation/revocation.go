@@ -0,0 +1,185 @@
+package revocation
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+// Audience and Scope of the service token other services need to read the
+// revocation list from the auth service
+const (
+	Audience = "auth-service"
+	Scope    = "revocations:read"
+)
+
+// Snapshot is the serialisable state of a revocation list. It is served by the
+// auth service and polled by other services so that revocation checks stay local.
+type Snapshot struct {
+	// Tokens maps revoked JWT IDs to their expiry as a unix timestamp. Entries
+	// can be dropped once the token would have expired anyway.
+	Tokens map[string]int64 `json:"tokens"`
+	// UserVersions maps user IDs to their current token version. Tokens that
+	// carry a lower version were issued before a user-wide revocation.
+	UserVersions map[string]int `json:"user_versions"`
+	// Sessions maps revoked session IDs (the "sid" claim) to the unix time
+	// after which no access token issued for the session can still be valid.
+	Sessions map[string]int64 `json:"sessions"`
+	// GeneratedAt is when the snapshot was taken
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// List is a concurrency-safe in-memory revocation list
+type List struct {
+	mu           sync.RWMutex
+	tokens       map[string]int64
+	userVersions map[string]int
+	sessions     map[string]int64
+}
+
+// NewList creates an empty revocation list
+func NewList() *List {
+	return &List{
+		tokens:       make(map[string]int64),
+		userVersions: make(map[string]int),
+		sessions:     make(map[string]int64),
+	}
+}
+
+// IsRevoked reports whether the token described by claims has been revoked
+func (l *List) IsRevoked(claims *models.JWTClaims) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if claims.ID != "" {
+		if _, ok := l.tokens[claims.ID]; ok {
+			return true
+		}
+	}
+	if claims.Session != "" {
+		if _, ok := l.sessions[claims.Session]; ok {
+			return true
+		}
+	}
+
+	// Impersonation ends with the admin's session, or when the admin is signed
+	// out everywhere, disabled or loses their roles
+	if actor := claims.Actor; actor != nil {
+		if _, ok := l.sessions[actor.Session]; ok && actor.Session != "" {
+			return true
+		}
+		if actor.Version < l.userVersions[actor.Subject] {
+			return true
+		}
+	}
+
+	return claims.Version < l.userVersions[claims.UserID]
+}
+
+// RevokeToken adds a single token to the list until it expires
+func (l *List) RevokeToken(jti string, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens[jti] = expiresAt.Unix()
+}
+
+// RevokeSession rejects every token issued for a session until the given time,
+// by which all of them will have expired
+func (l *List) RevokeSession(sessionID string, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessions[sessionID] = until.Unix()
+}
+
+// SetUserVersion records the current token version of a user
+func (l *List) SetUserVersion(userID uint, version int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.userVersions[strconv.FormatUint(uint64(userID), 10)] = version
+}
+
+// Replace swaps the list contents for the given snapshot
+func (l *List) Replace(snapshot Snapshot) {
+	tokens := make(map[string]int64, len(snapshot.Tokens))
+	for jti, exp := range snapshot.Tokens {
+		tokens[jti] = exp
+	}
+	userVersions := make(map[string]int, len(snapshot.UserVersions))
+	for userID, version := range snapshot.UserVersions {
+		userVersions[userID] = version
+	}
+	sessions := make(map[string]int64, len(snapshot.Sessions))
+	for sessionID, until := range snapshot.Sessions {
+		sessions[sessionID] = until
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = tokens
+	l.userVersions = userVersions
+	l.sessions = sessions
+}
+
+// Merge adds the revocations of a snapshot to the list, keeping the higher user
+// version where both have one. Unlike Replace it never drops a revocation made
+// while the snapshot was being taken.
+func (l *List) Merge(snapshot Snapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for jti, exp := range snapshot.Tokens {
+		if exp > l.tokens[jti] {
+			l.tokens[jti] = exp
+		}
+	}
+	for userID, version := range snapshot.UserVersions {
+		if version > l.userVersions[userID] {
+			l.userVersions[userID] = version
+		}
+	}
+	for sessionID, until := range snapshot.Sessions {
+		if until > l.sessions[sessionID] {
+			l.sessions[sessionID] = until
+		}
+	}
+}
+
+// Snapshot returns a copy of the list contents
+func (l *List) Snapshot() Snapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := Snapshot{
+		Tokens:       make(map[string]int64, len(l.tokens)),
+		UserVersions: make(map[string]int, len(l.userVersions)),
+		Sessions:     make(map[string]int64, len(l.sessions)),
+		GeneratedAt:  time.Now().UTC(),
+	}
+	for jti, exp := range l.tokens {
+		snapshot.Tokens[jti] = exp
+	}
+	for userID, version := range l.userVersions {
+		snapshot.UserVersions[userID] = version
+	}
+	for sessionID, until := range l.sessions {
+		snapshot.Sessions[sessionID] = until
+	}
+	return snapshot
+}
+
+// Prune drops revoked tokens and sessions that have expired before now
+func (l *List) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for jti, exp := range l.tokens {
+		if exp < now.Unix() {
+			delete(l.tokens, jti)
+		}
+	}
+	for sessionID, until := range l.sessions {
+		if until < now.Unix() {
+			delete(l.sessions, sessionID)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package revocation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shashank/home-server/common/models"
+)
+
+func TestRevokeToken(t *testing.T) {
+	list := NewList()
+	claims := &models.JWTClaims{UserID: "1", RegisteredClaims: jwt.RegisteredClaims{ID: "abc"}}
+
+	if list.IsRevoked(claims) {
+		t.Fatal("Expected token not to be revoked initially")
+	}
+
+	list.RevokeToken("abc", time.Now().Add(time.Minute))
+	if !list.IsRevoked(claims) {
+		t.Error("Expected token to be revoked")
+	}
+
+	list.Prune(time.Now().Add(2 * time.Minute))
+	if list.IsRevoked(claims) {
+		t.Error("Expected expired revocation to be pruned")
+	}
+}
+
+func TestUserVersion(t *testing.T) {
+	list := NewList()
+	list.SetUserVersion(1, 2)
+
+	if !list.IsRevoked(&models.JWTClaims{UserID: "1", Version: 1}) {
+		t.Error("Expected token with older version to be revoked")
+	}
+	if list.IsRevoked(&models.JWTClaims{UserID: "1", Version: 2}) {
+		t.Error("Expected token with current version to be valid")
+	}
+	if list.IsRevoked(&models.JWTClaims{UserID: "2", Version: 0}) {
+		t.Error("Expected token of unrelated user to be valid")
+	}
+}
+
+func TestReplaceFromSnapshot(t *testing.T) {
+	source := NewList()
+	source.RevokeToken("abc", time.Now().Add(time.Minute))
+	source.SetUserVersion(7, 1)
+
+	target := NewList()
+	target.Replace(source.Snapshot())
+
+	if !target.IsRevoked(&models.JWTClaims{UserID: "3", RegisteredClaims: jwt.RegisteredClaims{ID: "abc"}}) {
+		t.Error("Expected revoked token to be copied")
+	}
+	if !target.IsRevoked(&models.JWTClaims{UserID: "7"}) {
+		t.Error("Expected user version to be copied")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	list := NewList()
+	claims := &models.JWTClaims{UserID: "1", Session: "family-1", RegisteredClaims: jwt.RegisteredClaims{ID: "abc"}}
+
+	list.RevokeSession("family-1", time.Now().Add(time.Minute))
+	if !list.IsRevoked(claims) {
+		t.Error("Expected token of revoked session to be revoked")
+	}
+	if list.IsRevoked(&models.JWTClaims{UserID: "1", Session: "family-2"}) {
+		t.Error("Expected token of another session to be valid")
+	}
+
+	target := NewList()
+	target.Replace(list.Snapshot())
+	if !target.IsRevoked(claims) {
+		t.Error("Expected revoked session to be copied")
+	}
+
+	list.Prune(time.Now().Add(2 * time.Minute))
+	if list.IsRevoked(claims) {
+		t.Error("Expected expired session revocation to be pruned")
+	}
+}
+
+func TestMergeKeepsNewerRevocations(t *testing.T) {
+	list := NewList()
+	list.SetUserVersion(1, 3)
+	list.RevokeToken("local", time.Now().Add(time.Minute))
+
+	list.Merge(Snapshot{
+		Tokens:       map[string]int64{"stored": time.Now().Add(time.Minute).Unix()},
+		UserVersions: map[string]int{"1": 2, "2": 1},
+		Sessions:     map[string]int64{"family-1": time.Now().Add(time.Minute).Unix()},
+	})
+
+	if !list.IsRevoked(&models.JWTClaims{UserID: "1", Version: 2}) {
+		t.Error("Expected the higher local user version to be kept")
+	}
+	if !list.IsRevoked(&models.JWTClaims{UserID: "2", Version: 0}) {
+		t.Error("Expected user version from the snapshot to be added")
+	}
+	if !list.IsRevoked(&models.JWTClaims{UserID: "3", RegisteredClaims: jwt.RegisteredClaims{ID: "local"}}) {
+		t.Error("Expected local revocation to be kept")
+	}
+	if !list.IsRevoked(&models.JWTClaims{UserID: "3", RegisteredClaims: jwt.RegisteredClaims{ID: "stored"}}) {
+		t.Error("Expected revoked token from the snapshot to be added")
+	}
+	if !list.IsRevoked(&models.JWTClaims{UserID: "3", Session: "family-1"}) {
+		t.Error("Expected revoked session from the snapshot to be added")
+	}
+}
+
+func TestImpersonationEndsWithTheAdmin(t *testing.T) {
+	list := NewList()
+	claims := &models.JWTClaims{
+		UserID: "2",
+		Actor:  &models.Actor{Subject: "1", Session: "admin-family", Version: 3},
+	}
+	list.SetUserVersion(1, 3)
+
+	if list.IsRevoked(claims) {
+		t.Fatal("Expected impersonation token to be valid while the admin is")
+	}
+
+	list.RevokeSession("admin-family", time.Now().Add(time.Minute))
+	if !list.IsRevoked(claims) {
+		t.Error("Expected impersonation token to be revoked with the admin's session")
+	}
+
+	list = NewList()
+	list.SetUserVersion(1, 4)
+	if !list.IsRevoked(claims) {
+		t.Error("Expected impersonation token to be revoked when the admin's tokens are")
+	}
+}
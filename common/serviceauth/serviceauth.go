@@ -0,0 +1,219 @@
+// Package serviceauth lets services call each other with short-lived tokens
+// from the auth service. A calling service gets its tokens with a TokenSource;
+// the called service checks them with a Verifier.
+package serviceauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/jwks"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/models"
+)
+
+// refreshBefore is how long before it expires a cached token is replaced, so
+// that a token never expires while a request is in flight
+const refreshBefore = time.Minute
+
+// ErrInvalidToken is returned for tokens that are not valid service tokens for this service
+var ErrInvalidToken = errors.New("invalid service token")
+
+// TokenSource obtains tokens for one audience with the client_credentials
+// grant and caches them until shortly before they expire. It is safe for
+// concurrent use.
+type TokenSource struct {
+	cfg      config.ServiceAuthConfig
+	audience string
+	scope    string
+	client   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewTokenSource creates a TokenSource for calling the audience service with
+// the given scopes. Without scopes, tokens carry every scope the account is allowed.
+func NewTokenSource(cfg config.ServiceAuthConfig, audience string, scopes ...string) *TokenSource {
+	return &TokenSource{
+		cfg:      cfg,
+		audience: audience,
+		scope:    strings.Join(scopes, " "),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Token returns a valid access token, requesting a new one when needed
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}, "audience": {s.audience}}
+	if s.scope != "" {
+		form.Set("scope", s.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// client_secret_basic: the credentials are form encoded before base64
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request service token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &failure) == nil && failure.Error != "" {
+			return "", fmt.Errorf("service token request rejected: %s: %s", failure.Error, failure.Description)
+		}
+		return "", fmt.Errorf("service token request failed: %s", resp.Status)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse service token response: %w", err)
+	}
+	if response.AccessToken == "" {
+		return "", errors.New("service token response has no access token")
+	}
+
+	lifetime := time.Duration(response.ExpiresIn) * time.Second
+	if lifetime > 2*refreshBefore {
+		lifetime -= refreshBefore
+	} else {
+		lifetime /= 2
+	}
+	s.token = response.AccessToken
+	s.expiry = time.Now().Add(lifetime)
+	return s.token, nil
+}
+
+// Transport returns an http.RoundTripper that adds a token to every request.
+// A nil base uses http.DefaultTransport.
+func (s *TokenSource) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{source: s, base: base}
+}
+
+// transport authorizes requests with tokens from a TokenSource
+type transport struct {
+	source *TokenSource
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// Verifier checks service tokens sent to one service
+type Verifier struct {
+	keys     *jwks.Remote
+	audience string
+}
+
+// NewVerifier creates a Verifier accepting tokens issued for the audience
+// service, using the key set at cfg.JWKSURL
+func NewVerifier(cfg config.ServiceAuthConfig, audience string) *Verifier {
+	return &Verifier{
+		keys:     jwks.NewRemote(cfg.JWKSURL),
+		audience: audience,
+	}
+}
+
+// Verify checks a service token's signature, expiry and audience. User tokens
+// are rejected even when they are otherwise valid.
+func (v *Verifier) Verify(tokenString string) (*models.JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, v.keys.Keyfunc,
+		jwt.WithAudience(v.audience), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*models.JWTClaims)
+	if !ok || !token.Valid || claims.Type != models.TokenTypeService {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Middleware rejects requests without a valid service token granting every one
+// of the scopes. The token's claims are stored in the context as "claims" and
+// the calling service account as "client_id".
+func (v *Verifier) Middleware(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_request"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Service token required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := v.Verify(tokenString)
+		if err != nil {
+			logging.Log.Warn("Service token rejected", zap.Error(err), zap.String("path", c.Request.URL.Path))
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired service token"})
+			c.Abort()
+			return
+		}
+
+		for _, scope := range scopes {
+			if !claims.HasScope(scope) {
+				logging.Log.Warn("Service token missing scope",
+					zap.String("client_id", claims.ClientID),
+					zap.String("scope", scope),
+					zap.String("path", c.Request.URL.Path))
+				c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing scope: " + scope})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("claims", claims)
+		c.Set("client_id", claims.ClientID)
+		c.Next()
+	}
+}
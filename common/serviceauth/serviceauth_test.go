@@ -0,0 +1,145 @@
+package serviceauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/jwks"
+	"github.com/shashank/home-server/common/models"
+)
+
+// fakeAuthService issues service tokens for the audience in the request and serves its key set
+func fakeAuthService(t *testing.T) (*httptest.Server, *atomic.Int32, func(models.JWTClaims) string) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := jwks.NewKey(private.Public())
+	if err != nil {
+		t.Fatalf("NewKey() error: %v", err)
+	}
+	sign := func(claims models.JWTClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		token.Header["kid"] = key.KeyID
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks.Set{Keys: []jwks.Key{key}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "svc-camera" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client", "error_description": "client authentication failed"})
+			return
+		}
+		now := time.Now()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": sign(models.JWTClaims{
+				Type:     models.TokenTypeService,
+				ClientID: id,
+				Scope:    r.FormValue("scope"),
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   id,
+					Audience:  jwt.ClaimStrings{r.FormValue("audience")},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(now.Add(10 * time.Minute)),
+				},
+			}),
+			"token_type": "Bearer",
+			"expires_in": 600,
+		})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests, sign
+}
+
+func TestServiceTokens(t *testing.T) {
+	server, requests, sign := fakeAuthService(t)
+	cfg := config.ServiceAuthConfig{
+		TokenURL:     server.URL + "/token",
+		JWKSURL:      server.URL + "/jwks",
+		ClientID:     "svc-camera",
+		ClientSecret: "s3cret",
+	}
+
+	// Tokens are cached and added to outgoing requests
+	var received []string
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("Authorization"))
+	}))
+	defer files.Close()
+
+	source := NewTokenSource(cfg, "file-service", "files:read")
+	client := &http.Client{Transport: source.Transport(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(files.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if requests.Load() != 1 {
+		t.Errorf("token requested %d times, want 1", requests.Load())
+	}
+	if len(received) != 2 || received[0] == "" || received[0] != received[1] {
+		t.Fatalf("unexpected Authorization headers %q", received)
+	}
+
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+
+	// The file service accepts the token; another service does not
+	claims, err := NewVerifier(cfg, "file-service").Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if claims.ClientID != "svc-camera" || !claims.HasScope("files:read") {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if _, err := NewVerifier(cfg, "stats-service").Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token for another audience accepted: %v", err)
+	}
+
+	// User access tokens are never accepted as service tokens
+	userToken := sign(models.JWTClaims{
+		UserID: "1",
+		Type:   models.TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{"file-service"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	if _, err := NewVerifier(cfg, "file-service").Verify(userToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("user token accepted as a service token: %v", err)
+	}
+
+	// Bad credentials surface the OAuth error
+	cfg.ClientSecret = "wrong"
+	if _, err := NewTokenSource(cfg, "file-service").Token(context.Background()); err == nil {
+		t.Error("expected an error for bad credentials")
+	}
+}
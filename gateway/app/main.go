@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/shashank/home-server/common/config"
 	"github.com/shashank/home-server/common/logging"
 	"github.com/shashank/home-server/common/middleware"
+	"github.com/shashank/home-server/common/models"
 )
 
 // init initializes the gateway service configuration and logger
@@ -41,6 +43,9 @@ func main() {
 	// Create Gin router
 	router := gin.Default()
 
+	// Keep the token revocation list in sync with auth-service
+	gateway_middleware.StartRevocationSync(context.Background(), config.AppConfig.JWT.RevocationPollInterval)
+
 	// Add middleware
 	router.Use(middleware.RequestLoggingMiddleware())
 	router.Use(middleware.CorsMiddleware())
@@ -63,17 +68,55 @@ func main() {
 		// Conditional auth middleware - skips auth for login
 		api.Use(gateway_middleware.ConditionalAuthMiddleware([]string{
 			"/api/v1/auth/login",
-			// "/api/v1/auth/public-key",
+			"/api/v1/auth/login/2fa",
+			"/api/v1/auth/passkeys/login/begin",
+			"/api/v1/auth/passkeys/login/finish",
+			"/api/v1/auth/refresh",
+			"/api/v1/auth/register",
+			"/api/v1/auth/invites/lookup",
+			"/api/v1/auth/verify-email",
+			"/api/v1/auth/verify-email/resend",
+			"/api/v1/auth/email/confirm",
+			"/api/v1/auth/password/forgot",
+			"/api/v1/auth/password/reset",
+			"/api/v1/auth/setup",
+			"/api/v1/auth/magic-link",
+			"/api/v1/auth/magic-link/callback",
+			// OIDC endpoints authenticate clients and users themselves
+			"/api/v1/auth/oidc/.well-known/openid-configuration",
+			"/api/v1/auth/oidc/jwks",
+			"/api/v1/auth/oidc/authorize",
+			"/api/v1/auth/oidc/token",
+			"/api/v1/auth/oidc/userinfo",
+			// Sign in with upstream identity providers (browser redirects)
+			"/api/v1/auth/external/*",
+			// Token signing keys for other verifiers
+			"/api/v1/auth/jwks",
+			"/api/v1/auth/public-key",
+			// Token checks for apps that cannot verify tokens themselves; they
+			// authenticate the caller or accept any of our token types
+			"/api/v1/auth/introspect",
+			"/api/v1/auth/userinfo",
+			// Forward-auth check and login page for apps behind the proxy
+			"/api/v1/auth/forward/*",
 		}))
 
 		// Stats service routes (proxied to stats-service)
-		api.Any("/stats", handlers.StatsServiceProxy)
+		api.Any("/stats", gateway_middleware.RequirePermission(models.PermissionStatsRead), handlers.StatsServiceProxy)
 
 		// Auth service routes (all under /auth/*)
 		api.Any("/auth/*path", handlers.AuthServiceProxy)
 
 		// Camera service routes (protected)
-		api.Any("/camera/*path", handlers.CameraServiceProxy)
+		api.Any("/camera/*path", gateway_middleware.RequirePermission(models.PermissionCameraView), handlers.CameraServiceProxy)
+	}
+
+	// Apps without their own login, checked with forward auth before proxying
+	for _, app := range config.AppConfig.Gateway.Apps {
+		router.Any("/apps/"+app.Name+"/*path",
+			gateway_middleware.ForwardAuthMiddleware(app.Name),
+			handlers.AppProxy(app.Name, app.Upstream))
+		logging.Log.Info("Proxying forward-auth app", zap.String("app", app.Name), zap.String("upstream", app.Upstream))
 	}
 
 	// Serve React build under /an
@@ -42,6 +42,13 @@ func StatsServiceProxy(c *gin.Context) {
 	services.ProxyRequest("stats", c)
 }
 
+// AppProxy proxies requests under /apps/<name>/ to a configured app
+func AppProxy(name, upstream string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		services.ProxyApp(name, upstream, c)
+	}
+}
+
 // ServeReactApp serves the React SPA from the build directory
 func ServeReactApp() gin.HandlerFunc {
 	return func(c *gin.Context) {
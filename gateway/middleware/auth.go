@@ -1,39 +1,31 @@
 package middleware
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/shashank/home-server/common/jwks"
 	"github.com/shashank/home-server/common/logging"
 	"github.com/shashank/home-server/common/models"
 	"go.uber.org/zap"
 )
 
-// Cache for the RSA public key
-var (
-	cachedPublicKey     *rsa.PublicKey
-	publicKeyCacheMutex sync.RWMutex
-	publicKeyExpiry     time.Time
-)
+// authKeys is the auth-service key set, fetched from its JWKS endpoint and cached
+var authKeys = jwks.NewRemote(getAuthServiceURL() + "/api/v1/auth/jwks")
 
-// ConditionalAuthMiddleware validates JWT tokens except for whitelisted paths
+// ConditionalAuthMiddleware validates JWT tokens except for whitelisted paths.
+// A path ending in "/*" whitelists everything below it.
 func ConditionalAuthMiddleware(publicPaths []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if current path is in the public paths list
 		currentPath := c.Request.URL.Path
 		for _, path := range publicPaths {
-			if currentPath == path {
+			if currentPath == path ||
+				(strings.HasSuffix(path, "/*") && strings.HasPrefix(currentPath, strings.TrimSuffix(path, "*"))) {
 				// Skip authentication for this path
 				c.Next()
 				return
@@ -89,7 +81,9 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Store claims in context for handlers to use
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
-		c.Set("is_admin", claims.IsAdmin)
+		c.Set("roles", claims.Roles)
+		c.Set("permissions", claims.Permissions)
+		c.Set("claims", claims)
 
 		logging.Log.Debug("Token validated successfully",
 			zap.String("user_id", claims.UserID),
@@ -100,23 +94,10 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// validateJWTLocally validates JWT token using cached public key from auth-service
+// validateJWTLocally validates JWT token using cached signing keys from auth-service
 func validateJWTLocally(tokenString string) (*models.JWTClaims, error) {
-	// Get public key (from cache or fetch)
-	publicKey, err := getPublicKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get public key: %w", err)
-	}
-
-	// Parse and validate token
-	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return publicKey, nil
-	})
-
+	// Parse and validate token; each key only accepts its own algorithm
+	token, err := jwt.ParseWithClaims(tokenString, &models.JWTClaims{}, authKeys.Keyfunc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -131,81 +112,12 @@ func validateJWTLocally(tokenString string) (*models.JWTClaims, error) {
 		return nil, errors.New("invalid token type, expected access token")
 	}
 
-	return claims, nil
-}
-
-// getPublicKey retrieves the RSA public key from cache or fetches it from auth-service
-func getPublicKey() (*rsa.PublicKey, error) {
-	// Check cache first (with read lock)
-	publicKeyCacheMutex.RLock()
-	if cachedPublicKey != nil && time.Now().Before(publicKeyExpiry) {
-		publicKeyCacheMutex.RUnlock()
-		return cachedPublicKey, nil
-	}
-	publicKeyCacheMutex.RUnlock()
-
-	// Cache miss or expired, fetch new key (with write lock)
-	publicKeyCacheMutex.Lock()
-	defer publicKeyCacheMutex.Unlock()
-
-	// Double-check after acquiring write lock
-	if cachedPublicKey != nil && time.Now().Before(publicKeyExpiry) {
-		return cachedPublicKey, nil
-	}
-
-	// Fetch public key from auth-service
-	authServiceURL := getAuthServiceURL() + "/api/v1/auth/public-key"
-
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	resp, err := client.Get(authServiceURL)
-	if err != nil {
-		logging.Log.Error("Failed to fetch public key from auth-service",
-			zap.Error(err),
-		)
-		return nil, fmt.Errorf("failed to fetch public key: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to fetch public key: %s", string(body))
-	}
-
-	// Parse response
-	var keyResp models.PublicKeyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
-		return nil, fmt.Errorf("failed to parse public key response: %w", err)
+	// Reject tokens revoked by logout, password change or account disable
+	if revocations.IsRevoked(claims) {
+		return nil, errors.New("token has been revoked")
 	}
 
-	// Parse PEM-encoded public key
-	block, _ := pem.Decode([]byte(keyResp.PublicKey))
-	if block == nil {
-		return nil, errors.New("failed to decode PEM block containing public key")
-	}
-
-	// Parse RSA public key
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse RSA public key: %w", err)
-	}
-
-	rsaPublicKey, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return nil, errors.New("not an RSA public key")
-	}
-
-	// Cache the public key for 1 hour
-	cachedPublicKey = rsaPublicKey
-	publicKeyExpiry = time.Now().Add(1 * time.Hour)
-
-	logging.Log.Info("Public key fetched and cached",
-		zap.Time("expires_at", publicKeyExpiry),
-	)
-
-	return cachedPublicKey, nil
+	return claims, nil
 }
 
 // getAuthServiceURL returns the auth-service URL using Docker Compose DNS
@@ -234,7 +146,9 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 				// Valid token, set user context
 				c.Set("user_id", claims.UserID)
 				c.Set("email", claims.Email)
-				c.Set("is_admin", claims.IsAdmin)
+				c.Set("roles", claims.Roles)
+				c.Set("permissions", claims.Permissions)
+				c.Set("claims", claims)
 				c.Set("authenticated", true)
 			}
 		}
@@ -242,3 +156,25 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequirePermission rejects requests whose token does not grant the permission.
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Value("claims").(*models.JWTClaims)
+		if !ok || !claims.HasPermission(permission) {
+			logging.Log.Warn("Permission denied",
+				zap.Any("user_id", c.Value("user_id")),
+				zap.String("permission", permission),
+				zap.String("path", c.Request.URL.Path),
+			)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Missing permission: " + permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
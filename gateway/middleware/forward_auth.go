@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shashank/home-server/common/logging"
+	"go.uber.org/zap"
+)
+
+// forwardAuthHeaders are the identity headers set by a successful forward-auth check
+var forwardAuthHeaders = []string{"X-Auth-User-Id", "X-Auth-Email", "X-Auth-Name", "X-Auth-Roles"}
+
+// forwardAuthClient calls auth-service; redirects to the login page are passed to the browser
+var forwardAuthClient = &http.Client{
+	Timeout: 5 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// ForwardAuthMiddleware protects a proxied app that has no login of its own.
+// Each request is checked by auth-service's forward-auth endpoint; allowed
+// requests continue with the user's identity headers, others get the check's
+// response, e.g. a redirect to the login page.
+func ForwardAuthMiddleware(app string) gin.HandlerFunc {
+	verifyURL := getAuthServiceURL() + "/api/v1/auth/forward/verify?app=" + url.QueryEscape(app)
+
+	return func(c *gin.Context) {
+		// Apps trust these headers, so clients must never set them
+		for _, header := range forwardAuthHeaders {
+			c.Request.Header.Del(header)
+		}
+
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, verifyURL, nil)
+		if err != nil {
+			logging.Log.Error("Failed to create forward-auth request", zap.Error(err), zap.String("app", app))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
+			c.Abort()
+			return
+		}
+		for _, header := range []string{"Authorization", "Cookie", "Accept"} {
+			if value := c.GetHeader(header); value != "" {
+				req.Header.Set(header, value)
+			}
+		}
+		proto := "http"
+		if c.Request.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set("X-Forwarded-Proto", proto)
+		req.Header.Set("X-Forwarded-Host", c.Request.Host)
+		req.Header.Set("X-Forwarded-Uri", c.Request.RequestURI)
+
+		resp, err := forwardAuthClient.Do(req)
+		if err != nil {
+			logging.Log.Error("Forward-auth check failed", zap.Error(err), zap.String("app", app))
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Authentication service is unavailable"})
+			c.Abort()
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			for _, header := range forwardAuthHeaders {
+				c.Request.Header.Set(header, resp.Header.Get(header))
+			}
+			c.Next()
+			return
+		}
+
+		logging.Log.Debug("Forward-auth check rejected request",
+			zap.String("app", app),
+			zap.Int("status", resp.StatusCode),
+			zap.String("path", c.Request.URL.Path),
+		)
+		for _, header := range []string{"Location", "WWW-Authenticate", "Content-Type"} {
+			if value := resp.Header.Get(header); value != "" {
+				c.Header(header, value)
+			}
+		}
+		c.Status(resp.StatusCode)
+		io.Copy(c.Writer, io.LimitReader(resp.Body, 64*1024))
+		c.Abort()
+	}
+}
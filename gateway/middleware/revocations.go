@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/shashank/home-server/common/config"
+	"github.com/shashank/home-server/common/logging"
+	"github.com/shashank/home-server/common/revocation"
+	"github.com/shashank/home-server/common/serviceauth"
+	"go.uber.org/zap"
+)
+
+// revocations mirrors the auth-service revocation list so tokens can be checked locally
+var revocations = revocation.NewList()
+
+// StartRevocationSync polls the auth-service revocation list until the context is cancelled.
+// Requests carry a token of the gateway's service account (service_auth). If a
+// poll fails the previously fetched list stays in effect.
+func StartRevocationSync(ctx context.Context, interval time.Duration) {
+	source := serviceauth.NewTokenSource(config.AppConfig.ServiceAuth, revocation.Audience, revocation.Scope)
+	client := &http.Client{Transport: source.Transport(nil)}
+
+	go func() {
+		if err := syncRevocations(ctx, client); err != nil {
+			logging.Log.Warn("Initial revocation list sync failed", zap.Error(err))
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := syncRevocations(ctx, client); err != nil {
+					logging.Log.Warn("Revocation list sync failed", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// syncRevocations fetches the current revocation list from auth-service
+func syncRevocations(ctx context.Context, client *http.Client) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getAuthServiceURL()+"/internal/revocations", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create revocation request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch revocation list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to fetch revocation list: %s", string(body))
+	}
+
+	var snapshot revocation.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return fmt.Errorf("failed to parse revocation list: %w", err)
+	}
+
+	revocations.Replace(snapshot)
+
+	logging.Log.Debug("Revocation list synced",
+		zap.Int("revoked_tokens", len(snapshot.Tokens)),
+		zap.Int("revoked_users", len(snapshot.UserVersions)))
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shashank/home-server/common/config"
 	"github.com/shashank/home-server/common/logging"
 	"go.uber.org/zap"
 )
@@ -36,6 +37,36 @@ func ProxyRequest(serviceName string, c *gin.Context) {
 	}
 	targetURL := fmt.Sprintf("http://%s:%s%s", targetHost, targetPort, path)
 
+	forward(serviceName, targetURL, c)
+}
+
+// ProxyApp forwards a request under /apps/<name>/ to an app's upstream URL. The
+// prefix is removed from the path and passed on in X-Forwarded-Prefix. Apps only
+// learn who the user is from the X-Auth-* headers; the user's access token and
+// sign-in cookie are withheld so that an app cannot act as the user.
+func ProxyApp(name, upstream string, c *gin.Context) {
+	c.Request.Header.Del("Authorization")
+	removeCookie(c.Request.Header, config.AppConfig.Gateway.SessionCookie)
+
+	path := c.Param("path")
+	if c.Request.URL.RawQuery != "" {
+		path += "?" + c.Request.URL.RawQuery
+	}
+	targetURL := strings.TrimRight(upstream, "/") + path
+
+	proto := "http"
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+	c.Request.Header.Set("X-Forwarded-Prefix", "/apps/"+name)
+	c.Request.Header.Set("X-Forwarded-Host", c.Request.Host)
+	c.Request.Header.Set("X-Forwarded-Proto", proto)
+
+	forward(name, targetURL, c)
+}
+
+// forward sends the incoming request to targetURL and streams back the response
+func forward(serviceName, targetURL string, c *gin.Context) {
 	logging.Log.Debug("Proxying request",
 		zap.String("service", serviceName),
 		zap.String("method", c.Request.Method),
@@ -58,9 +89,16 @@ func ProxyRequest(serviceName string, c *gin.Context) {
 	// Copy headers from original request
 	copyHeaders(req.Header, c.Request.Header)
 
-	// Forward the request with timeout
+	// Replace any client-supplied value so backends see the real client address
+	req.Header.Set("X-Forwarded-For", c.ClientIP())
+
+	// Forward the request with timeout. Redirects are passed through to the
+	// caller rather than followed, e.g. OIDC redirects back to client apps.
 	client := &http.Client{
 		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 
 	resp, err := client.Do(req)
@@ -118,6 +156,22 @@ func getServicePort(serviceName string) string {
 	return "8080" // default port
 }
 
+// removeCookie drops the named cookie from the request headers, keeping any others
+func removeCookie(header http.Header, name string) {
+	cookies := (&http.Request{Header: header}).Cookies()
+	header.Del("Cookie")
+
+	kept := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie.Name != name {
+			kept = append(kept, cookie.Name+"="+cookie.Value)
+		}
+	}
+	if len(kept) > 0 {
+		header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
 // copyHeaders copies HTTP headers from source to destination
 func copyHeaders(dst, src http.Header) {
 	for key, values := range src {
@@ -1,24 +0,0 @@
-package main
-
-import (
-	"fmt"
-	"os"
-
-	"golang.org/x/crypto/bcrypt"
-)
-
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <password>\n", os.Args[0])
-		os.Exit(1)
-	}
-
-	password := os.Args[1]
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 10)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error hashing password: %v\n", err)
-		os.Exit(1)
-	}
-
-	fmt.Print(string(hashedPassword))
-}
@@ -1,13 +1,67 @@
 import React, { useState, useRef, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
+import axios from 'axios';
 import { useAuth } from '../context/AuthContext';
 
+const SESSIONS_URL = 'http://localhost:8080/api/v1/auth/users/sessions';
+
+// Short "Browser on OS" label for a user agent string
+const describeDevice = (userAgent) => {
+    if (!userAgent) return 'Unknown device';
+    const browser = ['Edg', 'Firefox', 'Chrome', 'Safari'].find(name => userAgent.includes(name));
+    const os = ['Windows', 'Android', 'iPhone', 'iPad', 'Mac OS', 'Linux'].find(name => userAgent.includes(name));
+    if (!browser && !os) return userAgent.slice(0, 40);
+    const browserName = browser === 'Edg' ? 'Edge' : browser;
+    return [browserName, os && `on ${os === 'Mac OS' ? 'macOS' : os}`].filter(Boolean).join(' ');
+};
+
 function UserProfile() {
     const { user, logout } = useAuth();
     const [isDropdownOpen, setIsDropdownOpen] = useState(false);
+    const [sessions, setSessions] = useState([]);
     const dropdownRef = useRef(null);
     const navigate = useNavigate();
 
+    const authHeaders = () => ({
+        headers: {
+            'Authorization': `Bearer ${user.token}`
+        }
+    });
+
+    const fetchSessions = async () => {
+        try {
+            const response = await axios.get(SESSIONS_URL, authHeaders());
+            setSessions(response.data.sessions || []);
+        } catch (error) {
+            console.error('Failed to fetch sessions:', error);
+        }
+    };
+
+    useEffect(() => {
+        if (isDropdownOpen && user) {
+            fetchSessions();
+        }
+        // eslint-disable-next-line react-hooks/exhaustive-deps
+    }, [isDropdownOpen]);
+
+    const revokeSession = async (sessionId) => {
+        try {
+            await axios.delete(`${SESSIONS_URL}/${sessionId}`, authHeaders());
+        } catch (error) {
+            console.error('Failed to revoke session:', error);
+        }
+        fetchSessions();
+    };
+
+    const revokeOtherSessions = async () => {
+        try {
+            await axios.delete(SESSIONS_URL, authHeaders());
+        } catch (error) {
+            console.error('Failed to revoke other sessions:', error);
+        }
+        fetchSessions();
+    };
+
     useEffect(() => {
         const handleClickOutside = (event) => {
             if (dropdownRef.current && !dropdownRef.current.contains(event.target)) {
@@ -48,6 +102,38 @@ function UserProfile() {
                         <div className="profile-name">{user.username || user.name || 'User'}</div>
                         <div className="profile-email">{user.email}</div>
                     </div>
+                    {sessions.length > 0 && (
+                        <div className="profile-sessions">
+                            <div className="profile-sessions-title">Active sessions</div>
+                            {sessions.map(session => (
+                                <div key={session.id} className="profile-session">
+                                    <div className="profile-session-info">
+                                        <div className="profile-session-device">
+                                            {describeDevice(session.user_agent)}
+                                        </div>
+                                        <div className="profile-session-meta">
+                                            {session.ip_address} · {new Date(session.last_seen_at).toLocaleString()}
+                                        </div>
+                                    </div>
+                                    {session.current ? (
+                                        <span className="profile-session-current">This device</span>
+                                    ) : (
+                                        <button
+                                            onClick={() => revokeSession(session.id)}
+                                            className="profile-session-revoke"
+                                        >
+                                            Sign out
+                                        </button>
+                                    )}
+                                </div>
+                            ))}
+                            {sessions.some(session => !session.current) && (
+                                <button onClick={revokeOtherSessions} className="dropdown-item">
+                                    Sign out other sessions
+                                </button>
+                            )}
+                        </div>
+                    )}
                     <button onClick={handleLogout} className="dropdown-item">
                         Logout
                     </button>
@@ -47,7 +47,20 @@ export const AuthProvider = ({ children }) => {
         }
     };
 
-    const logout = () => {
+    const logout = async () => {
+        const token = localStorage.getItem('token');
+        if (token) {
+            try {
+                // Revoke the token server-side so it can't be reused
+                await axios.post('http://localhost:8080/api/v1/auth/logout', null, {
+                    headers: {
+                        'Authorization': `Bearer ${token}`
+                    }
+                });
+            } catch (error) {
+                console.error('Failed to logout on server:', error);
+            }
+        }
         localStorage.removeItem('token');
         setUser(null);
     };